@@ -0,0 +1,256 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+/*
+Package alerts finds new ads which match searches saved by users.
+
+Checker runs every saved search on ads created since the previous check and
+records alerts about found ads; users read them through API. Search is checked
+with a small overlap, because ad is visible only after its transaction is
+committed but has time of its beginning. Alerts are unique for search and ad,
+so ads found twice are skipped. If Checker has Notifier then it's notified
+about ads which are new for search, i.e. MailNotifier sends them by email.
+*/
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+const (
+	// overlap of checked periods of time
+	overlap = time.Minute
+
+	// maximal number of ads found by one check of search
+	maxAds = 100
+)
+
+// domain is a base part of references to ads in mails
+var domain = os.Getenv("URL_OF_API")
+
+// Config is config of checker of saved searches. Interval is a period of
+// checking in background, empty string disables it. Log enables notifier
+// which writes alerts to log. Mail enables MailNotifier, it's created by
+// caller which has mailer.
+type Config struct {
+	Interval string `json:"Interval"`
+	Log      bool   `json:"Log"`
+	Mail     bool   `json:"Mail"`
+}
+
+// Notifier is notified about ads which are new for saved search.
+type Notifier interface {
+	Notify(ctx context.Context, search *model.SavedSearch, ads []*model.AdItem) error
+}
+
+// LogNotifier writes alerts to log.
+type LogNotifier struct{}
+
+// Notify writes alerts about ads to log.
+func (LogNotifier) Notify(ctx context.Context, search *model.SavedSearch, ads []*model.AdItem) error {
+	for _, ad := range ads {
+		log.Printf("Alert: ad %d %q matches search %d of user %d",
+			ad.ID, ad.Title, search.ID, search.UserID)
+	}
+	return nil
+}
+
+// MailNotifier sends alerts to email of owner of saved search.
+type MailNotifier struct {
+	db     model.DB
+	mailer model.Mailer
+}
+
+// NewMailNotifier creates notifier which takes owners of searches
+// from db and sends mails to them by mailer.
+func NewMailNotifier(db model.DB, mailer model.Mailer) *MailNotifier {
+	return &MailNotifier{
+		db:     db,
+		mailer: mailer,
+	}
+}
+
+// Notify sends one mail about all ads to owner of search. Mails
+// aren't sent to emails which aren't verified.
+func (n *MailNotifier) Notify(ctx context.Context, search *model.SavedSearch, ads []*model.AdItem) error {
+	user, err := n.db.GetUserWithID(ctx, search.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified {
+		return nil
+	}
+
+	body := "Hello, " + user.FirstName + "!\n\n" +
+		"New ads match your saved search \"" + search.Name + "\":\n\n"
+	for _, ad := range ads {
+		body += ad.Title + "\n" + domain + "/ads/" + strconv.FormatInt(ad.ID, 10) + "\n\n"
+	}
+	body += "You can delete saved search in your profile to stop these mails.\n"
+
+	return n.mailer.SendMail(ctx, &model.Mail{
+		To:      user.Email,
+		Subject: "New ads for your search",
+		Body:    body,
+	})
+}
+
+// Checker checks saved searches.
+type Checker struct {
+	db       model.DB
+	notifier Notifier
+
+	interval time.Duration
+}
+
+// Report is a result of one check.
+type Report struct {
+	Checked int
+	Alerts  int
+	Failed  []int64
+}
+
+// New creates checker with provided config. Notifier can be nil,
+// then alerts are only recorded or written to log if config has Log.
+func New(cfg Config, db model.DB, notifier Notifier) (*Checker, error) {
+	c := &Checker{
+		db:       db,
+		notifier: notifier,
+	}
+	if cfg.Log && notifier == nil {
+		c.notifier = LogNotifier{}
+	}
+
+	var err error
+	if cfg.Interval != "" {
+		if c.interval, err = time.ParseDuration(cfg.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if c.interval < 0 {
+		return nil, errors.New("Interval of alerts can't be negative")
+	}
+
+	return c, nil
+}
+
+// Enabled reports if checker has to run in background.
+func (c *Checker) Enabled() bool {
+	return c.interval > 0
+}
+
+// Run checks saved searches every interval until context is done.
+func (c *Checker) Run(ctx context.Context) {
+	if !c.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Check(ctx)
+			if err != nil {
+				log.Println("Can't check saved searches", err.Error())
+				continue
+			}
+			log.Println(report.String())
+		}
+	}
+}
+
+// Check checks every saved search once. Search which can't be checked
+// is reported as failed and it's checked from the same time next time.
+func (c *Checker) Check(ctx context.Context) (*Report, error) {
+	searches, err := c.db.GetAllSavedSearches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Checked: len(searches),
+		Failed:  make([]int64, 0),
+	}
+	for _, search := range searches {
+		added, err := c.checkSearch(ctx, search, time.Now())
+		if err != nil {
+			log.Println("Can't check saved search", search.ID, err.Error())
+			report.Failed = append(report.Failed, search.ID)
+			continue
+		}
+		report.Alerts += added
+	}
+
+	return report, nil
+}
+
+// checkSearch records alerts about ads which match search and are
+// created before now. It returns number of new alerts.
+func (c *Checker) checkSearch(ctx context.Context, search *model.SavedSearch, now time.Time) (int, error) {
+	sp := search.Params
+	sp.Limit, sp.Offset, sp.Sort = maxAds, 0, model.SortOldest
+	sp.CursorID, sp.Backward = 0, false
+	if from := search.CheckedTime.Add(-overlap); sp.CreatedAfter.Before(from) {
+		sp.CreatedAfter = from
+	}
+	if sp.CreatedBefore.IsZero() || now.Before(sp.CreatedBefore) {
+		sp.CreatedBefore = now
+	}
+
+	ads := make([]*model.AdItem, 0)
+	if sp.CreatedAfter.Before(sp.CreatedBefore) {
+		var err error
+		if ads, err = c.db.GetAds(ctx, &sp); err != nil {
+			return 0, err
+		}
+	}
+	// next check starts from the last found ad if there are more of them
+	checked := now
+	if last := len(ads) - 1; last == maxAds-1 && ads[last].CreationTime.Add(overlap).Before(now) {
+		checked = ads[last].CreationTime.Add(overlap)
+	}
+
+	ids := make([]int64, len(ads))
+	for i, ad := range ads {
+		ids[i] = ad.ID
+	}
+	added, err := c.db.AddAlerts(ctx, search.ID, ids, checked)
+	if err != nil || len(added) == 0 || c.notifier == nil {
+		return len(added), err
+	}
+
+	isAdded := make(map[int64]bool, len(added))
+	for _, id := range added {
+		isAdded[id] = true
+	}
+	newAds := make([]*model.AdItem, 0, len(added))
+	for _, ad := range ads {
+		if isAdded[ad.ID] {
+			newAds = append(newAds, ad)
+		}
+	}
+	if err := c.notifier.Notify(ctx, search, newAds); err != nil {
+		log.Println("Can't notify about alerts of search", search.ID, err.Error())
+	}
+
+	return len(added), nil
+}
+
+// String returns short summary of report.
+func (r *Report) String() string {
+	return fmt.Sprintf("Alerts: checked %d searches, %d new alerts, %d failed",
+		r.Checked, r.Alerts, len(r.Failed))
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package alerts_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"bmstu.codes/developers34/SBWeb/pkg/alerts"
+	"bmstu.codes/developers34/SBWeb/pkg/mailer"
+	"bmstu.codes/developers34/SBWeb/pkg/memdb"
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// notifier remembers IDs of ads it was notified about
+type notifier map[int64][]int64
+
+func (n notifier) Notify(ctx context.Context, search *model.SavedSearch, ads []*model.AdItem) error {
+	for _, ad := range ads {
+		n[search.ID] = append(n[search.ID], ad.ID)
+	}
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	if _, err := alerts.New(alerts.Config{Interval: "hour"}, nil, nil); err == nil {
+		t.Error("Expected error of parsing")
+	}
+	if _, err := alerts.New(alerts.Config{Interval: "-1h"}, nil, nil); err == nil {
+		t.Error("Expected error of negative interval")
+	}
+
+	c, err := alerts.New(alerts.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if c.Enabled() {
+		t.Error("Checker without interval mustn't be enabled")
+	}
+	c.Run(context.Background()) // returns immediately
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	db.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@gmail.com"})
+
+	db.NewSavedSearch(ctx, &model.SavedSearch{UserID: 1, Name: "Roofs in Moscow",
+		Params: model.SearchParams{Query: "roof", City: "Moscow", Limit: 1}}, 20)
+	db.NewSavedSearch(ctx, &model.SavedSearch{UserID: 2, Name: "Moscow",
+		Params: model.SearchParams{City: "Moscow"}}, 20)
+
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 2, City: "Moscow"})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 2, City: "Tver"})
+	db.NewAd(ctx, &model.AdItem{Title: "Red roof", UserID: 2, City: "Moscow"})
+	db.NewAd(ctx, &model.AdItem{Title: "Boiler", UserID: 2, City: "Moscow"})
+
+	n := make(notifier)
+	c, _ := alerts.New(alerts.Config{}, db, n)
+	report, err := c.Check(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if report.Checked != 2 || report.Alerts != 5 || len(report.Failed) != 0 {
+		t.Error("Unexpected report", report.String())
+	}
+	if len(n[1]) != 2 || n[1][0] != 1 || n[1][1] != 3 || len(n[2]) != 3 {
+		t.Error("Expected notification about new ads", n)
+	}
+
+	// the same ads aren't alerted twice
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 2, City: "Moscow"})
+	n = make(notifier)
+	c, _ = alerts.New(alerts.Config{}, db, n)
+	if report, _ = c.Check(ctx); report.Alerts != 2 {
+		t.Error("Expected 2 new alerts got", report.Alerts)
+	}
+	if len(n[1]) != 1 || n[1][0] != 5 {
+		t.Error("Expected notification about the last ad", n)
+	}
+
+	list, _ := db.GetAlerts(ctx, 1, 15, 0)
+	if len(list) != 3 || list[0].AdID != 5 || list[0].SearchName != "Roofs in Moscow" ||
+		list[2].AdTitle != "Roof" {
+		t.Error("Unexpected alerts of user", len(list))
+	}
+	if list, _ = db.GetAlerts(ctx, 1, 15, 1); len(list) != 2 || list[0].AdID != 3 {
+		t.Error("Expected offset of alerts")
+	}
+
+	db.RemoveAd(ctx, 3)
+	if list, _ = db.GetAlerts(ctx, 1, 15, 0); len(list) != 2 {
+		t.Error("Expected alerts without removed ad")
+	}
+}
+
+func TestMailNotifier(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com",
+		EmailVerified: true})
+	db.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@gmail.com"})
+	db.NewSavedSearch(ctx, &model.SavedSearch{UserID: 1, Name: "Roofs",
+		Params: model.SearchParams{Query: "roof"}}, 20)
+	db.NewSavedSearch(ctx, &model.SavedSearch{UserID: 2, Name: "Roofs",
+		Params: model.SearchParams{Query: "roof"}}, 20)
+	db.NewAd(ctx, &model.AdItem{Title: "Red roof", UserID: 2, City: "Moscow"})
+	db.NewAd(ctx, &model.AdItem{Title: "Green roof", UserID: 2, City: "Tver"})
+
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+	c, _ := alerts.New(alerts.Config{Log: true}, db, alerts.NewMailNotifier(db, outbox))
+	if _, err := c.Check(ctx); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	// only verified email gets one mail about all ads
+	mails := outbox.Mails()
+	if len(mails) != 1 || mails[0].To != "ivan@gmail.com" {
+		t.Fatal("Expected one mail to verified email got", len(mails))
+	}
+	if !strings.Contains(mails[0].Body, "Red roof") || !strings.Contains(mails[0].Body, "Green roof") ||
+		!strings.Contains(mails[0].Body, "/ads/1") {
+		t.Error("Expected ads in mail", mails[0].Body)
+	}
+
+	// the same ads aren't sent twice
+	c.Check(ctx)
+	if len(outbox.Mails()) != 1 {
+		t.Error("Expected no new mails")
+	}
+}
@@ -8,13 +8,17 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 	"golang.org/x/crypto/bcrypt"
@@ -27,6 +31,13 @@ import (
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
+// maxSuggestions is a maximal number of suggestions returned by */ads/suggest
+const maxSuggestions = 20
+
+// maxCorrections is a maximal number of corrected queries
+// returned by fuzzy search in "did you mean" list
+const maxCorrections = 3
+
 // StartServer configures and runs API server. It's always returns channel with errors
 // to monitor state of server which is running in other goroutine.
 func StartServer(cfg Config, m *model.Model) (*http.Server, chan error) {
@@ -36,29 +47,64 @@ func StartServer(cfg Config, m *model.Model) (*http.Server, chan error) {
 	// set handlers
 	r.Handle("/ads", readMultipleAds(m)).Methods("GET")
 	r.Handle("/ads/{id:[0-9]+}", readOneAd(m)).Methods("GET")
+	r.Handle("/ads/suggest", suggestAds(m)).Methods("GET")
+
+	r.Handle("/categories", readCategories(m)).Methods("GET")
 
 	r.Handle("/users/{id:[0-9]+}", readUserWithID(m)).Methods("GET")
 
 	r.Handle("/users/new", userCreatePage(m)).Methods("POST")
-	r.Handle("/users/login", checkConnSM(m, logRequestMiddleware(m, userLoginPage(m)))).Methods("POST")
-	r.Handle("/users/logout", checkConnSM(m, userLogoutPage(m))).Methods("POST", "DELETE")
+	r.Handle("/users/login", logRequestMiddleware(m, userLoginPage(m))).Methods("POST")
+	r.Handle("/users/logout", userLogoutPage(m)).Methods("POST", "DELETE")
+	r.Handle("/users/token", tokenPage(m)).Methods("POST")
+	r.Handle("/users/token/revoke", revokeTokenPage(m)).Methods("POST")
+	r.Handle("/users/verify", verifyEmailPage(m)).Methods("GET", "POST")
+	r.Handle("/users/verify/resend",
+		checkCookieMiddleware(m, resendVerificationPage(m))).Methods("POST")
+	r.Handle("/users/password/forgot", forgotPasswordPage(m)).Methods("POST")
+	r.Handle("/users/password/reset", resetPasswordPage(m)).Methods("POST")
 
 	r.Handle("/users/profile",
-		checkConnSM(m, checkCookieMiddleware(m, userProfilePage(m)))).Methods("GET")
+		checkCookieMiddleware(m, userProfilePage(m))).Methods("GET")
 	r.Handle("/users/profile",
-		checkConnSM(m, checkCookieMiddleware(m, userUpdatePage(m)))).Methods("POST")
+		checkCookieMiddleware(m, userUpdatePage(m))).Methods("POST")
 	r.Handle("/users/profile",
-		checkConnSM(m, checkCookieMiddleware(m, userDeletePage(m)))).Methods("DELETE")
+		checkCookieMiddleware(m, userDeletePage(m))).Methods("DELETE")
+	r.Handle("/users/profile/password",
+		checkCookieMiddleware(m, changePasswordPage(m))).Methods("POST")
+	r.Handle("/users/profile/email",
+		checkCookieMiddleware(m, changeEmailPage(m))).Methods("POST")
+	r.Handle("/users/profile/email/confirm", confirmEmailPage(m)).Methods("GET", "POST")
+
+	r.Handle("/users/sessions",
+		checkCookieMiddleware(m, userSessionsPage(m))).Methods("GET")
+	r.Handle("/users/sessions/{id:[0-9a-f]+}",
+		checkCookieMiddleware(m, userSessionDeletePage(m))).Methods("DELETE")
+
+	r.Handle("/users/profile/searches",
+		checkCookieMiddleware(m, savedSearchesPage(m))).Methods("GET")
+	r.Handle("/users/profile/searches",
+		checkCookieMiddleware(m, savedSearchCreatePage(m))).Methods("POST")
+	r.Handle("/users/profile/searches/{id:[0-9]+}",
+		checkCookieMiddleware(m, savedSearchDeletePage(m))).Methods("DELETE")
+	r.Handle("/users/profile/alerts",
+		checkCookieMiddleware(m, alertsPage(m))).Methods("GET")
 
 	r.Handle("/ads/new",
-		checkConnSM(m, checkCookieMiddleware(m, adCreatePage(m)))).Methods("POST")
+		checkCookieMiddleware(m, adCreatePage(m))).Methods("POST")
 	r.Handle("/ads/edit/{id:[0-9]+}",
-		checkConnSM(m, checkCookieMiddleware(m, adUpdatePage(m)))).Methods("POST")
+		checkCookieMiddleware(m, adUpdatePage(m))).Methods("POST")
 	r.Handle("/ads/delete/{id:[0-9]+}",
-		checkConnSM(m, checkCookieMiddleware(m, adDeletePage(m)))).Methods("DELETE")
+		checkCookieMiddleware(m, adDeletePage(m))).Methods("DELETE")
 
 	r.Handle("/images/{filename}", sendImage(m)).Methods("GET")
 
+	r.Handle("/uploads/new",
+		checkCookieMiddleware(m, uploadCreatePage(m))).Methods("POST")
+	r.Handle("/uploads/{id:[0-9]+-[0-9a-f]+}/finalize",
+		checkCookieMiddleware(m, uploadFinalizePage(m))).Methods("POST")
+	r.PathPrefix("/storage/").Handler(storageUpload(m)).Methods("PUT")
+
 	ch := make(chan error, 1)
 
 	// parse config times
@@ -70,24 +116,22 @@ func StartServer(cfg Config, m *model.Model) (*http.Server, chan error) {
 		log.Println("Can't parse API config")
 		return nil, ch
 	}
+	t, err := parseTimeouts(cfg)
+	if err != nil {
+		ch <- errors.New("Can't parse API config")
+		log.Println("Can't parse API config")
+		return nil, ch
+	}
 
 	// create server
 	server := http.Server{
 		Addr:         cfg.Address,
-		Handler:      r,
+		Handler:      timeoutsMiddleware(t, proxyMiddleware(cfg.TrustProxy, r)),
 		ReadTimeout:  RT,
 		WriteTimeout: WT,
 		IdleTimeout:  IT,
 	}
 
-	// create directory for images if not exist
-	_ = os.Mkdir("images", 0777)
-	/* if err != nil && err != os.PathError {
-		ch <- err
-		log.Println(err)
-		return nil, ch
-	} */
-
 	// run server
 	go func() {
 		if err := server.ListenAndServe(); err != nil {
@@ -99,18 +143,46 @@ func StartServer(cfg Config, m *model.Model) (*http.Server, chan error) {
 	return &server, ch
 }
 
-// readMultipleAds handles */ads with method GET. Allowed parameters are: query, limit, offset.
-// Default value for offset is 0; for limit is 15. If there are no ads, sends an empty JSON array
+// parseTimeouts parses deadlines of operations from config.
+func parseTimeouts(cfg Config) (t timeouts, err error) {
+	t.upload = 15 * time.Minute
+	t.verification = 24 * time.Hour
+	t.reset = time.Hour
+	t.refresh = 30 * 24 * time.Hour
+	for _, item := range []struct {
+		str string
+		d   *time.Duration
+	}{
+		{cfg.DBTimeout, &t.db},
+		{cfg.SMTimeout, &t.sm},
+		{cfg.IMTimeout, &t.im},
+		{cfg.MailTimeout, &t.mail},
+		{cfg.UploadExpiration, &t.upload},
+		{cfg.VerificationExpiration, &t.verification},
+		{cfg.ResetExpiration, &t.reset},
+		{cfg.RefreshExpiration, &t.refresh},
+	} {
+		if item.str == "" {
+			continue
+		}
+		if *item.d, err = time.ParseDuration(item.str); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// readMultipleAds handles */ads with method GET. Allowed parameters are: query, limit, offset
+// and filters of model.SearchParams. Default value for offset is 0; for limit is 15.
+// Parameters with invalid values are ignored. If there are no ads, sends an empty JSON array.
+// If parameter version is 2 then sends adsPage; parameter cursor can be used instead of offset.
 func readMultipleAds(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
 
 		// take params from request
 		// if there are some errors, then it will be handled while validation
-		var params model.SearchParams
-		r.ParseForm()
-		decoder := schema.NewDecoder()
-		decoder.Decode(&params, r.Form)
+		params := decodeSearchParams(r)
 
 		// check if parameters are valid
 		if params.Limit <= 0 {
@@ -119,6 +191,9 @@ func readMultipleAds(m *model.Model) http.Handler {
 		if params.Offset < 0 {
 			params.Offset = 0
 		}
+		if !checkSearchParams(w, &params) {
+			return
+		}
 
 		// TODO query should have same restrictions like title
 		// check if query is valid
@@ -129,16 +204,77 @@ func readMultipleAds(m *model.Model) http.Handler {
 			return
 		} */
 
-		// get list of ads from DB. If there are no ads, send an empty JSON array
-		ads, err := m.GetAds(&params)
+		// cursor of keyset pagination replaces offset
+		if cursor := r.FormValue("cursor"); cursor != "" {
+			if !decodeCursor(cursor, &params) || !isKeysetOrder(&params) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(checkReq, cursorValidErr,
+					errors.New("Client sent bad cursor"), cursorValidMsg))
+				return
+			}
+			params.Offset = 0
+		}
+
+		// legacy response is a JSON array of ads
+		if r.FormValue("version") != "2" {
+			// get list of ads from DB. If there are no ads, send an empty JSON array
+			ctx, cancel := dbContext(r)
+			ads, err := m.GetAds(ctx, &params)
+			if err == nil && len(ads) == 0 && canFallback(&params) {
+				// nothing is found exactly, so misspelled words are searched
+				params.Fuzzy = true
+				ads, err = m.GetAds(ctx, &params)
+			}
+			cancel()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+				return
+			}
+
+			// marshall list of ads to JSON format
+			adsData, _ := json.Marshal(ads)
+
+			// send data as a response
+			w.WriteHeader(http.StatusOK)
+			w.Write(adsData)
+			return
+		}
+
+		// one more ad shows if there is the next page
+		ctx, cancel := dbContext(r)
+		sp := params
+		sp.Limit++
+		ads, err := m.GetAds(ctx, &sp)
+		if err == nil && len(ads) == 0 && canFallback(&params) {
+			// nothing is found exactly, so misspelled words are searched
+			params.Fuzzy, sp.Fuzzy = true, true
+			ads, err = m.GetAds(ctx, &sp)
+		}
+		var total int64
+		if err == nil {
+			total, err = m.CountAds(ctx, &params)
+		}
+		var facets *model.Facets
+		if err == nil && includes(r, "facets") {
+			facets, err = m.GetFacets(ctx, &params)
+		}
+		var corrections []string
+		if err == nil && params.IsFuzzy() {
+			corrections, err = correctQuery(ctx, m, params.Query)
+		}
+		cancel()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
 			return
 		}
 
-		// marshall list of ads to JSON format
-		adsData, _ := json.Marshal(ads)
+		// marshall page of ads to JSON format
+		page := newAdsPage(r, &params, ads, total)
+		page.Facets = facets
+		page.DidYouMean = corrections
+		adsData, _ := json.Marshal(page)
 
 		// send data as a response
 		w.WriteHeader(http.StatusOK)
@@ -146,6 +282,43 @@ func readMultipleAds(m *model.Model) http.Handler {
 	})
 }
 
+// decodeSearchParams takes parameters of search from request.
+// Parameters with invalid values are ignored.
+func decodeSearchParams(r *http.Request) model.SearchParams {
+	var params model.SearchParams
+	r.ParseForm()
+	decoder := schema.NewDecoder()
+	decoder.IgnoreUnknownKeys(true)
+	decoder.RegisterConverter(time.Time{}, convertTime)
+	decoder.Decode(&params, r.Form)
+	return params
+}
+
+// checkSearchParams checks filters, point of search in radius and sort
+// order of search. If they are invalid, it sends error and returns false.
+func checkSearchParams(w http.ResponseWriter, params *model.SearchParams) bool {
+	if !checkFilters(params) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(apiErrorHandle(checkReq, queryValidErr,
+			errors.New("Client sent contradicting filters"), queryValidMsg))
+		return false
+	}
+	if params.RadiusKm != 0 && (params.RadiusKm < 0 || params.Latitude == nil ||
+		!checkLocation(params.Latitude, params.Longitude)) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(apiErrorHandle(checkReq, locationValidErr,
+			errors.New("Client sent bad point of search"), locationValidMsg))
+		return false
+	}
+	if !checkSort(params.Sort, params.Query != "", params.IsGeo()) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(apiErrorHandle(checkReq, sortValidErr,
+			errors.New("Client sent unknown sort order"), sortValidMsg))
+		return false
+	}
+	return true
+}
+
 // readOneAd handles */ads/{id:[0-9]+} with method GET. Returns one ad with ID provided from URL.
 func readOneAd(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -156,7 +329,9 @@ func readOneAd(m *model.Model) http.Handler {
 		id, _ := strconv.ParseInt(idStr, 10, 64)
 
 		// get ad from DB
-		ad, err := m.GetAd(id)
+		ctx, cancel := dbContext(r)
+		ad, err := m.GetAd(ctx, id)
+		cancel()
 
 		// check if ad exists
 		if ad.ID == -1 {
@@ -182,8 +357,75 @@ func readOneAd(m *model.Model) http.Handler {
 	})
 }
 
+// suggestAds handles */ads/suggest with method GET. Returns JSON array of the most
+// popular titles, cities and subway stations of ads which start with parameter q.
+// Responses can be cached by clients for a minute.
+func suggestAds(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// check if parameters are valid
+		prefix := strings.TrimSpace(r.FormValue("q"))
+		if prefix == "" || utf8.RuneCountInString(prefix) > 80 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, suggestValidErr,
+				errors.New("Client sent bad prefix"), suggestValidMsg))
+			return
+		}
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		if limit <= 0 {
+			limit = 10
+		} else if limit > maxSuggestions {
+			limit = maxSuggestions
+		}
+
+		// get suggestions from DB
+		ctx, cancel := dbContext(r)
+		suggestions, err := m.GetSuggestions(ctx, prefix, limit)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		suggestionsData, _ := json.Marshal(suggestions)
+
+		// send data as a response
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.WriteHeader(http.StatusOK)
+		w.Write(suggestionsData)
+	})
+}
+
+// readCategories handles */categories with method GET. Returns JSON array
+// of root categories; subcategories are nested in field children.
+func readCategories(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// get all categories from DB
+		ctx, cancel := dbContext(r)
+		categories, err := m.GetCategories(ctx)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+
+		// marshall tree of categories to JSON format
+		categoriesData, _ := json.Marshal(categoryTree(categories))
+
+		// send data as a response
+		w.WriteHeader(http.StatusOK)
+		w.Write(categoriesData)
+	})
+}
+
 // readUserWithID handles */users/{id:[0-9]+} with method GET. Returns one user struct with ID provided from URL.
-// if parameter show_ads == true function will return list of ads of such user.
+// if parameter show_ads == true function will return list of ads of such user in order of parameter sort.
 // if such user has no ads then empty JSON array will be returned.
 func readUserWithID(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -196,8 +438,18 @@ func readUserWithID(m *model.Model) http.Handler {
 		// parse parameter
 		showAds := r.FormValue("show_ads")
 		if showAds == "true" {
+			sort := r.FormValue("sort")
+			if !checkSort(sort, false, false) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(checkReq, sortValidErr,
+					errors.New("Client sent unknown sort order"), sortValidMsg))
+				return
+			}
+
 			// get ads of user from DB. If user has no ads, returns empty JSON array
-			ads, err := m.GetAdsOfUser(id)
+			ctx, cancel := dbContext(r)
+			ads, err := m.GetAdsOfUser(ctx, id, sort)
+			cancel()
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err,
@@ -215,7 +467,9 @@ func readUserWithID(m *model.Model) http.Handler {
 		}
 
 		// get user from DB
-		user, err := m.GetUserWithID(id)
+		ctx, cancel := dbContext(r)
+		user, err := m.GetUserWithID(ctx, id)
+		cancel()
 
 		// check if user exists
 		if user.ID == -1 {
@@ -244,6 +498,7 @@ func readUserWithID(m *model.Model) http.Handler {
 // userCreatePage handles */users/new with method POST.
 // Function process incoming parameters to create new user. On success
 // it will return JSON object with ID and reference to created user.
+// Token of verification is sent to email of user.
 func userCreatePage(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
@@ -312,6 +567,7 @@ func userCreatePage(m *model.Model) http.Handler {
 		user.AvatarAddress.Valid = false
 
 		// load images from request if it is possible
+		u := newUnitOfWork(m, r)
 		if isMultipartForm {
 			filenames, err := loadImages(r, m)
 			if err != nil {
@@ -320,13 +576,26 @@ func userCreatePage(m *model.Model) http.Handler {
 					imgCreMsg))
 				return
 			}
+			u.uploaded(filenames)
 			if len(filenames) != 0 {
 				user.AvatarAddress.SetValid(filenames[0])
 			}
 		}
 
-		// add user to database
-		id, err := m.NewUser(&user)
+		// add user to database with token of verification of email,
+		// avatar is removed if it's impossible
+		var id int64
+		var token string
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			var err error
+			if id, err = tx.NewUser(ctx, &user); err != nil {
+				return err
+			}
+			user.ID = id
+			token, err = newUserToken(ctx, tx, id, model.TokenVerifyEmail,
+				requestTimeouts(r).verification)
+			return err
+		})
 
 		// check if user exists
 		if id == -1 {
@@ -347,6 +616,11 @@ func userCreatePage(m *model.Model) http.Handler {
 			return
 		}
 
+		// user can request token again if mail isn't sent
+		if err = sendVerification(r, m, &user, token); err != nil {
+			log.Println("Can't send verification of email", err.Error())
+		}
+
 		// marshall data to JSON format
 		userData, _ := json.Marshal(struct {
 			ID  int64
@@ -363,8 +637,8 @@ func userCreatePage(m *model.Model) http.Handler {
 }
 
 // userLoginPage handles */users/login with method POST. It process incoming
-// password and email to authentificate clent. On succeed it will create session,
-// set cookie to response and return first name, last name, id if user agent is "Android_app".
+// password and email to authentificate clent. On succeed it will create session
+// and set cookie to response. Clients without cookies use */users/token.
 func userLoginPage(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
@@ -408,7 +682,9 @@ func userLoginPage(m *model.Model) http.Handler {
 		}
 
 		// trying to find user with such email in database
-		userFromDB, err := m.GetUserWithEmail(user.Email)
+		ctx, cancel := dbContext(r)
+		userFromDB, err := m.GetUserWithEmail(ctx, user.Email)
+		cancel()
 
 		// check if user exists
 		// empty := model.User{}
@@ -435,84 +711,58 @@ func userLoginPage(m *model.Model) http.Handler {
 			return
 		}
 
-		// android app don't need to set expiration
-		isExpires := true
-		if r.UserAgent() == "Android_app" {
-			isExpires = false
-		}
-
 		// create new session for user
-		sess, err := m.CreateSession(&model.Session{
+		ctx, cancel = smContext(r)
+		sess, err := m.CreateSession(ctx, &model.Session{
 			ID:        userFromDB.ID,
 			Login:     user.Email,
 			UserAgent: r.UserAgent(),
-		}, isExpires)
+			IP:        clientIP(r),
+		}, true)
+		cancel()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, sessCreErr, err, sessCreMsg))
 			return
 		}
 
-		// set cookie for web-browser
-		if isExpires {
-			cookie := http.Cookie{
-				Name:     "session_id",
-				Value:    sess.ID,
-				Expires:  time.Now().Add(24 * time.Hour), // TODO: should be configurable
-				HttpOnly: true,
-			}
-			http.SetCookie(w, &cookie)
-
-		} else {
-			// set cookie  without expiration time
-			cookie := http.Cookie{
-				Name:     "session_id",
-				Value:    sess.ID,
-				HttpOnly: true,
-			}
-			http.SetCookie(w, &cookie)
-
-			// send needed information to android app in JSON format
-			appData, _ := json.Marshal(struct {
-				// Name      string
-				// Value     string `json:"session_id,"`
-				ID        int64  `json:"id,"`
-				FirstName string `json:"first_name,"`
-				LastName  string `json:"last_name,"`
-			}{
-				// Name:      "session_id",
-				// Value:     sess.ID,
-				ID:        userFromDB.ID,
-				FirstName: userFromDB.FirstName,
-				LastName:  userFromDB.LastName,
-			})
-
-			w.Write(appData)
+		// set cookie for web-browser, other clients use */users/token
+		cookie := http.Cookie{
+			Name:     "session_id",
+			Value:    sess.ID,
+			Expires:  time.Now().Add(24 * time.Hour), // TODO: should be configurable
+			HttpOnly: true,
 		}
+		http.SetCookie(w, &cookie)
 	})
 }
 
 // userLogoutPage handles */users/logout with method POST. Middleware that checks
-// cookie is required. Deletes current session and return status OK.
+// cookie is required. Deletes current session from cookie or bearer token
+// and return status OK.
 func userLogoutPage(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := r.Cookie("session_id")
+		tocken, err := sessionTocken(r)
 		if err == http.ErrNoCookie {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
 		// TODO: should handle error
-		err = m.DeleteSession(&model.SessionID{
-			ID: session.Value,
+		ctx, cancel := smContext(r)
+		err = m.DeleteSession(ctx, &model.SessionID{
+			ID: tocken,
 		})
+		cancel()
 		if err != nil {
 			log.Println(err.Error())
 		}
 
 		// delete cookie
-		session.Expires = time.Now().AddDate(0, 0, -1)
-		http.SetCookie(w, session)
+		if session, err := r.Cookie("session_id"); err == nil {
+			session.Expires = time.Now().AddDate(0, 0, -1)
+			http.SetCookie(w, session)
+		}
 
 		w.WriteHeader(http.StatusOK)
 	})
@@ -583,8 +833,9 @@ func userUpdatePage(m *model.Model) http.Handler {
 		user.ID = getIDfromCookie(m, r)
 
 		// check if image address not null and exists
+		u := newUnitOfWork(m, r)
 		if user.AvatarAddress.String != "" {
-			if !m.IsExist(user.AvatarAddress.String) {
+			if !checkImages(r, m, []string{user.AvatarAddress.String}) {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write(apiErrorHandle(checkImage, imgExErr, errors.New("No such image"),
 					imgExMsg))
@@ -592,14 +843,16 @@ func userUpdatePage(m *model.Model) http.Handler {
 			}
 		} else {
 			// get user information from DB
-			userFromDB, err := m.GetUserWithID(user.ID)
+			ctx, cancel := dbContext(r)
+			userFromDB, err := m.GetUserWithID(ctx, user.ID)
+			cancel()
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
 				return
 			}
-			// delete existing avatar image
-			deleteImages([]string{userFromDB.AvatarAddress.String}, m)
+			// delete existing avatar image when user is updated
+			u.replaced([]string{userFromDB.AvatarAddress.String})
 		}
 
 		// load images from request if image address is null and
@@ -612,13 +865,17 @@ func userUpdatePage(m *model.Model) http.Handler {
 					imgCreMsg))
 				return
 			}
+			u.uploaded(filenames)
 			if len(filenames) != 0 {
 				user.AvatarAddress.SetValid(filenames[0])
 			}
 		}
 
 		// update user in DB
-		_, err = m.EditUser(&user)
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			_, err := tx.EditUser(ctx, &user)
+			return err
+		})
 
 		// process error from DB
 		if err != nil {
@@ -639,7 +896,10 @@ func userProfilePage(m *model.Model) http.Handler {
 		w.Header().Set("Content-type", "application/json")
 
 		// get user from DB
-		user, err := m.GetUserWithID(getIDfromCookie(m, r))
+		id := getIDfromCookie(m, r)
+		ctx, cancel := dbContext(r)
+		user, err := m.GetUserWithID(ctx, id)
+		cancel()
 
 		// process error from DB
 		if err != nil {
@@ -658,7 +918,7 @@ func userProfilePage(m *model.Model) http.Handler {
 }
 
 // userDeletePage handles */users/profile with method DELETE. Requires checkCookieMiddleware.
-// Delete current logged user. Returns status OK on succeed.
+// Delete current logged user and all his sessions. Returns status OK on succeed.
 func userDeletePage(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
@@ -666,18 +926,30 @@ func userDeletePage(m *model.Model) http.Handler {
 		id := getIDfromCookie(m, r)
 
 		// remove avatar of user
-		userFromDB, err := m.GetUserWithID(id)
+		ctx, cancel := dbContext(r)
+		userFromDB, err := m.GetUserWithID(ctx, id)
+		cancel()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
 			return
 		}
-		deleteImages([]string{userFromDB.AvatarAddress.String}, m)
+		u := newUnitOfWork(m, r)
+		u.replaced([]string{userFromDB.AvatarAddress.String})
 
-		// TODO removing images of ads which were created by user
-
-		// remove user from DB
-		_, err = m.RemoveUser(id)
+		// remove user from DB with his ads, their images
+		// are removed only if user is removed
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			ads, err := tx.GetAdsOfUser(ctx, id, "")
+			if err != nil {
+				return err
+			}
+			for _, ad := range ads {
+				u.replaced(ad.AdImages)
+			}
+			_, err = tx.RemoveUser(ctx, id)
+			return err
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, removeUserDBErr, err,
@@ -685,15 +957,18 @@ func userDeletePage(m *model.Model) http.Handler {
 			return
 		}
 
-		// delete session
-		session, _ := r.Cookie("session_id")
-		m.DeleteSession(&model.SessionID{
-			ID: session.Value,
-		})
+		// delete all sessions of user
+		ctx, cancel = smContext(r)
+		if err = m.DeleteUserSessions(ctx, id, nil); err != nil {
+			log.Println(err.Error())
+		}
+		cancel()
 
 		// delete cookie
-		session.Expires = time.Now().AddDate(0, 0, -1)
-		http.SetCookie(w, session)
+		if session, err := r.Cookie("session_id"); err == nil {
+			session.Expires = time.Now().AddDate(0, 0, -1)
+			http.SetCookie(w, session)
+		}
 
 		w.WriteHeader(http.StatusOK)
 	})
@@ -752,6 +1027,27 @@ func adCreatePage(m *model.Model) http.Handler {
 			return
 		}
 
+		if !checkLocation(ad.Latitude, ad.Longitude) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, locationValidErr,
+				errors.New("Client sent bad location of ad"), locationValidMsg))
+			return
+		}
+
+		// category of ad must exist
+		exist, err := checkCategory(r, m, &ad)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if !exist {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, categoryIDErr,
+				errors.New("Client sent wrong ID of category"), categoryIDMsg))
+			return
+		}
+
 		// TODO custom validators for UTF-8 with some usual characters
 		// validate incoming data
 		/* _, err = govalidator.ValidateStruct(&ad)
@@ -762,9 +1058,31 @@ func adCreatePage(m *model.Model) http.Handler {
 			return
 		} */
 
-		// prevent client from passing this parameter
-		ad.AdImages = nil
+		// client can pass only images which are uploaded and finalized
+		if ad.AdImages != nil && !checkImages(r, m, ad.AdImages) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkImage, imgExErr, errors.New("No such image"),
+				imgExMsg))
+			return
+		}
+
+		// set id from cookie, only users with verified email can create ads
+		ad.UserID = getIDfromCookie(m, r)
+		verified, err := checkVerified(r, m, ad.UserID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if !verified {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(apiErrorHandle(verifyEmail, emailNotVerifiedErr,
+				errors.New("User with not verified email tried to create ad"), emailNotVerifiedMsg))
+			return
+		}
+
 		// load images from request if it is possible
+		u := newUnitOfWork(m, r)
 		if isMultipartForm {
 			filenames, err := loadImages(r, m)
 			if err != nil {
@@ -773,17 +1091,18 @@ func adCreatePage(m *model.Model) http.Handler {
 					imgCreMsg))
 				return
 			}
-			if len(filenames) != 0 {
-				ad.AdImages = filenames
-			}
+			u.uploaded(filenames)
+			ad.AdImages = append(ad.AdImages, filenames...)
 		}
 
-		// set id from cookie
-		ad.UserID = getIDfromCookie(m, r)
-
-		// add ad to database
+		// add ad to database, images are removed if it's impossible
 		// TODO: should check if ad already exists
-		id, err := m.NewAd(&ad)
+		var id int64
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			var err error
+			id, err = tx.NewAd(ctx, &ad)
+			return err
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, addAdDBErr, err,
@@ -862,6 +1181,27 @@ func adUpdatePage(m *model.Model) http.Handler {
 			return
 		}
 
+		if !checkLocation(ad.Latitude, ad.Longitude) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, locationValidErr,
+				errors.New("Client sent bad location of ad"), locationValidMsg))
+			return
+		}
+
+		// category of ad must exist
+		exist, err := checkCategory(r, m, &ad)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if !exist {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, categoryIDErr,
+				errors.New("Client sent wrong ID of category"), categoryIDMsg))
+			return
+		}
+
 		// TODO custom validators for UTF-8 with some usual characters
 		// validate incoming data
 		/* _, err = govalidator.ValidateStruct(&ad)
@@ -877,7 +1217,9 @@ func adUpdatePage(m *model.Model) http.Handler {
 		ad.ID = id
 
 		// get ad from DB
-		adFromDatabase, err := m.GetAd(id)
+		ctx, cancel := dbContext(r)
+		adFromDatabase, err := m.GetAd(ctx, id)
+		cancel()
 
 		// check if ad exists
 		if adFromDatabase.ID == -1 {
@@ -903,18 +1245,17 @@ func adUpdatePage(m *model.Model) http.Handler {
 		}
 
 		// check if images are not null and exist
+		u := newUnitOfWork(m, r)
 		if ad.AdImages != nil {
-			for _, image := range ad.AdImages {
-				if !m.IsExist(image) {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write(apiErrorHandle(checkImage, imgExErr, errors.New("No such image"),
-						imgExMsg))
-					return
-				}
+			if !checkImages(r, m, ad.AdImages) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(checkImage, imgExErr, errors.New("No such image"),
+					imgExMsg))
+				return
 			}
 		} else {
 			// TODO delete particular images of ad
-			deleteImages(adFromDatabase.AdImages, m)
+			u.replaced(adFromDatabase.AdImages)
 		}
 
 		// load images from request if existing images array is null and
@@ -927,6 +1268,7 @@ func adUpdatePage(m *model.Model) http.Handler {
 					imgCreMsg))
 				return
 			}
+			u.uploaded(filenames)
 			if len(filenames) != 0 {
 				for _, img := range filenames {
 					ad.AdImages = append(ad.AdImages, img)
@@ -934,8 +1276,11 @@ func adUpdatePage(m *model.Model) http.Handler {
 			}
 		}
 
-		// update ad
-		_, err = m.EditAd(&ad)
+		// update ad, new images are removed if it's impossible
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			_, err := tx.EditAd(ctx, &ad)
+			return err
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, updateAdDBErr, err,
@@ -960,7 +1305,9 @@ func adDeletePage(m *model.Model) http.Handler {
 
 		// get owner from cookie and ad with such id
 		ownerIDfromCookie := getIDfromCookie(m, r)
-		adFromDatabase, err := m.GetAd(id)
+		ctx, cancel := dbContext(r)
+		adFromDatabase, err := m.GetAd(ctx, id)
+		cancel()
 
 		// check if ad exists
 		if adFromDatabase.ID == -1 {
@@ -985,11 +1332,13 @@ func adDeletePage(m *model.Model) http.Handler {
 			return
 		}
 
-		// delete images of such ad
-		deleteImages(adFromDatabase.AdImages, m)
-
-		// remove ad from DB
-		_, err = m.RemoveAd(id)
+		// remove ad from DB, its images are removed only if ad is removed
+		u := newUnitOfWork(m, r)
+		u.replaced(adFromDatabase.AdImages)
+		err = u.commit(func(ctx context.Context, tx model.DB) error {
+			_, err := tx.RemoveAd(ctx, id)
+			return err
+		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, removeAdDBErr, err,
@@ -1001,27 +1350,163 @@ func adDeletePage(m *model.Model) http.Handler {
 	})
 }
 
-// images handling is implemented by aws s3 now
 // sendImage handles */images/{filename} with method GET.
-// It returns image with such filename if it's exists.
+// It returns image with such filename if it's exists. Image is streamed
+// from image manager; Range and conditional requests are supported.
 func sendImage(m *model.Model) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		filename, _ := mux.Vars(r)["filename"]
-		if !m.IsExist("/images/" + filename) {
+		ctx, cancel := imContext(r)
+		defer cancel()
+
+		img, err := openImage(ctx, m, "/images/"+filename)
+		if err == model.ErrNoImage {
+			w.Header().Set("Content-type", "application/json")
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write(apiErrorHandle(checkImage, noImgErr, errors.New("No such image"),
-				noImgMsg))
+			w.Write(apiErrorHandle(checkImage, noImgErr, err, noImgMsg))
 			return
 		}
-
-		err := m.DownloadImage("/images/" + filename)
 		if err != nil {
+			w.Header().Set("Content-type", "application/json")
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(apiErrorHandle(connectProvider, "DownloadImgError", err,
 				"Can't access S3"))
 			return
 		}
-		http.ServeFile(w, r, "./images/"+filename)
-		os.Remove("./images/" + filename)
+		defer img.Close()
+
+		// content type is set to prevent sniffing of content
+		w.Header().Set("Content-Type", img.contentType)
+		http.ServeContent(w, r, filename, img.modTime, img)
+	})
+}
+
+// uploadCreatePage handles */uploads/new with method POST. Requires checkCookieMiddleware.
+// It returns ID of upload and URL where client has to upload image with method PUT
+// before expiration time. Uploaded image must be finalized to be used.
+func uploadCreatePage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// upload belongs to user, it's checked on finalizing
+		randBuf := make([]byte, 16)
+		rand.Read(randBuf)
+		id := strconv.FormatInt(getIDfromCookie(m, r), 10) + "-" + hex.EncodeToString(randBuf)
+
+		expiration := requestTimeouts(r).upload
+		ctx, cancel := imContext(r)
+		url, err := m.PresignUpload(ctx, uploadKey(id), expiration)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, uploadCreErr, err, uploadCreMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		uploadData, _ := json.Marshal(struct {
+			ID      string
+			URL     string
+			Method  string
+			Expires time.Time
+			Ref     string
+		}{
+			ID:      id,
+			URL:     url,
+			Method:  "PUT",
+			Expires: time.Now().Add(expiration),
+			Ref:     "/uploads/" + id + "/finalize",
+		})
+
+		// send response
+		w.WriteHeader(http.StatusCreated)
+		w.Write(uploadData)
+	})
+}
+
+// uploadFinalizePage handles */uploads/{id}/finalize with method POST. Requires
+// checkCookieMiddleware. It checks uploaded image, converts it like images uploaded
+// with multipart/form-data and returns address of image which can be attached to ad
+// or user. Uploaded file is removed.
+func uploadFinalizePage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// check owner of upload
+		id, _ := mux.Vars(r)["id"]
+		owner := strconv.FormatInt(getIDfromCookie(m, r), 10)
+		if !strings.HasPrefix(id, owner+"-") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(apiErrorHandle(onlyYourUpload, onlyYourUploadErr,
+				errors.New("Client tried to finalize upload of other user"), onlyYourUploadMsg))
+			return
+		}
+
+		// read uploaded file
+		ctx, cancel := imContext(r)
+		data, err := readUpload(ctx, m, uploadKey(id))
+		cancel()
+		switch {
+		case err == model.ErrNoImage:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkImage, noUploadErr, err, noUploadMsg))
+			return
+		case err == errImageSize:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkImage, imgSizeErr, err, imgSizeMsg))
+			deleteImages(r, []string{uploadKey(id)}, m)
+			return
+		case err != nil:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, "DownloadImgError", err, imgStorageMsg))
+			return
+		}
+
+		// check and convert image
+		filename, encoded, err := convertImage(bytes.NewReader(data))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkImage, imgCreErr, err, imgCreMsg))
+			deleteImages(r, []string{uploadKey(id)}, m)
+			return
+		}
+
+		ctx, cancel = imContext(r)
+		addr, err := m.UploadImage(ctx, "/images/"+filename+".png", encoded)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, imgCreErr, err, imgStorageMsg))
+			return
+		}
+		deleteImages(r, []string{uploadKey(id)}, m)
+
+		// marshall data to JSON format
+		imageData, _ := json.Marshal(struct {
+			Image string
+		}{
+			Image: addr,
+		})
+
+		// send response
+		w.WriteHeader(http.StatusCreated)
+		w.Write(imageData)
 	})
 }
+
+// storageUpload handles */storage/* with method PUT. It accepts uploads by
+// URLs from uploadCreatePage if image manager doesn't have own storage for it
+// (i.e. local filesystem). Otherwise it returns status 404.
+func storageUpload(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storage, ok := m.IM.(interface{ UploadHandler() http.Handler })
+		if !ok {
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(apiErrorHandle(checkReq, uploadStorageErr,
+				errors.New("Client tried to upload to API server"), uploadStorageMsg))
+			return
+		}
+		storage.UploadHandler().ServeHTTP(w, r)
+	})
+}
\ No newline at end of file
@@ -66,10 +66,10 @@ const (
 	removeAdDBMsg           = "Can't remove ad"
 	requiredCookie          = "You have to be authentificated to access this address"
 	noCookieError           = "NoCookieError"
-	noCookieMsg             = "Request doesn't have cookie"
+	noCookieMsg             = "Request doesn't have cookie or bearer token"
 	badCookie               = "You must have valid cookie to access this address"
 	badCookieErr            = "BadCookieError"
-	badCookieMsg            = "Cookie didn't passed validation"
+	badCookieMsg            = "Cookie or bearer token didn't passed validation"
 	checkImage              = "Check your image"
 	imgCreErr               = "ImageCreateError"
 	imgCreMsg               = "Image must be PNG or JPEG format"
@@ -77,6 +77,74 @@ const (
 	noImgMsg                = "There is no image with such name"
 	imgExErr                = "ImageNoExistError"
 	imgExMsg                = "Updating requires providing existing image or null if you want to delete it or upload with multipart/form-data"
+	uploadCreErr            = "UploadCreateError"
+	uploadCreMsg            = "Can't create URL for uploading"
+	onlyYourUpload          = "You can finalize only uploads that created by yourself"
+	onlyYourUploadErr       = "ForeignUploadError"
+	onlyYourUploadMsg       = "Trying to finalize upload of other user"
+	noUploadErr             = "NoSuchUploadError"
+	noUploadMsg             = "Image wasn't uploaded by such URL or upload is already finalized"
+	imgSizeErr              = "ImageSizeError"
+	imgSizeMsg              = "Image is too big"
+	imgStorageMsg           = "Can't access storage of images"
+	uploadStorageErr        = "UploadStorageError"
+	uploadStorageMsg        = "Storage of images doesn't accept uploads to API server"
+	queryValidErr           = "QueryValidError"
+	queryValidMsg           = "Minimal price and date of creation mustn't be greater than maximal ones"
+	sortValidErr            = "SortValidError"
+	sortValidMsg            = "Sort must be newest, oldest, price_asc, price_desc, relevance (only with query) or distance (only with radius)"
+	cursorValidErr          = "CursorValidError"
+	cursorValidMsg          = "Cursor must be taken from previous page and can be used only with order by time of creation"
+	locationValidErr        = "LocationValidError"
+	locationValidMsg        = "Latitude must be from -90 to 90 and longitude from -180 to 180; both of them are required"
+	categoryIDErr           = "NoSuchCategoryError"
+	categoryIDMsg           = "There is no category with such ID"
+	requiredInfoSearchMsg   = "Name of search is required and must be up to 80 characters"
+	tooManySearchesErr      = "TooManySearchesError"
+	tooManySearchesMsg      = "User can't save more than 20 searches"
+	searchIDErr             = "NoSuchSearchError"
+	searchIDMsg             = "There is no saved search with such ID"
+	addSearchDBErr          = "SaveSearchError"
+	addSearchDBMsg          = "Can't save search"
+	removeSearchDBErr       = "RemoveSearchError"
+	removeSearchDBMsg       = "Can't remove saved search"
+	suggestValidErr         = "SuggestValidError"
+	suggestValidMsg         = "Parameter q is required and must be up to 80 characters"
+	verifyEmail             = "Verify your email by token sent to it"
+	emailNotVerifiedErr     = "EmailNotVerifiedError"
+	emailNotVerifiedMsg     = "Email of user must be verified to create ads"
+	enterValidToken         = "Use the last token sent to your email or request a new one"
+	requiredTokenMsg        = "Parameter token is required"
+	badTokenErr             = "BadTokenError"
+	badTokenMsg             = "Token is wrong, expired or already used"
+	alreadyVerifiedErr      = "EmailAlreadyVerifiedError"
+	alreadyVerifiedMsg      = "Email of user is already verified"
+	sendMailErr             = "SendMailError"
+	sendMailMsg             = "Can't send mail"
+	enterRequiredInfoForgot = "Enter required information (email)"
+	requiredEmailMsg        = "Parameter email is required"
+	enterRequiredInfoReset  = "Enter required information (token, password)"
+	requiredinfoMsgReset    = "Need more information to reset password"
+	validRequiredPassword   = "Password must be printable ASCII"
+	sessDelErr              = "SessionDeleteError"
+	sessDelMsg              = "Can't delete sessions"
+	enterRequiredInfoChange = "Enter required information (password, new_password)"
+	requiredinfoMsgChange   = "Need more information to change password"
+	enterRequiredInfoEmail  = "Enter required information (email, password)"
+	requiredinfoMsgEmail    = "Need more information to change email"
+	validRequiredEmail      = "Email must be valid"
+	enterValidPassword      = "Must enter current password"
+	badPasswordMsg          = "Invalid password"
+	sessIDErr               = "NoSuchSessionError"
+	sessIDMsg               = "There is no session with such ID"
+	getSessErr              = "GetSessionsError"
+	getSessMsg              = "Can't get sessions"
+	enterGrantType          = "Grant type must be password or refresh_token"
+	grantTypeErr            = "GrantTypeError"
+	grantTypeMsg            = "Unsupported grant type"
+	enterRequiredInfoToken  = "Enter required information (refresh_token)"
+	requiredinfoMsgToken    = "Need more information to refresh token"
+	enterValidRefresh       = "Use the last refresh token or login again"
 )
 
 // apiError is a struct that represents api error type
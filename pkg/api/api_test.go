@@ -8,6 +8,8 @@ package api_test
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
@@ -15,17 +17,25 @@ import (
 	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"bmstu.codes/developers34/SBWeb/pkg/alerts"
 	"bmstu.codes/developers34/SBWeb/pkg/api"
 	"bmstu.codes/developers34/SBWeb/pkg/api/mock_model"
+	"bmstu.codes/developers34/SBWeb/pkg/mailer"
+	"bmstu.codes/developers34/SBWeb/pkg/memdb"
+	"bmstu.codes/developers34/SBWeb/pkg/sessionmanager"
 
 	"github.com/golang/mock/gomock"
 	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3/zero"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 )
@@ -48,6 +58,18 @@ func TestStartWithBadConfig(t *testing.T) {
 	if err == http.ErrServerClosed {
 		t.Error("Expected other error")
 	}
+
+	_, ch = api.StartServer(api.Config{
+		Address:      "localhost:54000",
+		ReadTimeout:  "10s",
+		WriteTimeout: "10s",
+		IdleTimeout:  "10s",
+		DBTimeout:    "five seconds",
+	}, nil)
+	err = <-ch
+	if err == http.ErrServerClosed {
+		t.Error("Expected other error")
+	}
 }
 
 var adsInDB = map[int64]*model.AdItem{
@@ -144,14 +166,6 @@ type createUserResp struct {
 	Ref string
 }
 
-// loginUserResp is a struct that returned to
-// android app in case of succeed login.
-type loginUserResp struct {
-	ID        int64  `json:"id,"`
-	FirstName string `json:"first_name,"`
-	LastName  string `json:"last_name,"`
-}
-
 // mockDataDB is a struct that contains information to
 // mock functions of interface model.DB.
 type mockDataDB struct {
@@ -222,13 +236,13 @@ type testCase struct {
 	isCheckSession       bool
 	isSecondCheckSession bool
 	isDeleteSession      bool
-	isPrepareCheckConnSM bool
+	isDeleteUserSessions bool
 
 	// flags for im
-	isExist    bool
-	isDownload bool
-	isUpload   bool
-	isDelete   bool
+	isExist  bool
+	isRead   bool
+	isUpload bool
+	isDelete bool
 
 	// expect flags
 	isPrepareDB bool
@@ -248,7 +262,6 @@ type testCase struct {
 	expectedAd          *model.AdItem
 	expectedAds         []*model.AdItem
 	expectedUserCreate  *createUserResp
-	expectedLogin       *loginUserResp
 	expectedCookieValue string
 	expectedAdCreate    *createUserResp
 }
@@ -607,11 +620,10 @@ var testCases = []testCase{
 		expectedStatusCode: http.StatusInternalServerError,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
-		isPrepareDB:          true,
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
+		isPrepareSM:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=123456"))
@@ -627,6 +639,7 @@ var testCases = []testCase{
 				ID:        17,
 				Login:     "pet@animal.com",
 				UserAgent: "Go-http-client/1.1",
+				IP:        "127.0.0.1",
 			},
 			inputExpires:    true,
 			outputSessionID: &model.SessionID{ID: "id"},
@@ -635,11 +648,10 @@ var testCases = []testCase{
 		expectedCookieValue: "id",
 	},
 	{
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
-		isPrepareDB:          true,
-		isPrepareCheckConnSM: true,
-		isPrepareSM:          true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
+		isPrepareSM:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=123456"))
@@ -656,22 +668,17 @@ var testCases = []testCase{
 				ID:        17,
 				Login:     "pet@animal.com",
 				UserAgent: "Android_app",
+				IP:        "127.0.0.1",
 			},
-			inputExpires:    false,
+			inputExpires:    true,
 			outputSessionID: &model.SessionID{ID: "id"},
 		},
-		expectedLogin: &loginUserResp{
-			ID:        17,
-			FirstName: "Ivan",
-			LastName:  "Ivanov",
-		},
 		expectedStatusCode:  200,
 		expectedCookieValue: "id",
 	},
 	{
-		isGetUserWithEmail:   true,
-		isPrepareCheckConnSM: true,
-		isCreateSession:      true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("%email=pet@animal.com&password=123456"))
@@ -680,9 +687,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isPrepareCheckConnSM: true,
-		isCreateSession:      true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.cv&password=123456"))
@@ -691,9 +697,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isPrepareCheckConnSM: true,
-		isCreateSession:      true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("script=vvvv&email=pet@animal.com&password=123456"))
@@ -702,9 +707,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareCheckConnSM: true,
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password="))
@@ -713,10 +717,9 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
-		isPrepareCheckConnSM: true,
-		isPrepareDB:          true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=123456"))
@@ -730,10 +733,9 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
-		isPrepareCheckConnSM: true,
-		isPrepareDB:          true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=123456"))
@@ -747,10 +749,9 @@ var testCases = []testCase{
 		expectedStatusCode: 500,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isPrepareCheckConnSM: true,
-		isCreateSession:      true,
-		isPrepareDB:          true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=12456"))
@@ -764,11 +765,10 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isGetUserWithEmail:   true,
-		isCreateSession:      true,
-		isPrepareCheckConnSM: true,
-		isPrepareDB:          true,
-		isPrepareSM:          true,
+		isGetUserWithEmail: true,
+		isCreateSession:    true,
+		isPrepareDB:        true,
+		isPrepareSM:        true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/login",
 				strings.NewReader("email=pet@animal.com&password=123456"))
@@ -784,6 +784,7 @@ var testCases = []testCase{
 				ID:        17,
 				Login:     "pet@animal.com",
 				UserAgent: "Go-http-client/1.1",
+				IP:        "127.0.0.1",
 			},
 			inputExpires:    true,
 			outputSessionID: &model.SessionID{},
@@ -792,9 +793,8 @@ var testCases = []testCase{
 		expectedStatusCode: 500,
 	},
 	{
-		isDeleteSession:      true,
-		isPrepareCheckConnSM: true,
-		isPrepareSM:          true,
+		isDeleteSession: true,
+		isPrepareSM:     true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/logout", nil)
 			r.Header.Set("Cookie", "session_id=123abc")
@@ -807,8 +807,7 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isPrepareCheckConnSM: true,
-		isDeleteSession:      true,
+		isDeleteSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/logout", nil)
 			return r
@@ -816,9 +815,8 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isPrepareCheckConnSM: true,
-		isDeleteSession:      true,
-		isPrepareSM:          true,
+		isDeleteSession: true,
+		isPrepareSM:     true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/logout", nil)
 			r.Header.Set("Cookie", "session_id=123abc")
@@ -831,7 +829,6 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		isEditUser:           true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
@@ -868,9 +865,8 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isCheckSession:       true,
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("%first_name=Alex&last_name=Ivanov"))
@@ -889,9 +885,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isCheckSession:       true,
-		isPrepareCheckConnSM: true,
-		isPrepareSM:          true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("script=bbb&first_name=Alex&last_name=Ivanov"))
@@ -910,9 +905,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isCheckSession:       true,
-		isPrepareCheckConnSM: true,
-		isPrepareSM:          true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("first_name=&last_name=Ivanov"))
@@ -931,9 +925,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
-		isPrepareSM:          true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("first_name=efv45&last_name=Ivanov"))
@@ -952,9 +945,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isCheckSession:       true,
-		isPrepareCheckConnSM: true,
-		isPrepareSM:          true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("first_name=Alex&last_name=Ivanov&tel_number=dwdww"))
@@ -974,7 +966,6 @@ var testCases = []testCase{
 	},
 	{
 		isEditUser:           true,
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
 		isPrepareDB:          true,
@@ -1010,7 +1001,6 @@ var testCases = []testCase{
 		expectedStatusCode: 500,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("first_name=Alex&last_name=Ivanov"))
@@ -1019,9 +1009,8 @@ var testCases = []testCase{
 		expectedStatusCode: 401,
 	},
 	{
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
-		isPrepareSM:          true,
+		isCheckSession: true,
+		isPrepareSM:    true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/users/profile",
 				strings.NewReader("first_name=Alex&last_name=Ivanov"))
@@ -1036,7 +1025,6 @@ var testCases = []testCase{
 		expectedStatusCode: 401,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		isEditUser:           true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
@@ -1088,7 +1076,6 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
 		isPrepareSM:          true,
@@ -1115,7 +1102,6 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
 		isPrepareSM:          true,
@@ -1143,7 +1129,6 @@ var testCases = []testCase{
 		expectedStatusCode: 500,
 	},
 	{
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isCheckSession:       true,
 		isPrepareDB:          true,
@@ -1192,7 +1177,6 @@ var testCases = []testCase{
 		isGetUserWithID:      true,
 		isPrepareDB:          true,
 		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1221,7 +1205,6 @@ var testCases = []testCase{
 		isGetUserWithID:      true,
 		isPrepareDB:          true,
 		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1246,10 +1229,9 @@ var testCases = []testCase{
 		expectedStatusCode: 500,
 	},
 	{
-		isDeleteSession:      true,
+		isDeleteUserSessions: true,
 		isRemoveUser:         true,
 		isPrepareDB:          true,
-		isPrepareCheckConnSM: true,
 		isPrepareSM:          true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
@@ -1283,7 +1265,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isCheckSession:       true,
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isGetUserWithIDImg:   true,
 		request: func() *http.Request {
@@ -1314,7 +1295,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isCheckSession:       true,
-		isPrepareCheckConnSM: true,
 		isSecondCheckSession: true,
 		isGetUserWithID:      true,
 		request: func() *http.Request {
@@ -1342,7 +1322,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isNewAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1369,9 +1348,8 @@ var testCases = []testCase{
 		expectedAdCreate:   &createUserResp{ID: 15, Ref: "/ads/15"},
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/new",
 				strings.NewReader("t%itle=Building&city=Moscow&description_ad=Awesome"))
@@ -1390,9 +1368,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/new",
 				strings.NewReader("title=Building&city=Moscow&description_ad=Awesome&script=bad"))
@@ -1411,9 +1388,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/new",
 				strings.NewReader("title=Building&city=Moscow"))
@@ -1435,7 +1411,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isNewAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1464,7 +1439,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isNewAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		isUpload:             true,
@@ -1513,8 +1487,8 @@ var testCases = []testCase{
 	},
 	{
 		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
+		isSecondCheckSession: true,
 		request: func() *http.Request {
 			path := os.Getenv("CI_PROJECT_DIR") + "/docs/curlTest.md"
 			file, err := os.Open(path)
@@ -1554,7 +1528,6 @@ var testCases = []testCase{
 		isPrepareSM:          true,
 		isEditAd:             true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1582,9 +1555,8 @@ var testCases = []testCase{
 		expectedStatusCode: 200,
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/edit/15",
 				strings.NewReader("ti%tle=Building&city=Moscow&description_ad=Awesome"))
@@ -1603,9 +1575,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/edit/15",
 				strings.NewReader("script=;DROP TABLE;&title=Building&city=Moscow&description_ad=Awesome"))
@@ -1624,9 +1595,8 @@ var testCases = []testCase{
 		expectedStatusCode: 400,
 	},
 	{
-		isPrepareSM:          true,
-		isPrepareCheckConnSM: true,
-		isCheckSession:       true,
+		isPrepareSM:    true,
+		isCheckSession: true,
 		request: func() *http.Request {
 			r, _ := http.NewRequest("POST", domain+"/ads/edit/15",
 				strings.NewReader("city=Moscow&description_ad=Awesome"))
@@ -1648,7 +1618,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1677,7 +1646,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1706,7 +1674,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1736,7 +1703,6 @@ var testCases = []testCase{
 		isPrepareSM:          true,
 		isEditAd:             true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1769,7 +1735,6 @@ var testCases = []testCase{
 		isPrepareSM:          true,
 		isEditAd:             true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		isUpload:             true,
@@ -1821,7 +1786,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		isExist:              true,
@@ -1855,7 +1819,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1903,7 +1866,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		isRemoveAd:           true,
@@ -1934,7 +1896,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1962,7 +1923,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -1990,7 +1950,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		request: func() *http.Request {
@@ -2018,7 +1977,6 @@ var testCases = []testCase{
 		isPrepareDB:          true,
 		isPrepareSM:          true,
 		isGetAd:              true,
-		isPrepareCheckConnSM: true,
 		isCheckSession:       true,
 		isSecondCheckSession: true,
 		isRemoveAd:           true,
@@ -2080,13 +2038,13 @@ func TestInterfaceOfAPI(t *testing.T) {
 
 			// need GetAd
 			if tCase.isGetAd && tCase.isPrepareDB {
-				mockDB.EXPECT().GetAd(tCase.db.inputID).
+				mockDB.EXPECT().GetAd(gomock.Any(), tCase.db.inputID).
 					Return(tCase.db.outputAd, tCase.db.outputError)
 			}
 
 			// need GetAds
 			if tCase.isGetAds && tCase.isPrepareDB {
-				mockDB.EXPECT().GetAds(&model.SearchParams{
+				mockDB.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
 					Limit:  tCase.db.inputLimit,
 					Offset: tCase.db.inputOffset,
 				}).Return(tCase.db.outputAds, tCase.db.outputError)
@@ -2094,58 +2052,73 @@ func TestInterfaceOfAPI(t *testing.T) {
 
 			// need GetUserWithID
 			if tCase.isGetUserWithID && tCase.isPrepareDB {
-				mockDB.EXPECT().GetUserWithID(tCase.db.inputID).
+				mockDB.EXPECT().GetUserWithID(gomock.Any(), tCase.db.inputID).
 					Return(tCase.db.outputUser, tCase.db.outputError)
 			}
 
 			// need GetAdsOfUser
 			if tCase.isGetAdsOfUser && tCase.isPrepareDB {
-				mockDB.EXPECT().GetAdsOfUser(tCase.db.inputID).
+				mockDB.EXPECT().GetAdsOfUser(gomock.Any(), tCase.db.inputID, "").
 					Return(tCase.db.outputAds, tCase.db.outputError)
 			}
 
 			// need NewUser
 			if tCase.isNewUser && tCase.isPrepareDB {
-				mockDB.EXPECT().NewUser(gomock.Any()).
+				mockDB.EXPECT().NewUser(gomock.Any(), gomock.Any()).
 					Return(tCase.db.outputID, tCase.db.outputError)
 			}
 
+			// token of verification is sent to created user
+			mockMailer := mock_model.NewMockMailer(ctrl)
+			if tCase.isNewUser && tCase.isPrepareDB && tCase.db.outputError == nil {
+				mockDB.EXPECT().NewToken(gomock.Any(), gomock.Any()).Return(nil)
+				mockMailer.EXPECT().SendMail(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
 			// need GetUserWithEmail
 			if tCase.isGetUserWithEmail && tCase.isPrepareDB {
-				mockDB.EXPECT().GetUserWithEmail(tCase.db.inputEmail).
+				mockDB.EXPECT().GetUserWithEmail(gomock.Any(), tCase.db.inputEmail).
 					Return(tCase.db.outputUser, tCase.db.outputError)
 			}
 
 			// need EditUser
 			if tCase.isEditUser && tCase.isPrepareDB {
 				if tCase.db.inputUser == nil {
-					mockDB.EXPECT().EditUser(gomock.Not(nil)).
+					mockDB.EXPECT().EditUser(gomock.Any(), gomock.Not(nil)).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				} else {
-					mockDB.EXPECT().EditUser(tCase.db.inputUser).
+					mockDB.EXPECT().EditUser(gomock.Any(), tCase.db.inputUser).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				}
 			}
 
-			// need DeleteUser
+			// need DeleteUser, ads of user are read before
 			if tCase.isRemoveUser && tCase.isPrepareDB {
-				mockDB.EXPECT().RemoveUser(tCase.db.inputID).
+				mockDB.EXPECT().GetAdsOfUser(gomock.Any(), tCase.db.inputID, "").
+					Return([]*model.AdItem{}, nil)
+				mockDB.EXPECT().RemoveUser(gomock.Any(), tCase.db.inputID).
 					Return(tCase.db.outputID, tCase.db.outputError)
 			}
 
 			// need for image processing
 			if tCase.isGetUserWithIDImg {
-				mockDB.EXPECT().GetUserWithID(tCase.db.inputIDimg).
+				mockDB.EXPECT().GetUserWithID(gomock.Any(), tCase.db.inputIDimg).
 					Return(tCase.db.outputUserImg, tCase.db.outputErrorImg)
 			}
 
+			// only user with verified email can create ad
+			if tCase.request.URL.Path == "/ads/new" {
+				mockDB.EXPECT().GetUserWithID(gomock.Any(), gomock.Any()).
+					Return(&model.User{ID: 12, EmailVerified: true}, nil).AnyTimes()
+			}
+
 			// need NewAd
 			if tCase.isNewAd && tCase.isPrepareDB {
 				if strings.Contains(tCase.request.Header.Get("Content-Type"), "multipart") {
-					mockDB.EXPECT().NewAd(gomock.Any()).
+					mockDB.EXPECT().NewAd(gomock.Any(), gomock.Any()).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				} else {
-					mockDB.EXPECT().NewAd(tCase.db.inputAd).
+					mockDB.EXPECT().NewAd(gomock.Any(), tCase.db.inputAd).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				}
 			}
@@ -2153,13 +2126,13 @@ func TestInterfaceOfAPI(t *testing.T) {
 			// need EditAd
 			if tCase.isEditAd && tCase.isPrepareDB {
 				if tCase.db.outputErrorSec != nil {
-					mockDB.EXPECT().EditAd(tCase.db.inputAd).
+					mockDB.EXPECT().EditAd(gomock.Any(), tCase.db.inputAd).
 						Return(tCase.db.outputID, tCase.db.outputErrorSec)
 				} else if strings.Contains(tCase.request.Header.Get("Content-Type"), "multipart") {
-					mockDB.EXPECT().EditAd(gomock.Any()).
+					mockDB.EXPECT().EditAd(gomock.Any(), gomock.Any()).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				} else {
-					mockDB.EXPECT().EditAd(tCase.db.inputAd).
+					mockDB.EXPECT().EditAd(gomock.Any(), tCase.db.inputAd).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				}
 			}
@@ -2167,67 +2140,75 @@ func TestInterfaceOfAPI(t *testing.T) {
 			// need RemoveAd
 			if tCase.isRemoveAd && tCase.isPrepareDB {
 				if tCase.db.outputErrorSec != nil {
-					mockDB.EXPECT().RemoveAd(tCase.db.inputID).
+					mockDB.EXPECT().RemoveAd(gomock.Any(), tCase.db.inputID).
 						Return(tCase.db.outputID, tCase.db.outputErrorSec)
 				} else {
-					mockDB.EXPECT().RemoveAd(tCase.db.inputID).
+					mockDB.EXPECT().RemoveAd(gomock.Any(), tCase.db.inputID).
 						Return(tCase.db.outputID, tCase.db.outputError)
 				}
 			}
 
+			// transaction runs on the same mock
+			mockDB.EXPECT().WithTx(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, fn func(model.DB) error) error {
+					return fn(mockDB)
+				}).AnyTimes()
+
 			mockSM := mock_model.NewMockSM(ctrl)
 
 			// need CreateSession
 			if tCase.isCreateSession && tCase.isPrepareSM {
-				mockSM.EXPECT().CreateSession(tCase.sm.inputSession, tCase.sm.inputExpires).
+				mockSM.EXPECT().CreateSession(gomock.Any(), tCase.sm.inputSession, tCase.sm.inputExpires).
 					Return(tCase.sm.outputSessionID, tCase.sm.outputError)
 			}
 
 			// need CheckSession
 			if tCase.isCheckSession && tCase.isPrepareSM {
-				mockSM.EXPECT().CheckSession(tCase.sm.inputSessionID).
+				mockSM.EXPECT().CheckSession(gomock.Any(), tCase.sm.inputSessionID).
 					Return(tCase.sm.outputSession, tCase.sm.outputError)
 			}
 
 			// need CheckSession second
 			if tCase.isSecondCheckSession && tCase.isPrepareSM {
-				mockSM.EXPECT().CheckSession(tCase.sm.inputSessionID).
+				mockSM.EXPECT().CheckSession(gomock.Any(), tCase.sm.inputSessionID).
 					Return(tCase.sm.outputSession, tCase.sm.outputError)
 			}
 
 			// need DeleteSession
 			if tCase.isDeleteSession && tCase.isPrepareSM {
-				mockSM.EXPECT().DeleteSession(tCase.sm.inputSessionID).
+				mockSM.EXPECT().DeleteSession(gomock.Any(), tCase.sm.inputSessionID).
 					Return(tCase.sm.outputError)
 			}
 
-			if tCase.isPrepareCheckConnSM {
-				mockSM.EXPECT().IsConnected().Return(true)
+			// need DeleteUserSessions
+			if tCase.isDeleteUserSessions && tCase.isPrepareSM {
+				mockSM.EXPECT().DeleteUserSessions(gomock.Any(), tCase.sm.outputSession.ID, nil).
+					Return(tCase.sm.outputError)
 			}
 
 			mockIM := mock_model.NewMockIM(ctrl)
 
 			if tCase.im != nil && tCase.isExist {
-				mockIM.EXPECT().IsExist(tCase.im.inputKey).
+				mockIM.EXPECT().IsExist(gomock.Any(), tCase.im.inputKey).
 					Return(tCase.im.outputBool).AnyTimes()
 			}
 
 			if tCase.im != nil && tCase.isUpload {
-				mockIM.EXPECT().UploadImage(gomock.Any(), gomock.Any()).
+				mockIM.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(tCase.im.outputLocation, tCase.im.outputError).AnyTimes()
 			}
 
 			if tCase.im != nil && tCase.isDelete {
-				mockIM.EXPECT().DeleteImage(gomock.Any()).
+				mockIM.EXPECT().DeleteImage(gomock.Any(), gomock.Any()).
 					Return(tCase.im.outputError).AnyTimes()
 			}
 
-			if tCase.im != nil && tCase.isDownload {
-				mockIM.EXPECT().DownloadImage(gomock.Any()).
-					Return(tCase.im.outputError)
+			if tCase.im != nil && tCase.isRead {
+				mockIM.EXPECT().ReadImage(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, tCase.im.outputError)
 			}
 
-			tModel := model.New(mockDB, mockSM, mockIM)
+			tModel := model.New(mockDB, mockSM, mockIM, mockMailer)
 
 			srv, ch := api.StartServer(api.Config{
 				Address:      "localhost:49123",
@@ -2284,11 +2265,6 @@ func TestInterfaceOfAPI(t *testing.T) {
 				data, _ = json.Marshal(tCase.expectedUserCreate)
 			}
 
-			// if response is login from android app
-			if result.StatusCode == http.StatusOK && tCase.expectedLogin != nil {
-				data, _ = json.Marshal(tCase.expectedLogin)
-			}
-
 			// if response is login
 			if result.StatusCode == http.StatusOK && tCase.expectedCookieValue != "" {
 				cookies := result.Cookies()
@@ -2329,10 +2305,7 @@ func TestMiddleware(t *testing.T) {
 	sm := mock_model.NewMockSM(ctrl)
 	im := mock_model.NewMockIM(ctrl)
 
-	sm.EXPECT().IsConnected().Return(false)
-	sm.EXPECT().TryReconnect().Return(nil)
-
-	m := model.New(db, sm, im)
+	m := model.New(db, sm, im, nil)
 
 	srv, ch := api.StartServer(api.Config{
 		Address:      "localhost:49123",
@@ -2343,20 +2316,99 @@ func TestMiddleware(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 50) // time to start the server
 
+	// session manager mustn't be touched without cookie
 	res, _ := http.Post(domain+"/users/logout", "application/x-www-form-urlencoded; charset=utf-8", nil)
 	if res.StatusCode != 200 {
 		t.Error("Expected status 200")
 	}
 
+	res, _ = http.Get(domain + "/users/profile")
+	if res.StatusCode != 401 {
+		t.Error("Expected status 401")
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestTimeouts(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_model.NewMockDB(ctrl)
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	// DB has deadline and IM has not
+	db.EXPECT().GetAd(gomock.Any(), int64(1)).DoAndReturn(
+		func(ctx context.Context, id int64) (*model.AdItem, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected deadline of DB context")
+			}
+			return &model.AdItem{ID: -1}, sql.ErrNoRows
+		})
+	im.EXPECT().ReadImage(gomock.Any(), "/images/a.png", int64(0)).DoAndReturn(
+		func(ctx context.Context, key string, offset int64) (*model.Image, error) {
+			if _, ok := ctx.Deadline(); ok {
+				t.Error("Unexpected deadline of IM context")
+			}
+			return nil, model.ErrNoImage
+		})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+		DBTimeout:    "5s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	res, _ := http.Get(domain + "/ads/1")
+	if res.StatusCode != 400 {
+		t.Error("Expected status 400")
+	}
+
+	res, _ = http.Get(domain + "/images/a.png")
+	if res.StatusCode != 400 {
+		t.Error("Expected status 400")
+	}
+
 	srv.Shutdown(nil)
 	<-ch
+}
+
+func TestCompensation(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	sm.EXPECT().IsConnected().Return(false)
-	sm.EXPECT().TryReconnect().Return(errors.New("e"))
+	db := mock_model.NewMockDB(ctrl)
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
 
-	m = model.New(db, sm, im)
+	m := model.New(db, sm, im, nil)
+
+	// uploaded image must be removed if ad isn't created
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 12}, nil).Times(2)
+	db.EXPECT().GetUserWithID(gomock.Any(), int64(12)).
+		Return(&model.User{ID: 12, EmailVerified: true}, nil)
+	im.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return("/images/uploaded.png", nil)
+	db.EXPECT().WithTx(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, fn func(model.DB) error) error {
+			return fn(db)
+		})
+	db.EXPECT().NewAd(gomock.Any(), gomock.Any()).
+		Return(int64(0), errors.New("DB error"))
+	im.EXPECT().DeleteImage(gomock.Any(), "/images/uploaded.png").Return(nil)
 
-	srv, ch = api.StartServer(api.Config{
+	srv, ch := api.StartServer(api.Config{
 		Address:      "localhost:49123",
 		ReadTimeout:  "25s",
 		WriteTimeout: "25s",
@@ -2365,7 +2417,28 @@ func TestMiddleware(t *testing.T) {
 
 	time.Sleep(time.Millisecond * 50) // time to start the server
 
-	res, _ = http.Post(domain+"/users/logout", "application/x-www-form-urlencoded; charset=utf-8", nil)
+	path := os.Getenv("CI_PROJECT_DIR") + "/docs/AuthReq.PNG"
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal("Can't open file")
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("images", filepath.Base(path))
+	io.Copy(part, file)
+	writer.WriteField("title", "Building")
+	writer.WriteField("description_ad", "Awesome")
+	writer.WriteField("city", "Moscow")
+	writer.Close()
+	file.Close()
+
+	r, _ := http.NewRequest("POST", domain+"/ads/new", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Cookie", "session_id=123abc")
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
 	if res.StatusCode != 500 {
 		t.Error("Expected status 500")
 	}
@@ -2373,3 +2446,1638 @@ func TestMiddleware(t *testing.T) {
 	srv.Shutdown(nil)
 	<-ch
 }
+
+func TestSendImage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_model.NewMockDB(ctrl)
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	content := "0123456789"
+	modTime := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	im.EXPECT().ReadImage(gomock.Any(), "/images/a.png", gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key string, offset int64) (*model.Image, error) {
+			return &model.Image{
+				Body:        ioutil.NopCloser(strings.NewReader(content[offset:])),
+				Size:        int64(len(content)),
+				ContentType: "image/png",
+				ModTime:     modTime,
+			}, nil
+		}).AnyTimes()
+	im.EXPECT().ReadImage(gomock.Any(), "/images/b.png", int64(0)).
+		Return(nil, model.ErrNoImage)
+	im.EXPECT().ReadImage(gomock.Any(), "/images/c.png", int64(0)).
+		Return(nil, errors.New("S3 error"))
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// whole image
+	res, err := http.Get(domain + "/images/a.png")
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 || string(data) != content {
+		t.Error("Expected whole image, got", res.StatusCode, string(data))
+	}
+	if res.Header.Get("Content-Type") != "image/png" {
+		t.Error("Expected content type image/png got", res.Header.Get("Content-Type"))
+	}
+
+	// range of image
+	r, _ := http.NewRequest("GET", domain+"/images/a.png", nil)
+	r.Header.Set("Range", "bytes=3-5")
+	res, _ = http.DefaultClient.Do(r)
+	data, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent || string(data) != "345" {
+		t.Error("Expected part of image, got", res.StatusCode, string(data))
+	}
+
+	// image isn't modified
+	r, _ = http.NewRequest("GET", domain+"/images/a.png", nil)
+	r.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+	res, _ = http.DefaultClient.Do(r)
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotModified {
+		t.Error("Expected status 304 got", res.StatusCode)
+	}
+
+	res, _ = http.Get(domain + "/images/b.png")
+	if res.StatusCode != 400 {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+
+	res, _ = http.Get(domain + "/images/c.png")
+	if res.StatusCode != 500 {
+		t.Error("Expected status 500 got", res.StatusCode)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestUploadImage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_model.NewMockDB(ctrl)
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	image, err := ioutil.ReadFile(os.Getenv("CI_PROJECT_DIR") + "/docs/AuthReq.PNG")
+	if err != nil {
+		t.Fatal("Can't open file")
+	}
+
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 12}, nil).AnyTimes()
+	im.EXPECT().PresignUpload(gomock.Any(), gomock.Any(), 15*time.Minute).
+		DoAndReturn(func(ctx context.Context, key string, expires time.Duration) (string, error) {
+			return "http://storage" + key, nil
+		})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	post := func(url string) (int, []byte) {
+		r, _ := http.NewRequest("POST", domain+url, nil)
+		r.Header.Set("Cookie", "session_id=123abc")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res.StatusCode, data
+	}
+
+	code, data := post("/uploads/new")
+	upload := struct {
+		ID     string
+		URL    string
+		Method string
+		Ref    string
+	}{}
+	json.Unmarshal(data, &upload)
+	if code != http.StatusCreated || !strings.HasPrefix(upload.ID, "12-") || upload.Method != "PUT" {
+		t.Fatal("Unexpected upload", code, string(data))
+	}
+	key := "/images/uploads/" + upload.ID
+	if upload.URL != "http://storage"+key || upload.Ref != "/uploads/"+upload.ID+"/finalize" {
+		t.Error("Unexpected URL of upload", upload.URL, upload.Ref)
+	}
+
+	// image is converted and staged file is removed
+	im.EXPECT().ReadImage(gomock.Any(), key, int64(0)).Return(&model.Image{
+		Body: ioutil.NopCloser(bytes.NewReader(image)),
+		Size: int64(len(image)),
+	}, nil)
+	im.EXPECT().UploadImage(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return("/images/converted.png", nil)
+	im.EXPECT().DeleteImage(gomock.Any(), key).Return(nil)
+	code, data = post(upload.Ref)
+	if code != http.StatusCreated || !strings.Contains(string(data), "/images/converted.png") {
+		t.Error("Expected address of image, got", code, string(data))
+	}
+
+	// upload is already finalized
+	im.EXPECT().ReadImage(gomock.Any(), key, int64(0)).Return(nil, model.ErrNoImage)
+	if code, _ = post(upload.Ref); code != http.StatusBadRequest {
+		t.Error("Expected status 400 got", code)
+	}
+
+	// upload isn't an image
+	im.EXPECT().ReadImage(gomock.Any(), "/images/uploads/12-ab", int64(0)).Return(&model.Image{
+		Body: ioutil.NopCloser(strings.NewReader("text")),
+		Size: 4,
+	}, nil)
+	im.EXPECT().DeleteImage(gomock.Any(), "/images/uploads/12-ab").Return(nil)
+	if code, _ = post("/uploads/12-ab/finalize"); code != http.StatusBadRequest {
+		t.Error("Expected status 400 got", code)
+	}
+
+	// upload of other user
+	if code, _ = post("/uploads/13-ab/finalize"); code != http.StatusForbidden {
+		t.Error("Expected status 403 got", code)
+	}
+
+	// image manager has no own storage
+	r, _ := http.NewRequest("PUT", domain+"/storage"+key, strings.NewReader("image"))
+	res, _ := http.DefaultClient.Do(r)
+	if res.StatusCode != http.StatusNotFound {
+		t.Error("Expected status 404 got", res.StatusCode)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestSearchFilters(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_model.NewMockDB(ctrl)
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	hasImages := true
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Query:         "плитка",
+		Limit:         15,
+		MinPrice:      100,
+		MaxPrice:      500,
+		City:          "Moscow",
+		SubwayStation: "Arbatskaya",
+		OwnerID:       12,
+		CreatedAfter:  time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC),
+		HasImages:     &hasImages,
+	}).Return([]*model.AdItem{}, nil)
+	// nothing is found, so ads are searched in fuzzy mode
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Query:         "плитка",
+		Limit:         15,
+		Fuzzy:         true,
+		MinPrice:      100,
+		MaxPrice:      500,
+		City:          "Moscow",
+		SubwayStation: "Arbatskaya",
+		OwnerID:       12,
+		CreatedAfter:  time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC),
+		HasImages:     &hasImages,
+	}).Return([]*model.AdItem{}, nil)
+	// invalid values are ignored
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Limit:   15,
+		Country: "Russia",
+	}).Return([]*model.AdItem{}, nil)
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Limit: 15,
+		Sort:  model.SortPriceDesc,
+	}).Return([]*model.AdItem{}, nil)
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Query: "roof",
+		Limit: 15,
+		Sort:  model.SortRelevance,
+	}).Return([]*model.AdItem{}, nil)
+	db.EXPECT().GetAds(gomock.Any(), &model.SearchParams{
+		Query: "roof",
+		Limit: 15,
+		Sort:  model.SortRelevance,
+		Fuzzy: true,
+	}).Return([]*model.AdItem{}, nil)
+	db.EXPECT().GetAdsOfUser(gomock.Any(), int64(12), model.SortNewest).
+		Return([]*model.AdItem{}, nil)
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	for _, c := range []struct {
+		query string
+		code  int
+	}{
+		{"query=плитка&min_price=100&max_price=500&city=Moscow&subway_station=Arbatskaya" +
+			"&owner_id=12&created_after=2018-05-01&created_before=2018-06-01T12:00:00Z&has_images=true&unknown=1", 200},
+		{"country=Russia&created_after=yesterday&min_price=cheap", 200},
+		{"min_price=500&max_price=100", 400},
+		{"created_after=2018-06-01&created_before=2018-05-01", 400},
+		{"sort=price_desc", 200},
+		{"sort=relevance&query=roof", 200},
+		{"sort=relevance", 400},
+		{"sort=cheapest", 400},
+	} {
+		res, err := http.Get(domain + "/ads?" + c.query)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Error("Expected status", c.code, "got", res.StatusCode, "for", c.query)
+		}
+	}
+
+	res, _ := http.Get(domain + "/users/12?show_ads=true&sort=newest")
+	if res.StatusCode != 200 {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	res, _ = http.Get(domain + "/users/12?show_ads=true&sort=relevance")
+	if res.StatusCode != 400 {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestPagination(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	for i := 0; i < 5; i++ {
+		db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.IntFrom(int64(100 * (i + 1)))})
+	}
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	type page struct {
+		Items []struct {
+			ID int64 `json:"id"`
+		} `json:"items"`
+		Total      int64  `json:"total"`
+		Limit      int    `json:"limit"`
+		Offset     int    `json:"offset"`
+		Next       string `json:"next"`
+		Prev       string `json:"prev"`
+		NextCursor string `json:"next_cursor"`
+		PrevCursor string `json:"prev_cursor"`
+	}
+	get := func(ref string) (int, *page) {
+		res, err := http.Get(domain + ref)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		defer res.Body.Close()
+		p := &page{}
+		json.NewDecoder(res.Body).Decode(p)
+		return res.StatusCode, p
+	}
+	ids := func(p *page) string {
+		ids := make([]int64, 0)
+		for _, item := range p.Items {
+			ids = append(ids, item.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	// pages by offset
+	code, p := get("/ads?version=2&limit=2&sort=price_desc")
+	if code != 200 || ids(p) != "[5 4]" || p.Total != 5 || p.Limit != 2 || p.Prev != "" {
+		t.Fatal("Unexpected first page", code, ids(p), p)
+	}
+	if p.NextCursor != "" {
+		t.Error("Cursor can't be used with order by price")
+	}
+	_, p = get(p.Next)
+	if ids(p) != "[3 2]" || p.Offset != 2 {
+		t.Error("Unexpected second page", ids(p), p.Offset)
+	}
+	_, p = get(p.Next)
+	if ids(p) != "[1]" || p.Next != "" || p.Prev == "" {
+		t.Error("Unexpected last page", ids(p), p)
+	}
+	_, p = get(p.Prev)
+	if ids(p) != "[3 2]" {
+		t.Error("Unexpected second page", ids(p))
+	}
+
+	// pages by cursor
+	_, p = get("/ads?version=2&limit=2&sort=newest")
+	if ids(p) != "[5 4]" || p.NextCursor == "" || p.PrevCursor != "" {
+		t.Fatal("Unexpected first page", ids(p), p)
+	}
+	_, p = get("/ads?version=2&limit=2&sort=newest&cursor=" + p.NextCursor)
+	if ids(p) != "[3 2]" || p.Next == "" || p.Prev == "" {
+		t.Fatal("Unexpected second page", ids(p), p)
+	}
+	_, p = get(p.Next)
+	if ids(p) != "[1]" || p.Next != "" || p.Prev == "" {
+		t.Fatal("Unexpected last page", ids(p), p)
+	}
+	_, p = get(p.Prev)
+	if ids(p) != "[3 2]" || p.Next == "" || p.Prev == "" {
+		t.Fatal("Unexpected second page", ids(p), p)
+	}
+	_, p = get(p.Prev)
+	if ids(p) != "[5 4]" || p.Next == "" || p.Prev != "" || p.Total != 5 {
+		t.Error("Unexpected first page", ids(p), p)
+	}
+
+	// ads are filtered by query
+	_, p = get("/ads?version=2&limit=2&query=nothing")
+	if ids(p) != "[]" || p.Total != 0 || p.Next != "" {
+		t.Error("Unexpected empty page", ids(p), p)
+	}
+
+	// cursor "YToxOjE" points to the first ad
+	for _, ref := range []string{
+		"/ads?version=2&cursor=bad",
+		"/ads?version=2&cursor=YTox",
+		"/ads?version=2&sort=price_asc&cursor=YToxOjE",
+		"/ads?query=roof&cursor=YToxOjE",
+	} {
+		if code, _ = get(ref); code != 400 {
+			t.Error("Expected status 400 got", code, "for", ref)
+		}
+	}
+
+	// legacy response is an array
+	res, _ := http.Get(domain + "/ads?limit=2&cursor=YToxOjE")
+	ads := make([]*model.AdItem, 0)
+	err := json.NewDecoder(res.Body).Decode(&ads)
+	res.Body.Close()
+	if err != nil || len(ads) != 2 || ads[0].ID != 1 {
+		t.Error("Expected array of ads", err)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestGeoSearch(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 1}, nil).AnyTimes()
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	post := func(form string) int {
+		r, _ := http.NewRequest("POST", domain+"/ads/new", strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", "session_id=123abc")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for _, c := range []struct {
+		form string
+		code int
+	}{
+		{"title=Roof&description_ad=Roofs&city=Zelenograd&latitude=55.9825&longitude=37.1814", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow&latitude=55.7601&longitude=37.6186", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow&latitude=55.7601", 400},
+		{"title=Roof&description_ad=Roofs&city=Moscow&latitude=95&longitude=37.6186", 400},
+	} {
+		if code := post(c.form); code != c.code {
+			t.Error("Expected status", c.code, "got", code, "for", c.form)
+		}
+	}
+
+	res, err := http.Get(domain + "/ads?lat=55.7558&lon=37.6173&radius_km=50&sort=distance")
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	ads := make([]*model.AdItem, 0)
+	json.NewDecoder(res.Body).Decode(&ads)
+	res.Body.Close()
+	if len(ads) != 2 || ads[0].ID != 2 || ads[1].ID != 1 {
+		t.Fatal("Expected ads in radius ordered by distance", len(ads))
+	}
+	if ads[0].Distance == nil || *ads[0].Distance > 1 || *ads[0].Latitude != 55.7601 {
+		t.Error("Expected location and distance of ad")
+	}
+
+	for _, query := range []string{
+		"lat=55.7558&radius_km=50",
+		"lat=55.7558&lon=200&radius_km=50",
+		"lat=55.7558&lon=37.6173&radius_km=-1",
+		"lat=55.7558&lon=37.6173&sort=distance",
+	} {
+		res, _ = http.Get(domain + "/ads?" + query)
+		res.Body.Close()
+		if res.StatusCode != 400 {
+			t.Error("Expected status 400 got", res.StatusCode, "for", query)
+		}
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestCategories(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 1}, nil).AnyTimes()
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	db.AddCategory(&model.Category{Slug: "repair", Name: "Repair"})
+	db.AddCategory(&model.Category{Slug: "plumbing", Name: "Plumbing", ParentID: zero.IntFrom(1)})
+	db.AddCategory(&model.Category{Slug: "roofs", Name: "Roofs"})
+	db.AddCategory(&model.Category{Slug: "boilers", Name: "Boilers", ParentID: zero.IntFrom(2)})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	res, err := http.Get(domain + "/categories")
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	tree := make([]*model.Category, 0)
+	json.NewDecoder(res.Body).Decode(&tree)
+	res.Body.Close()
+	if len(tree) != 2 || tree[0].Slug != "repair" || tree[1].Slug != "roofs" {
+		t.Fatal("Expected root categories", len(tree))
+	}
+	if len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 ||
+		tree[0].Children[0].Children[0].Slug != "boilers" || tree[1].Children != nil {
+		t.Error("Expected subcategories")
+	}
+
+	for _, c := range []struct {
+		form string
+		code int
+	}{
+		{"title=Boiler&description_ad=Boilers&city=Moscow&category_id=4", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow&category_id=3", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow", 201},
+		{"title=Roof&description_ad=Roofs&city=Moscow&category_id=10", 400},
+	} {
+		r, _ := http.NewRequest("POST", domain+"/ads/new", strings.NewReader(c.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", "session_id=123abc")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Error("Expected status", c.code, "got", res.StatusCode, "for", c.form)
+		}
+	}
+
+	res, err = http.Get(domain + "/ads?category=repair")
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	ads := make([]*model.AdItem, 0)
+	json.NewDecoder(res.Body).Decode(&ads)
+	res.Body.Close()
+	if len(ads) != 1 || ads[0].ID != 1 || ads[0].CategoryID.Int64 != 4 {
+		t.Error("Expected ad of subcategory", len(ads))
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestSavedSearches(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 1}, nil).AnyTimes()
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "456def"}).
+		Return(&model.Session{ID: 2}, nil).AnyTimes()
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	db.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@gmail.com", EmailVerified: true})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	do := func(method, path, form, session string) *http.Response {
+		r, _ := http.NewRequest(method, domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", "session_id="+session)
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		return res
+	}
+
+	for _, c := range []struct {
+		form string
+		code int
+	}{
+		{"name=Roofs&query=roof&city=Moscow&max_price=1000", 201},
+		{"name=Anything", 201},
+		{"query=roof", 400},
+		{"name=Roofs&min_price=1000&max_price=10", 400},
+		{"name=Roofs&lat=55.7558&radius_km=50", 400},
+	} {
+		res := do("POST", "/users/profile/searches", c.form, "123abc")
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Error("Expected status", c.code, "got", res.StatusCode, "for", c.form)
+		}
+	}
+
+	res := do("GET", "/users/profile/searches", "", "123abc")
+	searches := make([]*model.SavedSearch, 0)
+	json.NewDecoder(res.Body).Decode(&searches)
+	res.Body.Close()
+	if len(searches) != 2 || searches[0].Name != "Roofs" || searches[0].Params.City != "Moscow" ||
+		searches[0].Params.MaxPrice != 1000 {
+		t.Fatal("Expected saved searches", len(searches))
+	}
+
+	// user can't remove search of other user
+	res = do("DELETE", "/users/profile/searches/2", "", "456def")
+	res.Body.Close()
+	if res.StatusCode != 400 {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	res = do("DELETE", "/users/profile/searches/2", "", "123abc")
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 2, City: "Moscow", Price: zero.IntFrom(500)})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 2, City: "Moscow", Price: zero.IntFrom(5000)})
+	checker, _ := alerts.New(alerts.Config{}, db, nil)
+	checker.Check(ctx)
+
+	res = do("GET", "/users/profile/alerts", "", "123abc")
+	list := make([]*model.Alert, 0)
+	json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+	if len(list) != 1 || list[0].AdID != 1 || list[0].SearchID != 1 || list[0].SearchName != "Roofs" {
+		t.Error("Expected alert about ad", len(list))
+	}
+
+	res = do("GET", "/users/profile/alerts", "", "456def")
+	list = make([]*model.Alert, 0)
+	json.NewDecoder(res.Body).Decode(&list)
+	res.Body.Close()
+	if len(list) != 0 {
+		t.Error("Expected no alerts of other user")
+	}
+
+	// concurrent requests can't save more searches than limit
+	var wg sync.WaitGroup
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("POST", domain+"/users/profile/searches", strings.NewReader("name=Anything"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Cookie", "session_id=456def")
+			if res, err := http.DefaultClient.Do(r); err == nil {
+				res.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if searches, _ = db.GetSavedSearches(ctx, 2); len(searches) != 20 {
+		t.Error("Expected 20 saved searches got", len(searches))
+	}
+
+	// connections of concurrent requests may be still active
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+	<-ch
+}
+
+func TestSuggestAds(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	for i := 0; i < 30; i++ {
+		db.NewAd(ctx, &model.AdItem{Title: fmt.Sprint("Монтаж ", i), UserID: 1, City: "Москва"})
+	}
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	for _, c := range []struct {
+		query string
+		code  int
+		count int
+	}{
+		{"q=%D0%BC%D0%BE", 200, 10}, // "мо"
+		{"q=%D0%BC%D0%BE&limit=100", 200, 20},
+		{"q=%D0%BC%D0%BE%D1%81&limit=5", 200, 1},
+		{"q=roof", 200, 0},
+		{"q=+", 400, 0},
+		{"", 400, 0},
+	} {
+		res, err := http.Get(domain + "/ads/suggest?" + c.query)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		suggestions := make([]*model.Suggestion, 0)
+		json.NewDecoder(res.Body).Decode(&suggestions)
+		res.Body.Close()
+		if res.StatusCode != c.code || len(suggestions) != c.count {
+			t.Error("Expected", c.code, c.count, "got", res.StatusCode, len(suggestions), "for", c.query)
+		}
+		if c.count > 0 && (suggestions[0].Text != "Москва" || suggestions[0].Count != 30) {
+			t.Error("Expected the most popular suggestion first")
+		}
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestFacets(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.IntFrom(500)})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.IntFrom(7000)})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Kazan", Price: zero.IntFrom(7000)})
+	db.NewAd(ctx, &model.AdItem{Title: "Boiler", UserID: 1, City: "Kazan"})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	get := func(ref string) *model.Facets {
+		res, err := http.Get(domain + ref)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		defer res.Body.Close()
+		page := struct {
+			Facets *model.Facets `json:"facets"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&page)
+		return page.Facets
+	}
+
+	facets := get("/ads?version=2&include=facets&query=roof&limit=1")
+	if facets == nil {
+		t.Fatal("Expected facets in page of ads")
+	}
+	if len(facets.Cities) != 2 || facets.Cities[0].Value != "Moscow" || facets.Cities[0].Count != 2 {
+		t.Error("Unexpected facets of cities", facets.Cities)
+	}
+	if len(facets.Prices) != 2 || facets.Prices[1].Min != 5000 || facets.Prices[1].Count != 2 {
+		t.Error("Unexpected facets of prices")
+	}
+
+	if facets = get("/ads?version=2&min_price=1000"); facets != nil {
+		t.Error("Facets mustn't be returned without include")
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestFuzzySearch(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", EmailVerified: true})
+	db.NewAd(ctx, &model.AdItem{Title: "Монтаж котла", UserID: 1, City: "Москва"})
+	db.NewAd(ctx, &model.AdItem{Title: "Ремонт котла", UserID: 1, City: "Тверь"})
+	db.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow"})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	type page struct {
+		Items      []*model.AdItem `json:"items"`
+		Total      int64           `json:"total"`
+		Next       string          `json:"next"`
+		Fuzzy      bool            `json:"fuzzy"`
+		DidYouMean []string        `json:"did_you_mean"`
+	}
+	get := func(ref string, v interface{}) {
+		res, err := http.Get(domain + ref)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		defer res.Body.Close()
+		json.NewDecoder(res.Body).Decode(v)
+	}
+
+	// nothing is found exactly, so misspelled word is searched
+	var p page
+	get("/ads?version=2&query=котел&limit=1", &p)
+	if !p.Fuzzy || len(p.Items) != 1 || p.Total != 2 {
+		t.Error("Expected ads found by fuzzy search")
+	}
+	if len(p.DidYouMean) != 1 || p.DidYouMean[0] != "котла" {
+		t.Error("Unexpected corrections of query", p.DidYouMean)
+	}
+	if !strings.Contains(p.Next, "fuzzy=true") {
+		t.Error("Expected fuzzy search on the next page got", p.Next)
+	}
+	var next page
+	get(p.Next, &next)
+	if !next.Fuzzy || len(next.Items) != 1 || next.Items[0].ID == p.Items[0].ID {
+		t.Error("Expected the next page of fuzzy search")
+	}
+
+	var exact page
+	get("/ads?version=2&query=котла", &exact)
+	if exact.Fuzzy || len(exact.Items) != 2 || exact.DidYouMean != nil {
+		t.Error("Expected ads found exactly")
+	}
+
+	// legacy response has ads only
+	var ads []*model.AdItem
+	get("/ads?query=котел", &ads)
+	if len(ads) != 2 {
+		t.Error("Expected 2 ads found by fuzzy search got", len(ads))
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestVerifyEmail(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+
+	m := model.New(db, sm, im, outbox)
+
+	sm.EXPECT().CheckSession(gomock.Any(), &model.SessionID{ID: "123abc"}).
+		Return(&model.Session{ID: 1}, nil).AnyTimes()
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// post sends form and returns status code of response
+	post := func(path, form string) int {
+		r, _ := http.NewRequest("POST", domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Cookie", "session_id=123abc")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// lastToken returns code from the last sent mail
+	lastToken := func() string {
+		mails := outbox.Mails()
+		if len(mails) == 0 {
+			t.Fatal("Expected sent mail")
+		}
+		lines := strings.Split(mails[len(mails)-1].Body, "\n")
+		for i, line := range lines {
+			if strings.HasPrefix(line, "or enter this code") && i+1 < len(lines) {
+				return lines[i+1]
+			}
+		}
+		t.Fatal("Expected code in mail")
+		return ""
+	}
+
+	code := post("/users/new", "email=ivan@example.com&first_name=Ivan&last_name=Ivanov&password=123456")
+	if code != http.StatusCreated {
+		t.Fatal("Expected status 201 got", code)
+	}
+	mails := outbox.Mails()
+	if len(mails) != 1 || mails[0].To != "ivan@example.com" {
+		t.Fatal("Expected mail of verification")
+	}
+	token := lastToken()
+
+	if code = post("/ads/new", "title=Roof&description_ad=Roofs&city=Moscow"); code != http.StatusForbidden {
+		t.Error("Expected status 403 got", code)
+	}
+
+	// resent token replaces previous one
+	if code = post("/users/verify/resend", ""); code != http.StatusOK {
+		t.Error("Expected status 200 got", code)
+	}
+	if code = post("/users/verify", "token="+token); code != http.StatusBadRequest {
+		t.Error("Expected status 400 got", code)
+	}
+	token = lastToken()
+
+	if code = post("/users/verify", ""); code != http.StatusBadRequest {
+		t.Error("Expected status 400 got", code)
+	}
+	res, err := http.Get(domain + "/users/verify?token=" + token)
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if code = post("/users/verify", "token="+token); code != http.StatusBadRequest {
+		t.Error("Expected token can be used once")
+	}
+	if u, _ := db.GetUserWithID(context.Background(), 1); !u.EmailVerified {
+		t.Error("Expected verified email")
+	}
+
+	if code = post("/users/verify/resend", ""); code != http.StatusBadRequest {
+		t.Error("Expected status 400 got", code)
+	}
+	if code = post("/ads/new", "title=Roof&description_ad=Roofs&city=Moscow"); code != http.StatusCreated {
+		t.Error("Expected status 201 got", code)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestResetPassword(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := sessionmanager.InitMemorySM(sessionmanager.Config{TockenLength: 32, ExpirationTime: 100})
+	defer sm.Close()
+	im := mock_model.NewMockIM(ctrl)
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+
+	m := model.New(db, sm, im, outbox)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com",
+		Password: string(hash)})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// post sends form and returns response with closed body
+	post := func(path, form string, cookies ...*http.Cookie) *http.Response {
+		r, _ := http.NewRequest("POST", domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		return res
+	}
+
+	res := post("/users/login", "email=ivan@example.com&password=123456")
+	if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 {
+		t.Fatal("Expected session of user")
+	}
+	session := res.Cookies()[0]
+
+	if res = post("/users/password/forgot", ""); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/password/forgot", "email=petr@example.com"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if len(outbox.Mails()) != 0 {
+		t.Error("Expected no mail to unknown email")
+	}
+	if res = post("/users/password/forgot", "email=ivan@example.com"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	mails := outbox.Mails()
+	if len(mails) != 1 || mails[0].To != "ivan@example.com" {
+		t.Fatal("Expected mail of reset of password")
+	}
+	var token string
+	lines := strings.Split(mails[0].Body, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "or enter this code") && i+1 < len(lines) {
+			token = lines[i+1]
+		}
+	}
+
+	if res = post("/users/password/reset", "token=bad&password=654321"); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/password/reset", "token="+token); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/password/reset", "token="+token+"&password=654321"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res = post("/users/password/reset", "token="+token+"&password=111111"); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected token can be used once")
+	}
+
+	// sessions are deleted after reset
+	if res = post("/users/verify/resend", "", session); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected status 401 got", res.StatusCode)
+	}
+	if res = post("/users/login", "email=ivan@example.com&password=123456"); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected old password can't be used")
+	}
+	if res = post("/users/login", "email=ivan@example.com&password=654321"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestForgotPasswordFailure(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := mock_model.NewMockSM(ctrl)
+	im := mock_model.NewMockIM(ctrl)
+	ml := mock_model.NewMockMailer(ctrl)
+
+	m := model.New(db, sm, im, ml)
+
+	ctx := context.Background()
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com"})
+
+	ml.EXPECT().SendMail(gomock.Any(), gomock.Any()).Return(errors.New("Mail server is down"))
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// status is the same for known and unknown emails even if mail isn't sent
+	for _, email := range []string{"ivan@example.com", "petr@example.com"} {
+		res, err := http.PostForm(domain+"/users/password/forgot", url.Values{"email": {email}})
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Error("Expected status 200 got", res.StatusCode, "for", email)
+		}
+	}
+	if strings.Contains(logs.String(), "@example.com") {
+		t.Error("Expected no emails in log", logs.String())
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestChangePasswordAndEmail(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := sessionmanager.InitMemorySM(sessionmanager.Config{TockenLength: 32, ExpirationTime: 100})
+	defer sm.Close()
+	im := mock_model.NewMockIM(ctrl)
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+
+	m := model.New(db, sm, im, outbox)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com",
+		Password: string(hash)})
+	db.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@example.com",
+		Password: string(hash)})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// post sends form and returns response with closed body
+	post := func(path, form string, cookies ...*http.Cookie) *http.Response {
+		r, _ := http.NewRequest("POST", domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		return res
+	}
+
+	res := post("/users/login", "email=ivan@example.com&password=123456")
+	if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 {
+		t.Fatal("Expected session of user")
+	}
+	current := res.Cookies()[0]
+	res = post("/users/login", "email=ivan@example.com&password=123456")
+	if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 {
+		t.Fatal("Expected session of user")
+	}
+	other := res.Cookies()[0]
+
+	// change of password
+	if res = post("/users/profile/password", "new_password=654321"); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected status 401 got", res.StatusCode)
+	}
+	if res = post("/users/profile/password", "password=123456", current); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/profile/password", "password=111111&new_password=654321", current); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/profile/password", "password=123456&new_password=654321", current); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res = post("/users/profile/password", "password=654321&new_password=123456", other); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected other session is deleted")
+	}
+	if res = post("/users/login", "email=ivan@example.com&password=654321"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	// change of email
+	if res = post("/users/profile/email", "email=petr@example.com&password=654321", current); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/profile/email", "email=ivanov@example.com&password=123456", current); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if len(outbox.Mails()) != 0 {
+		t.Error("Expected no mails")
+	}
+	if res = post("/users/profile/email", "email=ivanov@example.com&password=654321", current); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	mails := outbox.Mails()
+	if len(mails) != 1 || mails[0].To != "ivanov@example.com" {
+		t.Fatal("Expected mail to new email")
+	}
+	var token string
+	lines := strings.Split(mails[0].Body, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "or enter this code") && i+1 < len(lines) {
+			token = lines[i+1]
+		}
+	}
+
+	// email isn't changed before confirmation
+	if u, _ := db.GetUserWithID(ctx, 1); u.Email != "ivan@example.com" {
+		t.Error("Expected old email", u.Email)
+	}
+	if res = post("/users/profile/email/confirm", "token=bad"); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res = post("/users/profile/email/confirm", "token="+token); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if u, _ := db.GetUserWithID(ctx, 1); u.Email != "ivanov@example.com" || !u.EmailVerified {
+		t.Error("Expected new verified email", u.Email)
+	}
+	if res = post("/users/profile/email/confirm", "token="+token); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected token can be used once")
+	}
+	if res = post("/users/login", "email=ivanov@example.com&password=654321"); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestUserSessions(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := sessionmanager.InitMemorySM(sessionmanager.Config{TockenLength: 32, ExpirationTime: 100})
+	defer sm.Close()
+	im := mock_model.NewMockIM(ctrl)
+	im.EXPECT().DeleteImage(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+
+	m := model.New(db, sm, im, outbox)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com",
+		Password: string(hash)})
+	db.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@example.com",
+		Password: string(hash)})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// do sends request and returns response with read body
+	do := func(method, path, form string, cookies ...*http.Cookie) (*http.Response, []byte) {
+		r, _ := http.NewRequest(method, domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res, body
+	}
+	login := func(email string) *http.Cookie {
+		res, _ := do("POST", "/users/login", "email="+email+"&password=123456")
+		if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 {
+			t.Fatal("Expected session of user")
+		}
+		return res.Cookies()[0]
+	}
+	list := func(cookie *http.Cookie) []map[string]interface{} {
+		res, body := do("GET", "/users/sessions", "", cookie)
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("Expected status 200 got", res.StatusCode)
+		}
+		var sessions []map[string]interface{}
+		if err := json.Unmarshal(body, &sessions); err != nil {
+			t.Fatal("Expected JSON array of sessions", err)
+		}
+		return sessions
+	}
+
+	other := login("ivan@example.com")
+	current := login("ivan@example.com")
+	petr := login("petr@example.com")
+
+	if res, _ := do("GET", "/users/sessions", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected status 401 got", res.StatusCode)
+	}
+
+	sessions := list(current)
+	if len(sessions) != 2 {
+		t.Fatal("Expected 2 sessions got", len(sessions))
+	}
+	if sessions[0]["current"] != true || sessions[1]["current"] != false {
+		t.Error("Expected the newest session is current")
+	}
+	if sessions[0]["ip"] != "127.0.0.1" || sessions[0]["user_agent"] != "Go-http-client/1.1" {
+		t.Error("Expected info of session", sessions[0])
+	}
+	for _, sess := range sessions {
+		if sess["id"] == current.Value || sess["id"] == other.Value {
+			t.Error("Tocken of session mustn't be revealed")
+		}
+	}
+	otherID, _ := sessions[1]["id"].(string)
+
+	// session of other user can't be deleted
+	if res, _ := do("DELETE", "/users/sessions/"+otherID, "", petr); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res, _ := do("DELETE", "/users/sessions/abc", "", current); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res, _ := do("DELETE", "/users/sessions/"+otherID, "", current); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/sessions", "", other); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected other session is deleted")
+	}
+	if sessions = list(current); len(sessions) != 1 {
+		t.Error("Expected 1 session got", len(sessions))
+	}
+
+	// removal of user deletes all his sessions
+	another := login("ivan@example.com")
+	if res, _ := do("DELETE", "/users/profile", "", current); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/sessions", "", another); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected all sessions are deleted")
+	}
+	if sessions = list(petr); len(sessions) != 1 {
+		t.Error("Expected session of other user")
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
+
+func TestProxyAddress(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := sessionmanager.InitMemorySM(sessionmanager.Config{TockenLength: 32, ExpirationTime: 100})
+	defer sm.Close()
+	im := mock_model.NewMockIM(ctrl)
+
+	m := model.New(db, sm, im, nil)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com",
+		Password: string(hash)})
+
+	for _, c := range []struct {
+		trust bool
+		ip    string
+	}{
+		{false, "127.0.0.1"},
+		{true, "10.0.0.2"},
+	} {
+		srv, ch := api.StartServer(api.Config{
+			Address:      "localhost:49123",
+			ReadTimeout:  "25s",
+			WriteTimeout: "25s",
+			IdleTimeout:  "25s",
+			TrustProxy:   c.trust,
+		}, m)
+
+		time.Sleep(time.Millisecond * 50) // time to start the server
+
+		// client can add any addresses before address added by proxy
+		r, _ := http.NewRequest("POST", domain+"/users/login",
+			strings.NewReader("email=ivan@example.com&password=123456"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 {
+			t.Fatal("Expected session of user")
+		}
+
+		sess, _ := sm.CheckSession(ctx, &model.SessionID{ID: res.Cookies()[0].Value})
+		if sess == nil || sess.IP != c.ip {
+			t.Error("Expected address", c.ip, "of client when proxy is trusted:", c.trust)
+		}
+
+		http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+		srv.Shutdown(nil)
+		<-ch
+	}
+}
+
+func TestBearerTokens(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := memdb.New()
+	sm := sessionmanager.InitMemorySM(sessionmanager.Config{TockenLength: 32, ExpirationTime: 100})
+	defer sm.Close()
+	im := mock_model.NewMockIM(ctrl)
+	outbox, _ := mailer.NewOutbox(mailer.OutboxConfig{})
+
+	m := model.New(db, sm, im, outbox)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	db.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@example.com",
+		Password: string(hash)})
+
+	srv, ch := api.StartServer(api.Config{
+		Address:      "localhost:49123",
+		ReadTimeout:  "25s",
+		WriteTimeout: "25s",
+		IdleTimeout:  "25s",
+	}, m)
+
+	time.Sleep(time.Millisecond * 50) // time to start the server
+
+	// do sends request with bearer token if it isn't empty
+	do := func(method, path, form, bearer string) (*http.Response, []byte) {
+		r, _ := http.NewRequest(method, domain+path, strings.NewReader(form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Expected no error while request\nGot: ", err.Error())
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return res, body
+	}
+	type tokens struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		ID           int64  `json:"id"`
+		FirstName    string `json:"first_name"`
+	}
+	token := func(form string) *tokens {
+		res, body := do("POST", "/users/token", form, "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("Expected status 200 got", res.StatusCode)
+		}
+		if res.Header.Get("Cache-Control") != "no-store" {
+			t.Error("Expected tokens aren't cached")
+		}
+		tk := &tokens{}
+		if err := json.Unmarshal(body, tk); err != nil {
+			t.Fatal("Expected JSON object of tokens", err)
+		}
+		if tk.AccessToken == "" || tk.RefreshToken == "" || tk.TokenType != "Bearer" ||
+			tk.ExpiresIn != 100 || tk.ID != 1 || tk.FirstName != "Ivan" {
+			t.Error("Unexpected tokens", tk)
+		}
+		return tk
+	}
+
+	for _, form := range []string{
+		"email=ivan@example.com&password=123456",
+		"grant_type=other",
+		"grant_type=password&email=ivan@example.com",
+		"grant_type=password&email=ivan@example.com&password=654321",
+		"grant_type=password&email=petr@example.com&password=123456",
+		"grant_type=refresh_token",
+		"grant_type=refresh_token&refresh_token=bad",
+	} {
+		if res, _ := do("POST", "/users/token", form, ""); res.StatusCode != http.StatusBadRequest {
+			t.Error("Expected status 400 got", res.StatusCode, "for", form)
+		}
+	}
+
+	first := token("grant_type=password&email=ivan@example.com&password=123456")
+	second := token("grant_type=password&email=ivan@example.com&password=123456")
+
+	if res, _ := do("GET", "/users/profile", "", first.AccessToken); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/profile", "", "bad"); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected status 401 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/profile", "", ""); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected status 401 got", res.StatusCode)
+	}
+
+	// refresh token is rotated
+	refreshed := token("grant_type=refresh_token&refresh_token=" + first.RefreshToken)
+	if refreshed.RefreshToken == first.RefreshToken || refreshed.AccessToken == first.AccessToken {
+		t.Error("Expected new tokens")
+	}
+	if res, _ := do("POST", "/users/token", "grant_type=refresh_token&refresh_token="+first.RefreshToken, ""); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected refresh token can be used once")
+	}
+	if res, _ := do("GET", "/users/profile", "", refreshed.AccessToken); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	// revoke of refresh and access tokens
+	if res, _ := do("POST", "/users/token/revoke", "", ""); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected status 400 got", res.StatusCode)
+	}
+	if res, _ := do("POST", "/users/token/revoke", "token="+second.RefreshToken, ""); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("POST", "/users/token", "grant_type=refresh_token&refresh_token="+second.RefreshToken, ""); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected revoked refresh token can't be used")
+	}
+	if res, _ := do("POST", "/users/token/revoke", "token="+second.AccessToken, ""); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/profile", "", second.AccessToken); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected revoked access token can't be used")
+	}
+	if res, _ := do("POST", "/users/token/revoke", "token=unknown", ""); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+
+	// logout deletes session of bearer token
+	if res, _ := do("POST", "/users/logout", "", first.AccessToken); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("GET", "/users/profile", "", first.AccessToken); res.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected session is deleted")
+	}
+
+	// change of password revokes refresh tokens
+	if res, _ := do("POST", "/users/profile/password", "password=123456&new_password=654321", refreshed.AccessToken); res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got", res.StatusCode)
+	}
+	if res, _ := do("POST", "/users/token", "grant_type=refresh_token&refresh_token="+refreshed.RefreshToken, ""); res.StatusCode != http.StatusBadRequest {
+		t.Error("Expected refresh token is revoked")
+	}
+	if res, _ := do("GET", "/users/profile", "", refreshed.AccessToken); res.StatusCode != http.StatusOK {
+		t.Error("Expected current session is kept")
+	}
+
+	// user agent doesn't change login
+	r, _ := http.NewRequest("POST", domain+"/users/login",
+		strings.NewReader("email=ivan@example.com&password=654321"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("User-Agent", "Android_app")
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal("Expected no error while request\nGot: ", err.Error())
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || len(res.Cookies()) == 0 || res.Cookies()[0].Expires.IsZero() {
+		t.Error("Expected expiring cookie")
+	}
+	if len(body) != 0 {
+		t.Error("Expected empty body got", string(body))
+	}
+
+	srv.Shutdown(nil)
+	<-ch
+}
@@ -5,9 +5,31 @@
 package api
 
 // Config for api package. Address is a host with port (i.e. http://127.0.0.1:8080).
+// DBTimeout, SMTimeout, IMTimeout and MailTimeout are deadlines of one operation
+// with database, session manager, image manager and mailer. ShutdownTimeout is time for
+// active requests to finish when service stops. Empty string means no deadline.
+// UploadExpiration is lifetime of URL for direct uploading of image, it's
+// 15 minutes if empty. VerificationExpiration is lifetime of token which
+// verifies email of user, it's 24 hours if empty. ResetExpiration is lifetime
+// of token which resets password of user, it's 1 hour if empty. RefreshExpiration
+// is lifetime of refresh token, it's 30 days if empty. TrustProxy must be set only
+// if service is behind proxy which adds address of client to X-Forwarded-For.
 type Config struct {
 	Address      string `json:"Address,"`
 	ReadTimeout  string `json:"ReadTimeout,"`
 	WriteTimeout string `json:"WriteTimeout,"`
 	IdleTimeout  string `json:"IdleTimeout,"`
+	DBTimeout    string `json:"DBTimeout,"`
+	SMTimeout    string `json:"SMTimeout,"`
+	IMTimeout    string `json:"IMTimeout,"`
+	MailTimeout  string `json:"MailTimeout,"`
+
+	ShutdownTimeout string `json:"ShutdownTimeout,"`
+
+	UploadExpiration       string `json:"UploadExpiration,"`
+	VerificationExpiration string `json:"VerificationExpiration,"`
+	ResetExpiration        string `json:"ResetExpiration,"`
+	RefreshExpiration      string `json:"RefreshExpiration,"`
+
+	TrustProxy bool `json:"TrustProxy,"`
 }
@@ -18,15 +18,76 @@ API Error:
 	message          what client should do for error resolving
 	error code       unique error code
 
+Page of ads:
+	items            JSON array of ads
+	total            number of ads matching query and filters
+	limit            maximum number of ads in page
+	offset           number of the first ad of page (0 if page is requested by cursor)
+	next             reference to the next page (without base part), absent for the last page
+	prev             reference to the previous page (without base part), absent for the first page
+	next_cursor      cursor of the next page if ads are ordered by time of creation
+	prev_cursor      cursor of the previous page if ads are ordered by time of creation
+	facets           facets of ads matching query and filters if they are requested
+	fuzzy            true if ads are found by fuzzy search
+	did_you_mean     JSON array of corrected queries if ads are found by fuzzy search
+
+Facets:
+	countries        JSON array of objects with fields value and count
+	cities           JSON array of objects with fields value and count
+	subway_stations  JSON array of objects with fields value and count
+	prices           JSON array of objects with fields min, max and count
+
 Create confirm object:
 	id               identificator of created user/ad
 	ref              reference to created user/ad (without base part; i.e. "/users/115")
 
-User login confirm object for android application:
+Tokens object:
+	access_token     tocken of session which is sent in header "Authorization: Bearer <access_token>"
+	token_type       always "Bearer"
+	expires_in       number of seconds until access token expires
+	refresh_token    token which is used once to get new tokens
 	id               identificator of logged user
 	first_name       first name of user
 	last_name        last name of user
 
+Category
+
+Names of fields of JSON object which will be returned:
+	id               <int64>
+	parent_id        <int64>   absent for root category
+	slug             <string>  unique name of category for URL
+	name             <string>
+	children         <JSON array of categories>  absent if there are no subcategories
+
+Session
+
+Names of fields of JSON object which will be returned:
+	id               <string>  hash of tocken of session, tocken isn't revealed
+	user_agent       <string>
+	ip               <string>
+	creation_time    <string>
+	last_seen        <string>  updated not more often than once a minute
+	current          <bool>    true for session of the request
+
+Saved search
+
+Names of fields of JSON object which will be returned:
+	id               <int64>
+	name             <string>
+	params           <JSON object>  parameters of search named like parameters of "base/ads"
+	creation_time    <string>
+	checked_time     <string>       time of the last check for new ads
+
+Alert
+
+Names of fields of JSON object which will be returned:
+	id               <int64>
+	search_id        <int64>   ID of saved search
+	search_name      <string>
+	ad_id            <int64>   ID of new ad which matches search
+	ad_title         <string>
+	creation_time    <string>
+
 User
 
 Names of fields of JSON object which will be returned:
@@ -38,6 +99,7 @@ Names of fields of JSON object which will be returned:
 	about            <string>
 	reg_time         <string>
 	avatar_address   <string>
+	email_verified   <bool>
 HTTP parameters which are used to define user:
 	id
 	first_name
@@ -61,6 +123,12 @@ Names of fields of JSON object which will be returned:
 	owner_ad           <JSON object of user>
 	description_ad     <string>
 	creation_time      <string>
+	latitude           <float>
+	longitude          <float>
+	category_id        <int64>
+	title_snippet        <string>  only in search results
+	description_snippet  <string>  only in search results
+	distance_km          <float>   only in results of search in radius
 HTTP parameters which are used to define ad:
 	id
 	title
@@ -70,6 +138,9 @@ HTTP parameters which are used to define ad:
 	subway_station
 	ad_images           [existing images addresses]
 	description_ad
+	latitude            [from -90 to 90]
+	longitude           [from -180 to 180]
+	category_id         [existing category ID]
 
 Interface
 
@@ -80,17 +151,71 @@ Read and search multiple ads
 "base/ads" address:
 	method                 GET
 	allowed parameters:
-		query                                   search query; return only ads which contatins query in title of ad
+		query                                   search query; return only ads which contain all words of query in title, description, city or subway station
 		limit                [positive number]  maximum number of ads which will be returned
 		offset               [positive number]  number of the first ad that will be returned
+		min_price            [positive number]  minimal price of ad
+		max_price            [positive number]  maximal price of ad
+		country                                 country of ad (case is ignored)
+		city                                    city of ad (case is ignored)
+		subway_station                          subway station of ad (case is ignored)
+		owner_id             [positive number]  ID of user who created ad
+		created_after        [date or time]     ads created at this time or later
+		created_before       [date or time]     ads created earlier than this time
+		has_images           [true|false]       only ads with images or only without images
+		category             [slug of category] ads of category and its subcategories
+		lat                  [from -90 to 90]   latitude of center of search in radius
+		lon                  [from -180 to 180] longitude of center of search in radius
+		radius_km            [positive number]  radius of search in kilometres
+		fuzzy                [true|false]       search ads with title or city similar to query instead of words of query
+		sort                 [sort order]       order of ads: newest, oldest, price_asc, price_desc, relevance or distance
+		cursor               [cursor of page]   next_cursor or prev_cursor of page of ads; it's used instead of offset
+		version              [2]                if "2" then return page of ads instead of array
+		include              [facets]           if "facets" then page of ads has facets (only with version "2")
 	return result:
-		status 200           JSON array of ads
-		status 400           <QueryValidError>  JSON object of API error
+		status 200:
+			1.           JSON array of ads if "version" isn't "2"
+			2.           JSON object of page of ads if "version" is "2"
+		status 400:
+			1.           <QueryValidError>        JSON object of API error
+			2.           <SortValidError>         JSON object of API error
+			3.           <CursorValidError>       JSON object of API error
+			4.           <LocationValidError>     JSON object of API error
 		status 500:
 			1.           <GetInfoDBError>         JSON object of API error
 			2.           <ResponseCreatingError>  JSON object of API error
 If limit and/or offset aren't provided, their default values are 15 and 0.
+Filters are combined with each other and with query. Date must be like 2018-05-01
+and time must be in RFC 3339 format (i.e. 2018-05-01T12:00:00Z). Parameters with
+invalid values are ignored. If minimal price or date of creation is greater than
+maximal one then <QueryValidError> is returned.
+By default ads found by query are ordered by relevance and other ads are ordered
+from the oldest. Ads without price are the last ones in orders by price. Ads with
+equal values are ordered by id. Order "relevance" can be used only with query.
+If radius is provided then only ads located in circle with center at lat and lon
+are returned; ads without location are skipped. Every ad has distance from center
+then and order "distance" can be used.
+Category filter returns ads of category with such slug and of all its descendants.
+Facets are numbers of ads matching query and filters for every country, city,
+subway station and bucket of price; values which differ only in case are counted
+together. At most 20 most frequent values of every field are returned. Bucket of
+price includes min and excludes max; min is absent in the first bucket and max
+in the last one. Empty buckets are skipped.
+Cursor is a stable position in list of ads ordered by time of creation, so pages
+requested by cursors don't overlap or skip ads when ads are created or deleted.
+It can be used only with orders newest and oldest or without query and order.
 If there is no ads then it will return empty JSON array.
+Words of query are stemmed (russian and english), so other forms of words are
+found too. Ads found by query are ordered by relevance: words in title weigh more
+than in description and description more than city or subway station. Every found
+ad has snippets of title and description where words of query are wrapped with
+<b> and </b>; the rest of snippet is escaped HTML.
+If nothing is found by query on the first page then ads are searched in fuzzy
+mode: title or city of ad must be similar to query by trigrams, so misspelled
+words are found. Such ads are ordered by similarity by default and have no
+snippets. Page of ads found by fuzzy search has "fuzzy" set, references to pages
+with fuzzy search and at most 3 corrected queries in "did_you_mean"; words of
+query are replaced by the most similar words of titles and cities of ads there.
 
 Get information about particular ad
 
@@ -104,6 +229,37 @@ Get information about particular ad
 			1.           <GetInfoDBError>         JSON object of API error
 			2.           <ResponseCreatingError>  JSON object of API error
 
+Suggest search queries
+
+"base/ads/suggest" address:
+	method                 GET
+	required parameters:
+		q                    [up to 80 characters] beginning of text typed by user
+	allowed parameters:
+		limit                [positive number]  maximum number of suggestions (default 10, at most 20)
+	return result:
+		status 200           JSON array of suggestions
+		status 400           <SuggestValidError>      JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <ResponseCreatingError>  JSON object of API error
+Suggestions are titles, cities and subway stations of ads which start with q
+ignoring case. Every suggestion has fields text, kind ("title", "city" or
+"subway_station") and count of ads with such text; suggestions with greater
+count go first. Response can be cached by client for a minute.
+
+Get tree of categories
+
+Initial tree of categories is created by migration of database.
+
+"base/categories" address:
+	method                 GET
+	return result:
+		status 200           JSON array of root categories; their subcategories are in children
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <ResponseCreatingError>  JSON object of API error
+
 Get information about particular user
 
 "base/users/{id}" address:
@@ -111,11 +267,14 @@ Get information about particular user
 	id                     must be a digit number
 	allowed parameters:
 		show_ads             [true|false] if "true" then return ads of user with wuch id
+		sort                 [sort order] order of ads of user like in "base/ads" except relevance
 	return result:
 		status 200:
 			1.           JSON object of user if "show_ads" isn't "true"
 			2.           JSON array of ads if "show_ads" is "true"
-		status 400           <NoUserWithSuchID> JSON object of API error
+		status 400:
+			1.           <NoUserWithSuchID>       JSON object of API error
+			2.           <SortValidError>         JSON object of API error
 		status 500:
 			1.           <GetInfoDBError>         JSON object of API error
 			2.           <ResponseCreatingError>  JSON object of API error
@@ -135,7 +294,7 @@ Create new user
 		about                                   some additional information about user
 		images               [.JPEG or .png]    avatar image of user (if provided then all parameters must be in "multipart/form-data")
 	return result:
-		status 201           JSON object of user create confirm
+		status 201           JSON object of user create confirm, token of verification is sent to email
 		status 400:
 			1.           <RequestFormParseError>  JSON object of API error
 			2.           <RequestFormDecodeError> JSON object of API error
@@ -147,17 +306,83 @@ Create new user
 			2.           <AddUserDBError>         JSON object of API error
 			3.           <ResponseCreatingError>  JSON object of API error
 
+Verify email
+
+Token is sent to email of user on creating and can be used once. Only users with
+verified email can create ads.
+
+"base/users/verify" address:
+	method                 GET, POST
+	required parameters:
+		token                                   the last token sent to email of user
+	return result:
+		status 200           email is verified
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <BadTokenError>          JSON object of API error
+		status 500           <UpdateUserDBError>      JSON object of API error
+
+Send token of verification again
+
+Cookie with tocken required for this action. Tokens sent before can't be used anymore.
+
+"base/users/verify/resend" address:
+	method                 POST
+	return result:
+		status 200           token is sent
+		status 400           <EmailAlreadyVerifiedError> JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <SendMailError>          JSON object of API error
+
+Forgot password
+
+Token of reset of password is sent to email if there is user with such email.
+Status is the same for unknown emails and if token can't be sent.
+
+"base/users/password/forgot" address:
+	method                 POST
+	required parameters:
+		email                                   email of user
+	return result:
+		status 200           token is sent if user exists
+		status 400           <NoRequiredInfoError>    JSON object of API error
+
+Reset password
+
+Token can be used once. All sessions and refresh tokens of user are deleted on success.
+
+"base/users/password/reset" address:
+	method                 POST
+	required parameters:
+		token                                   the last token sent to email of user
+		password             [printable ASCII]  new password of user
+	return result:
+		status 200           password is replaced
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <RequestDataValidError>  JSON object of API error
+			3.           <BadTokenError>          JSON object of API error
+		status 500:
+			1.           <UpdateUserDBError>      JSON object of API error
+			2.           <SessionDeleteError>     JSON object of API error
+
 Login
 
+Addresses which require cookie also accept access token in header
+"Authorization: Bearer <access_token>". Clients without cookies (i.e. mobile
+applications) get tokens from "base/users/token".
+
 "base/users/login" address:
 	method                 POST
 	required parameters:
 		email                [email]            existing email of user
 		password             [printable ASCII]  password which was used while creating
 	return result:
-		status 200:
-			JSON object of user login confirm if request from "Android_app" and
-			Set-Cookie with "session_id" key which is used for confidential actions
+		status 200           Set-Cookie with "session_id" key which is used for confidential actions
 		status 400:
 			1.           <RequestFormParseError>  JSON object of API error
 			2.           <RequestFormDecodeError> JSON object of API error
@@ -171,16 +396,53 @@ Login
 
 Logout
 
-Cookie with tocken required to delete session. If cookie are not provided there is no effect.
+Cookie or bearer token required to delete session. If they are not provided there is no effect.
 
 "base/users/logout" address:
 	method                 POST
 	return result          status 200 always
 
+Bearer tokens
+
+Access token expires like session from cookie. Refresh token is used once,
+new refresh token is returned instead of it. Every client gets its own refresh
+token. Refresh tokens of user are revoked by reset and change of password.
+
+"base/users/token" address:
+	method                 POST
+	required parameters:
+		grant_type           [password or refresh_token]
+		email                [email]            existing email of user, only for grant type password
+		password             [printable ASCII]  password of user, only for grant type password
+		refresh_token                           refresh token, only for grant type refresh_token
+	return result:
+		status 200           JSON object of tokens
+		status 400:
+			1.           <GrantTypeError>         JSON object of API error
+			2.           <NoRequiredInfoError>    JSON object of API error
+			3.           <BadAuth>                JSON object of API error
+			4.           <BadTokenError>          JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <UpdateUserDBError>      JSON object of API error
+			3.           <SessionCreateError>     JSON object of API error
+
+"base/users/token/revoke" address:
+	method                 POST
+	required parameters:
+		token                                   refresh or access token
+	return result:
+		status 200           token is revoked, status is the same for unknown tokens
+		status 400           <NoRequiredInfoError>    JSON object of API error
+		status 500:
+			1.           <UpdateUserDBError>      JSON object of API error
+			2.           <SessionDeleteError>     JSON object of API error
+
 Update information about user
 
 Cookie with tocken required for this action.
 If avatar_address is empty then avatar image will be deleted if exists.
+Email and password are changed by their own addresses.
 
 "base/users/profile" address:
 	method                 POST
@@ -208,6 +470,71 @@ If avatar_address is empty then avatar image will be deleted if exists.
 			2.           <UpdateUserDBError>      JSON object of API error
 			3.           <GetInfoDBError>         JSON object of API error
 
+Change password
+
+Cookie with tocken required for this action. Other sessions and all refresh
+tokens of user are deleted.
+
+"base/users/profile/password" address:
+	method                 POST
+	required parameters:
+		password             [printable ASCII]  current password of user
+		new_password         [printable ASCII]  new password of user
+	return result:
+		status 200           password is replaced
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <RequestDataValidError>  JSON object of API error
+			3.           <BadAuth>                JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <UpdateUserDBError>      JSON object of API error
+			3.           <SessionDeleteError>     JSON object of API error
+
+Change email
+
+Cookie with tocken required for this action. Token of confirmation is sent to new
+email; email of user is replaced only after confirmation.
+
+"base/users/profile/email" address:
+	method                 POST
+	required parameters:
+		email                [email]            new unique email of user
+		password             [printable ASCII]  current password of user
+	return result:
+		status 200           token is sent to new email
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <RequestDataValidError>  JSON object of API error
+			3.           <BadAuth>                JSON object of API error
+			4.           <UserIsExistsError>      JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+			2.           <UpdateUserDBError>      JSON object of API error
+			3.           <SendMailError>          JSON object of API error
+
+Confirm new email
+
+Token can be used once. New email is verified.
+
+"base/users/profile/email/confirm" address:
+	method                 GET, POST
+	required parameters:
+		token                                   the last token sent to new email
+	return result:
+		status 200           email is replaced
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <BadTokenError>          JSON object of API error
+			3.           <UserIsExistsError>      JSON object of API error
+		status 500           <UpdateUserDBError>      JSON object of API error
+
 Get information about current logged user
 
 Cookie required for this action.
@@ -225,7 +552,7 @@ Cookie required for this action.
 
 Delete existing user
 
-Cookie required for this action.
+Cookie required for this action. All sessions of user are deleted.
 
 "base/users/profile" address:
 	method                 DELETE
@@ -238,6 +565,94 @@ Cookie required for this action.
 			1.           <GetInfoDBError>         JSON object of API error
 			2.           <RemoveUserError>        JSON object of API error
 
+Sessions of user
+
+Cookie required for these actions.
+Sessions are returned from the newest one.
+
+"base/users/sessions" address:
+	method                 GET
+	return result:
+		status 200           JSON array of active sessions of current user
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500           <GetSessionsError>       JSON object of API error
+
+"base/users/sessions/{id}" address:
+	method                 DELETE
+	id                     hex hash of session
+	return result:
+		status 200           session is deleted (current session can be deleted too)
+		status 400           <NoSuchSessionError>     JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500           <SessionDeleteError>     JSON object of API error
+
+Saved searches and alerts
+
+Cookie required for these actions.
+Saved searches are checked for new ads periodically. If ad created since the
+previous check matches saved search, then alert about it is recorded. Limit,
+offset, sort and cursor of saved search aren't used then. User can save up
+to 20 searches. Alerts are removed with their searches and ads.
+
+"base/users/profile/searches" address:
+	method                 GET
+	return result:
+		status 200           JSON array of saved searches of current user
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+
+"base/users/profile/searches" address:
+	method                 POST
+	required parameters:
+		name                 [up to 80 characters] name of search
+	allowed parameters:
+		                                        parameters of search like in "base/ads"
+	return result:
+		status 201           saved search create confirm JSON object
+		status 400:
+			1.           <NoRequiredInfoError>    JSON object of API error
+			2.           <QueryValidError>        JSON object of API error
+			3.           <SortValidError>         JSON object of API error
+			4.           <LocationValidError>     JSON object of API error
+			5.           <TooManySearchesError>   JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <SaveSearchError>        JSON object of API error
+
+"base/users/profile/searches/{id}" address:
+	method                 DELETE
+	id                     must be a digit number
+	return result:
+		status 200           delete succeed
+		status 400           <NoSuchSearchError>      JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <RemoveSearchError>      JSON object of API error
+
+"base/users/profile/alerts" address:
+	method                 GET
+	allowed parameters:
+		limit                [positive number]  maximum number of alerts which will be returned
+		offset               [positive number]  number of the first alert that will be returned
+	return result:
+		status 200           JSON array of alerts of current user from the newest one
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500:
+			1.           <GetInfoDBError>         JSON object of API error
+
 Create new ad
 
 Cookie required for this action.
@@ -252,6 +667,10 @@ Cookie required for this action.
 		price                [positive number]  price of ad
 		country                                 country where ad is provided
 		subway_station                          station where ad is provided
+		latitude             [from -90 to 90]   latitude of location of ad (requires longitude)
+		longitude            [from -180 to 180] longitude of location of ad (requires latitude)
+		category_id          [existing ID]      category of ad
+		ad_images            [finalized addresses] addresses of images uploaded with "base/uploads/new"
 		images               [.JPEG or .png]    images of ad (if provided then all parameters must be in "multipart/form-data")
 	return result:
 		status 201           ad create confirm JSON object
@@ -260,13 +679,18 @@ Cookie required for this action.
 			2.           <RequestFormDecodeError> JSON object of API error
 			3.           <NoRequiredInfoError>    JSON object of API error
 			4.           <RequestDataValidError>  JSON object of API error
+			5.           <ImageNoExistError>      JSON object of API error
+			6.           <LocationValidError>     JSON object of API error
+			7.           <NoSuchCategoryError>    JSON object of API error
 		status 401:
 			1.           <NoCookieError>          JSON object of API error
 			2.           <BadCookieError>         JSON object of API error
+		status 403           <EmailNotVerifiedError>  JSON object of API error
 		status 500:
 			1.           <ImageCreateError>       JSON object of API error
 			2.           <CreateAdError>          JSON object of API error
 			3.           <ResponseCreatingError>  JSON object of API error
+			4.           <GetInfoDBError>         JSON object of API error
 
 Update existing ad
 
@@ -287,6 +711,9 @@ to existing.
 		price                [positive number]     price of ad
 		country                                    country where ad is provided
 		subway_station                             station where ad is provided
+		latitude             [from -90 to 90]      latitude of location of ad (requires longitude)
+		longitude            [from -180 to 180]    longitude of location of ad (requires latitude)
+		category_id          [existing ID]         category of ad
 		ad_images            [existing addresses]  array of existing addresses of ad's images
 		images               [.JPEG or .png]       images of ad (if provided then all parameters must be in "multipart/form-data")
 	return result:
@@ -298,6 +725,8 @@ to existing.
 			4.           <RequestDataValidError>  JSON object of API error
 			5.           <NoAdWithSuchIDError>    JSON object of API error
 			6.           <ImageNoExistError>      JSON object of API error
+			7.           <LocationValidError>     JSON object of API error
+			8.           <NoSuchCategoryError>    JSON object of API error
 		status 401:
 			1.           <NoCookieError>          JSON object of API error
 			2.           <BadCookieError>         JSON object of API error
@@ -329,8 +758,50 @@ Get images
 "base/images/{filename}" address:
 	method                 GET
 	filename               must be existing image
+	headers                Range, If-Modified-Since and If-Range are supported
 	return result:
 		status 200           image with such filename
+		status 206           requested range of image
+		status 304           image isn't modified since provided time
 		status 400           <NoSuchImageError> JSON object of API error
+		status 416           requested range is not satisfiable
+		status 500           <DownloadImgError> JSON object of API error
+
+Upload image directly to storage
+
+Cookie required for this action.
+Images can be uploaded without passing them through API server. Client gets URL,
+uploads image to it with method PUT before expiration and finalizes upload.
+Finalized image is converted to .png and its address can be used in "ad_images"
+of ad or "avatar_address" of user. Upload which isn't finalized is removed later.
+
+"base/uploads/new" address:
+	method                 POST
+	return result:
+		status 201           JSON object with ID, URL, Method, Expires and Ref of upload
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 500           <UploadCreateError> JSON object of API error
+
+"base/uploads/{id}/finalize" address:
+	method                 POST
+	id                     ID of upload returned by "base/uploads/new"
+	return result:
+		status 201           JSON object with address of image
+		status 400:
+			1.           <NoSuchUploadError>      JSON object of API error
+			2.           <ImageSizeError>         JSON object of API error
+			3.           <ImageCreateError>       JSON object of API error
+		status 401:
+			1.           <NoCookieError>          JSON object of API error
+			2.           <BadCookieError>         JSON object of API error
+		status 403           <ForeignUploadError> JSON object of API error
+		status 500:
+			1.           <DownloadImgError>       JSON object of API error
+			2.           <ImageCreateError>       JSON object of API error
+
+"base/storage/{key}" address is used by URLs of uploads if images are stored
+in local filesystem. It returns 404 <UploadStorageError> otherwise.
 */
 package api
@@ -7,30 +7,35 @@
 package api
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"strings"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 )
 
 // TODO: add middleware that checks connection to DB and SM
 
-// checkCookieMiddleware checks authentification of user.
+// checkCookieMiddleware checks authentification of user by cookie
+// or by header Authorization with Bearer scheme.
 func checkCookieMiddleware(m *model.Model, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "application/json")
 
-		cookieSession, err := r.Cookie("session_id")
+		tocken, err := sessionTocken(r)
 		if err == http.ErrNoCookie {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write(apiErrorHandle(requiredCookie, noCookieError, err, noCookieMsg))
 			return
 		}
 
-		_, err = m.CheckSession(&model.SessionID{
-			ID: cookieSession.Value,
+		ctx, cancel := smContext(r)
+		_, err = m.CheckSession(ctx, &model.SessionID{
+			ID: tocken,
 		})
+		cancel()
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write(apiErrorHandle(badCookie, badCookieErr, err, badCookieMsg))
@@ -41,28 +46,33 @@ func checkCookieMiddleware(m *model.Model, next http.Handler) http.Handler {
 	})
 }
 
-// logRequestMiddleware logs incoming request for debugging.
-func logRequestMiddleware(m *model.Model, next http.Handler) http.Handler {
+// timeoutsMiddleware sets deadlines of operations with providers
+// to context of request. They are used by dbContext, smContext and imContext.
+func timeoutsMiddleware(t timeouts, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		byts, _ := httputil.DumpRequest(r, true)
-		log.Println(string(byts))
+		ctx := context.WithValue(r.Context(), timeoutsKey{}, t)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
+// proxyMiddleware replaces address of client by the last address from
+// X-Forwarded-For if proxy is trusted. Proxy adds it, so client can't
+// forge it. Otherwise header is ignored.
+func proxyMiddleware(trust bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if forwarded := r.Header.Get("X-Forwarded-For"); trust && forwarded != "" {
+			addrs := strings.Split(forwarded, ",")
+			r.RemoteAddr = strings.TrimSpace(addrs[len(addrs)-1])
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// checkConnSM checks connection to SM and trying to reconnect if needed
-func checkConnSM(m *model.Model, next http.Handler) http.Handler {
+// logRequestMiddleware logs incoming request for debugging.
+func logRequestMiddleware(m *model.Model, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
-		if !m.IsConnected() {
-			err = m.TryReconnect()
-		}
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write(apiErrorHandle(connectProvider, "ConnSMErr", err, "Can't connect with SM"))
-			return
-		}
+		byts, _ := httputil.DumpRequest(r, true)
+		log.Println(string(byts))
 
 		next.ServeHTTP(w, r)
 	})
@@ -1,14 +1,16 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: bmstu.codes/developers34/SBWeb/pkg/model (interfaces: SM,DB,IM)
+// Source: bmstu.codes/developers34/SBWeb/pkg/model (interfaces: SM,DB,IM,Mailer)
 
 // Package mock_model is a generated GoMock package.
 package mock_model
 
 import (
 	model "bmstu.codes/developers34/SBWeb/pkg/model"
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	io "io"
 	reflect "reflect"
+	time "time"
 )
 
 // MockSM is a mock of SM interface
@@ -35,65 +37,91 @@ func (m *MockSM) EXPECT() *MockSMMockRecorder {
 }
 
 // CheckSession mocks base method
-func (m *MockSM) CheckSession(arg0 *model.SessionID) (*model.Session, error) {
-	ret := m.ctrl.Call(m, "CheckSession", arg0)
+func (m *MockSM) CheckSession(arg0 context.Context, arg1 *model.SessionID) (*model.Session, error) {
+	ret := m.ctrl.Call(m, "CheckSession", arg0, arg1)
 	ret0, _ := ret[0].(*model.Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CheckSession indicates an expected call of CheckSession
-func (mr *MockSMMockRecorder) CheckSession(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckSession", reflect.TypeOf((*MockSM)(nil).CheckSession), arg0)
+func (mr *MockSMMockRecorder) CheckSession(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckSession", reflect.TypeOf((*MockSM)(nil).CheckSession), arg0, arg1)
 }
 
 // CreateSession mocks base method
-func (m *MockSM) CreateSession(arg0 *model.Session, arg1 bool) (*model.SessionID, error) {
-	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1)
+func (m *MockSM) CreateSession(arg0 context.Context, arg1 *model.Session, arg2 bool) (*model.SessionID, error) {
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*model.SessionID)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateSession indicates an expected call of CreateSession
-func (mr *MockSMMockRecorder) CreateSession(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockSM)(nil).CreateSession), arg0, arg1)
+func (mr *MockSMMockRecorder) CreateSession(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockSM)(nil).CreateSession), arg0, arg1, arg2)
 }
 
 // DeleteSession mocks base method
-func (m *MockSM) DeleteSession(arg0 *model.SessionID) error {
-	ret := m.ctrl.Call(m, "DeleteSession", arg0)
+func (m *MockSM) DeleteSession(arg0 context.Context, arg1 *model.SessionID) error {
+	ret := m.ctrl.Call(m, "DeleteSession", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteSession indicates an expected call of DeleteSession
-func (mr *MockSMMockRecorder) DeleteSession(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockSM)(nil).DeleteSession), arg0)
+func (mr *MockSMMockRecorder) DeleteSession(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSession", reflect.TypeOf((*MockSM)(nil).DeleteSession), arg0, arg1)
 }
 
-// IsConnected mocks base method
-func (m *MockSM) IsConnected() bool {
-	ret := m.ctrl.Call(m, "IsConnected")
-	ret0, _ := ret[0].(bool)
-	return ret0
+// DeleteUserSession mocks base method
+func (m *MockSM) DeleteUserSession(arg0 context.Context, arg1 int64, arg2 string) (int64, error) {
+	ret := m.ctrl.Call(m, "DeleteUserSession", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// IsConnected indicates an expected call of IsConnected
-func (mr *MockSMMockRecorder) IsConnected() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsConnected", reflect.TypeOf((*MockSM)(nil).IsConnected))
+// DeleteUserSession indicates an expected call of DeleteUserSession
+func (mr *MockSMMockRecorder) DeleteUserSession(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserSession", reflect.TypeOf((*MockSM)(nil).DeleteUserSession), arg0, arg1, arg2)
 }
 
-// TryReconnect mocks base method
-func (m *MockSM) TryReconnect() error {
-	ret := m.ctrl.Call(m, "TryReconnect")
+// DeleteUserSessions mocks base method
+func (m *MockSM) DeleteUserSessions(arg0 context.Context, arg1 int64, arg2 *model.SessionID) error {
+	ret := m.ctrl.Call(m, "DeleteUserSessions", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// TryReconnect indicates an expected call of TryReconnect
-func (mr *MockSMMockRecorder) TryReconnect() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryReconnect", reflect.TypeOf((*MockSM)(nil).TryReconnect))
+// DeleteUserSessions indicates an expected call of DeleteUserSessions
+func (mr *MockSMMockRecorder) DeleteUserSessions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserSessions", reflect.TypeOf((*MockSM)(nil).DeleteUserSessions), arg0, arg1, arg2)
+}
+
+// GetUserSessions mocks base method
+func (m *MockSM) GetUserSessions(arg0 context.Context, arg1 int64) ([]*model.Session, error) {
+	ret := m.ctrl.Call(m, "GetUserSessions", arg0, arg1)
+	ret0, _ := ret[0].([]*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions
+func (mr *MockSMMockRecorder) GetUserSessions(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockSM)(nil).GetUserSessions), arg0, arg1)
+}
+
+// IsConnected mocks base method
+func (m *MockSM) IsConnected(arg0 context.Context) bool {
+	ret := m.ctrl.Call(m, "IsConnected", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsConnected indicates an expected call of IsConnected
+func (mr *MockSMMockRecorder) IsConnected(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsConnected", reflect.TypeOf((*MockSM)(nil).IsConnected), arg0)
 }
 
 // MockDB is a mock of DB interface
@@ -119,147 +147,417 @@ func (m *MockDB) EXPECT() *MockDBMockRecorder {
 	return m.recorder
 }
 
+// AddAlerts mocks base method
+func (m *MockDB) AddAlerts(arg0 context.Context, arg1 int64, arg2 []int64, arg3 time.Time) ([]int64, error) {
+	ret := m.ctrl.Call(m, "AddAlerts", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddAlerts indicates an expected call of AddAlerts
+func (mr *MockDBMockRecorder) AddAlerts(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAlerts", reflect.TypeOf((*MockDB)(nil).AddAlerts), arg0, arg1, arg2, arg3)
+}
+
+// AddToken mocks base method
+func (m *MockDB) AddToken(arg0 context.Context, arg1 *model.Token) error {
+	ret := m.ctrl.Call(m, "AddToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddToken indicates an expected call of AddToken
+func (mr *MockDBMockRecorder) AddToken(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToken", reflect.TypeOf((*MockDB)(nil).AddToken), arg0, arg1)
+}
+
+// ConfirmNewEmail mocks base method
+func (m *MockDB) ConfirmNewEmail(arg0 context.Context, arg1 int64) (int64, error) {
+	ret := m.ctrl.Call(m, "ConfirmNewEmail", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmNewEmail indicates an expected call of ConfirmNewEmail
+func (mr *MockDBMockRecorder) ConfirmNewEmail(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmNewEmail", reflect.TypeOf((*MockDB)(nil).ConfirmNewEmail), arg0, arg1)
+}
+
+// CountAds mocks base method
+func (m *MockDB) CountAds(arg0 context.Context, arg1 *model.SearchParams) (int64, error) {
+	ret := m.ctrl.Call(m, "CountAds", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountAds indicates an expected call of CountAds
+func (mr *MockDBMockRecorder) CountAds(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountAds", reflect.TypeOf((*MockDB)(nil).CountAds), arg0, arg1)
+}
+
 // EditAd mocks base method
-func (m *MockDB) EditAd(arg0 *model.AdItem) (int64, error) {
-	ret := m.ctrl.Call(m, "EditAd", arg0)
+func (m *MockDB) EditAd(arg0 context.Context, arg1 *model.AdItem) (int64, error) {
+	ret := m.ctrl.Call(m, "EditAd", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // EditAd indicates an expected call of EditAd
-func (mr *MockDBMockRecorder) EditAd(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditAd", reflect.TypeOf((*MockDB)(nil).EditAd), arg0)
+func (mr *MockDBMockRecorder) EditAd(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditAd", reflect.TypeOf((*MockDB)(nil).EditAd), arg0, arg1)
+}
+
+// EditPassword mocks base method
+func (m *MockDB) EditPassword(arg0 context.Context, arg1 int64, arg2 string) (int64, error) {
+	ret := m.ctrl.Call(m, "EditPassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EditPassword indicates an expected call of EditPassword
+func (mr *MockDBMockRecorder) EditPassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditPassword", reflect.TypeOf((*MockDB)(nil).EditPassword), arg0, arg1, arg2)
 }
 
 // EditUser mocks base method
-func (m *MockDB) EditUser(arg0 *model.User) (int64, error) {
-	ret := m.ctrl.Call(m, "EditUser", arg0)
+func (m *MockDB) EditUser(arg0 context.Context, arg1 *model.User) (int64, error) {
+	ret := m.ctrl.Call(m, "EditUser", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // EditUser indicates an expected call of EditUser
-func (mr *MockDBMockRecorder) EditUser(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditUser", reflect.TypeOf((*MockDB)(nil).EditUser), arg0)
+func (mr *MockDBMockRecorder) EditUser(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditUser", reflect.TypeOf((*MockDB)(nil).EditUser), arg0, arg1)
 }
 
 // GetAd mocks base method
-func (m *MockDB) GetAd(arg0 int64) (*model.AdItem, error) {
-	ret := m.ctrl.Call(m, "GetAd", arg0)
+func (m *MockDB) GetAd(arg0 context.Context, arg1 int64) (*model.AdItem, error) {
+	ret := m.ctrl.Call(m, "GetAd", arg0, arg1)
 	ret0, _ := ret[0].(*model.AdItem)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAd indicates an expected call of GetAd
-func (mr *MockDBMockRecorder) GetAd(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAd", reflect.TypeOf((*MockDB)(nil).GetAd), arg0)
+func (mr *MockDBMockRecorder) GetAd(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAd", reflect.TypeOf((*MockDB)(nil).GetAd), arg0, arg1)
 }
 
 // GetAds mocks base method
-func (m *MockDB) GetAds(arg0 *model.SearchParams) ([]*model.AdItem, error) {
-	ret := m.ctrl.Call(m, "GetAds", arg0)
+func (m *MockDB) GetAds(arg0 context.Context, arg1 *model.SearchParams) ([]*model.AdItem, error) {
+	ret := m.ctrl.Call(m, "GetAds", arg0, arg1)
 	ret0, _ := ret[0].([]*model.AdItem)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAds indicates an expected call of GetAds
-func (mr *MockDBMockRecorder) GetAds(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAds", reflect.TypeOf((*MockDB)(nil).GetAds), arg0)
+func (mr *MockDBMockRecorder) GetAds(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAds", reflect.TypeOf((*MockDB)(nil).GetAds), arg0, arg1)
 }
 
 // GetAdsOfUser mocks base method
-func (m *MockDB) GetAdsOfUser(arg0 int64) ([]*model.AdItem, error) {
-	ret := m.ctrl.Call(m, "GetAdsOfUser", arg0)
+func (m *MockDB) GetAdsOfUser(arg0 context.Context, arg1 int64, arg2 string) ([]*model.AdItem, error) {
+	ret := m.ctrl.Call(m, "GetAdsOfUser", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]*model.AdItem)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAdsOfUser indicates an expected call of GetAdsOfUser
-func (mr *MockDBMockRecorder) GetAdsOfUser(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAdsOfUser", reflect.TypeOf((*MockDB)(nil).GetAdsOfUser), arg0)
+func (mr *MockDBMockRecorder) GetAdsOfUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAdsOfUser", reflect.TypeOf((*MockDB)(nil).GetAdsOfUser), arg0, arg1, arg2)
+}
+
+// GetAlerts mocks base method
+func (m *MockDB) GetAlerts(arg0 context.Context, arg1 int64, arg2 int, arg3 int) ([]*model.Alert, error) {
+	ret := m.ctrl.Call(m, "GetAlerts", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*model.Alert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAlerts indicates an expected call of GetAlerts
+func (mr *MockDBMockRecorder) GetAlerts(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlerts", reflect.TypeOf((*MockDB)(nil).GetAlerts), arg0, arg1, arg2, arg3)
+}
+
+// GetAllSavedSearches mocks base method
+func (m *MockDB) GetAllSavedSearches(arg0 context.Context) ([]*model.SavedSearch, error) {
+	ret := m.ctrl.Call(m, "GetAllSavedSearches", arg0)
+	ret0, _ := ret[0].([]*model.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllSavedSearches indicates an expected call of GetAllSavedSearches
+func (mr *MockDBMockRecorder) GetAllSavedSearches(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllSavedSearches", reflect.TypeOf((*MockDB)(nil).GetAllSavedSearches), arg0)
+}
+
+// GetCategories mocks base method
+func (m *MockDB) GetCategories(arg0 context.Context) ([]*model.Category, error) {
+	ret := m.ctrl.Call(m, "GetCategories", arg0)
+	ret0, _ := ret[0].([]*model.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategories indicates an expected call of GetCategories
+func (mr *MockDBMockRecorder) GetCategories(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockDB)(nil).GetCategories), arg0)
+}
+
+// GetFacets mocks base method
+func (m *MockDB) GetFacets(arg0 context.Context, arg1 *model.SearchParams) (*model.Facets, error) {
+	ret := m.ctrl.Call(m, "GetFacets", arg0, arg1)
+	ret0, _ := ret[0].(*model.Facets)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFacets indicates an expected call of GetFacets
+func (mr *MockDBMockRecorder) GetFacets(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFacets", reflect.TypeOf((*MockDB)(nil).GetFacets), arg0, arg1)
+}
+
+// GetImages mocks base method
+func (m *MockDB) GetImages(arg0 context.Context) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetImages", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImages indicates an expected call of GetImages
+func (mr *MockDBMockRecorder) GetImages(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImages", reflect.TypeOf((*MockDB)(nil).GetImages), arg0)
+}
+
+// GetSavedSearches mocks base method
+func (m *MockDB) GetSavedSearches(arg0 context.Context, arg1 int64) ([]*model.SavedSearch, error) {
+	ret := m.ctrl.Call(m, "GetSavedSearches", arg0, arg1)
+	ret0, _ := ret[0].([]*model.SavedSearch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSavedSearches indicates an expected call of GetSavedSearches
+func (mr *MockDBMockRecorder) GetSavedSearches(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSavedSearches", reflect.TypeOf((*MockDB)(nil).GetSavedSearches), arg0, arg1)
+}
+
+// GetSimilarWords mocks base method
+func (m *MockDB) GetSimilarWords(arg0 context.Context, arg1 string, arg2 int) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetSimilarWords", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSimilarWords indicates an expected call of GetSimilarWords
+func (mr *MockDBMockRecorder) GetSimilarWords(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSimilarWords", reflect.TypeOf((*MockDB)(nil).GetSimilarWords), arg0, arg1, arg2)
+}
+
+// GetSuggestions mocks base method
+func (m *MockDB) GetSuggestions(arg0 context.Context, arg1 string, arg2 int) ([]*model.Suggestion, error) {
+	ret := m.ctrl.Call(m, "GetSuggestions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*model.Suggestion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSuggestions indicates an expected call of GetSuggestions
+func (mr *MockDBMockRecorder) GetSuggestions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSuggestions", reflect.TypeOf((*MockDB)(nil).GetSuggestions), arg0, arg1, arg2)
 }
 
 // GetUserWithEmail mocks base method
-func (m *MockDB) GetUserWithEmail(arg0 string) (*model.User, error) {
-	ret := m.ctrl.Call(m, "GetUserWithEmail", arg0)
+func (m *MockDB) GetUserWithEmail(arg0 context.Context, arg1 string) (*model.User, error) {
+	ret := m.ctrl.Call(m, "GetUserWithEmail", arg0, arg1)
 	ret0, _ := ret[0].(*model.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserWithEmail indicates an expected call of GetUserWithEmail
-func (mr *MockDBMockRecorder) GetUserWithEmail(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWithEmail", reflect.TypeOf((*MockDB)(nil).GetUserWithEmail), arg0)
+func (mr *MockDBMockRecorder) GetUserWithEmail(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWithEmail", reflect.TypeOf((*MockDB)(nil).GetUserWithEmail), arg0, arg1)
 }
 
 // GetUserWithID mocks base method
-func (m *MockDB) GetUserWithID(arg0 int64) (*model.User, error) {
-	ret := m.ctrl.Call(m, "GetUserWithID", arg0)
+func (m *MockDB) GetUserWithID(arg0 context.Context, arg1 int64) (*model.User, error) {
+	ret := m.ctrl.Call(m, "GetUserWithID", arg0, arg1)
 	ret0, _ := ret[0].(*model.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserWithID indicates an expected call of GetUserWithID
-func (mr *MockDBMockRecorder) GetUserWithID(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWithID", reflect.TypeOf((*MockDB)(nil).GetUserWithID), arg0)
+func (mr *MockDBMockRecorder) GetUserWithID(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWithID", reflect.TypeOf((*MockDB)(nil).GetUserWithID), arg0, arg1)
 }
 
 // NewAd mocks base method
-func (m *MockDB) NewAd(arg0 *model.AdItem) (int64, error) {
-	ret := m.ctrl.Call(m, "NewAd", arg0)
+func (m *MockDB) NewAd(arg0 context.Context, arg1 *model.AdItem) (int64, error) {
+	ret := m.ctrl.Call(m, "NewAd", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // NewAd indicates an expected call of NewAd
-func (mr *MockDBMockRecorder) NewAd(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewAd", reflect.TypeOf((*MockDB)(nil).NewAd), arg0)
+func (mr *MockDBMockRecorder) NewAd(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewAd", reflect.TypeOf((*MockDB)(nil).NewAd), arg0, arg1)
+}
+
+// NewSavedSearch mocks base method
+func (m *MockDB) NewSavedSearch(arg0 context.Context, arg1 *model.SavedSearch, arg2 int) (int64, error) {
+	ret := m.ctrl.Call(m, "NewSavedSearch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewSavedSearch indicates an expected call of NewSavedSearch
+func (mr *MockDBMockRecorder) NewSavedSearch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewSavedSearch", reflect.TypeOf((*MockDB)(nil).NewSavedSearch), arg0, arg1, arg2)
+}
+
+// NewToken mocks base method
+func (m *MockDB) NewToken(arg0 context.Context, arg1 *model.Token) error {
+	ret := m.ctrl.Call(m, "NewToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NewToken indicates an expected call of NewToken
+func (mr *MockDBMockRecorder) NewToken(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewToken", reflect.TypeOf((*MockDB)(nil).NewToken), arg0, arg1)
 }
 
 // NewUser mocks base method
-func (m *MockDB) NewUser(arg0 *model.User) (int64, error) {
-	ret := m.ctrl.Call(m, "NewUser", arg0)
+func (m *MockDB) NewUser(arg0 context.Context, arg1 *model.User) (int64, error) {
+	ret := m.ctrl.Call(m, "NewUser", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // NewUser indicates an expected call of NewUser
-func (mr *MockDBMockRecorder) NewUser(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewUser", reflect.TypeOf((*MockDB)(nil).NewUser), arg0)
+func (mr *MockDBMockRecorder) NewUser(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewUser", reflect.TypeOf((*MockDB)(nil).NewUser), arg0, arg1)
 }
 
 // RemoveAd mocks base method
-func (m *MockDB) RemoveAd(arg0 int64) (int64, error) {
-	ret := m.ctrl.Call(m, "RemoveAd", arg0)
+func (m *MockDB) RemoveAd(arg0 context.Context, arg1 int64) (int64, error) {
+	ret := m.ctrl.Call(m, "RemoveAd", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // RemoveAd indicates an expected call of RemoveAd
-func (mr *MockDBMockRecorder) RemoveAd(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveAd", reflect.TypeOf((*MockDB)(nil).RemoveAd), arg0)
+func (mr *MockDBMockRecorder) RemoveAd(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveAd", reflect.TypeOf((*MockDB)(nil).RemoveAd), arg0, arg1)
+}
+
+// RemoveSavedSearch mocks base method
+func (m *MockDB) RemoveSavedSearch(arg0 context.Context, arg1 int64, arg2 int64) (int64, error) {
+	ret := m.ctrl.Call(m, "RemoveSavedSearch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveSavedSearch indicates an expected call of RemoveSavedSearch
+func (mr *MockDBMockRecorder) RemoveSavedSearch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSavedSearch", reflect.TypeOf((*MockDB)(nil).RemoveSavedSearch), arg0, arg1, arg2)
+}
+
+// RemoveTokens mocks base method
+func (m *MockDB) RemoveTokens(arg0 context.Context, arg1 int64, arg2 string) (int64, error) {
+	ret := m.ctrl.Call(m, "RemoveTokens", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveTokens indicates an expected call of RemoveTokens
+func (mr *MockDBMockRecorder) RemoveTokens(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTokens", reflect.TypeOf((*MockDB)(nil).RemoveTokens), arg0, arg1, arg2)
 }
 
 // RemoveUser mocks base method
-func (m *MockDB) RemoveUser(arg0 int64) (int64, error) {
-	ret := m.ctrl.Call(m, "RemoveUser", arg0)
+func (m *MockDB) RemoveUser(arg0 context.Context, arg1 int64) (int64, error) {
+	ret := m.ctrl.Call(m, "RemoveUser", arg0, arg1)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // RemoveUser indicates an expected call of RemoveUser
-func (mr *MockDBMockRecorder) RemoveUser(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveUser", reflect.TypeOf((*MockDB)(nil).RemoveUser), arg0)
+func (mr *MockDBMockRecorder) RemoveUser(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveUser", reflect.TypeOf((*MockDB)(nil).RemoveUser), arg0, arg1)
+}
+
+// SetNewEmail mocks base method
+func (m *MockDB) SetNewEmail(arg0 context.Context, arg1 int64, arg2 string) (int64, error) {
+	ret := m.ctrl.Call(m, "SetNewEmail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetNewEmail indicates an expected call of SetNewEmail
+func (mr *MockDBMockRecorder) SetNewEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNewEmail", reflect.TypeOf((*MockDB)(nil).SetNewEmail), arg0, arg1, arg2)
+}
+
+// UseToken mocks base method
+func (m *MockDB) UseToken(arg0 context.Context, arg1 string, arg2 string) (int64, error) {
+	ret := m.ctrl.Call(m, "UseToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseToken indicates an expected call of UseToken
+func (mr *MockDBMockRecorder) UseToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseToken", reflect.TypeOf((*MockDB)(nil).UseToken), arg0, arg1, arg2)
+}
+
+// VerifyEmail mocks base method
+func (m *MockDB) VerifyEmail(arg0 context.Context, arg1 int64) (int64, error) {
+	ret := m.ctrl.Call(m, "VerifyEmail", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail
+func (mr *MockDBMockRecorder) VerifyEmail(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockDB)(nil).VerifyEmail), arg0, arg1)
+}
+
+// WithTx mocks base method
+func (m *MockDB) WithTx(arg0 context.Context, arg1 func(model.DB) error) error {
+	ret := m.ctrl.Call(m, "WithTx", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx
+func (mr *MockDBMockRecorder) WithTx(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockDB)(nil).WithTx), arg0, arg1)
 }
 
 // MockIM is a mock of IM interface
@@ -286,50 +584,112 @@ func (m *MockIM) EXPECT() *MockIMMockRecorder {
 }
 
 // DeleteImage mocks base method
-func (m *MockIM) DeleteImage(arg0 string) error {
-	ret := m.ctrl.Call(m, "DeleteImage", arg0)
+func (m *MockIM) DeleteImage(arg0 context.Context, arg1 string) error {
+	ret := m.ctrl.Call(m, "DeleteImage", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteImage indicates an expected call of DeleteImage
-func (mr *MockIMMockRecorder) DeleteImage(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteImage", reflect.TypeOf((*MockIM)(nil).DeleteImage), arg0)
+func (mr *MockIMMockRecorder) DeleteImage(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteImage", reflect.TypeOf((*MockIM)(nil).DeleteImage), arg0, arg1)
 }
 
-// DownloadImage mocks base method
-func (m *MockIM) DownloadImage(arg0 string) error {
-	ret := m.ctrl.Call(m, "DownloadImage", arg0)
-	ret0, _ := ret[0].(error)
+// IsExist mocks base method
+func (m *MockIM) IsExist(arg0 context.Context, arg1 string) bool {
+	ret := m.ctrl.Call(m, "IsExist", arg0, arg1)
+	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-// DownloadImage indicates an expected call of DownloadImage
-func (mr *MockIMMockRecorder) DownloadImage(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadImage", reflect.TypeOf((*MockIM)(nil).DownloadImage), arg0)
+// IsExist indicates an expected call of IsExist
+func (mr *MockIMMockRecorder) IsExist(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExist", reflect.TypeOf((*MockIM)(nil).IsExist), arg0, arg1)
 }
 
-// IsExist mocks base method
-func (m *MockIM) IsExist(arg0 string) bool {
-	ret := m.ctrl.Call(m, "IsExist", arg0)
-	ret0, _ := ret[0].(bool)
-	return ret0
+// ListImages mocks base method
+func (m *MockIM) ListImages(arg0 context.Context) ([]*model.ImageInfo, error) {
+	ret := m.ctrl.Call(m, "ListImages", arg0)
+	ret0, _ := ret[0].([]*model.ImageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// IsExist indicates an expected call of IsExist
-func (mr *MockIMMockRecorder) IsExist(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsExist", reflect.TypeOf((*MockIM)(nil).IsExist), arg0)
+// ListImages indicates an expected call of ListImages
+func (mr *MockIMMockRecorder) ListImages(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListImages", reflect.TypeOf((*MockIM)(nil).ListImages), arg0)
+}
+
+// PresignUpload mocks base method
+func (m *MockIM) PresignUpload(arg0 context.Context, arg1 string, arg2 time.Duration) (string, error) {
+	ret := m.ctrl.Call(m, "PresignUpload", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PresignUpload indicates an expected call of PresignUpload
+func (mr *MockIMMockRecorder) PresignUpload(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresignUpload", reflect.TypeOf((*MockIM)(nil).PresignUpload), arg0, arg1, arg2)
+}
+
+// ReadImage mocks base method
+func (m *MockIM) ReadImage(arg0 context.Context, arg1 string, arg2 int64) (*model.Image, error) {
+	ret := m.ctrl.Call(m, "ReadImage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*model.Image)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadImage indicates an expected call of ReadImage
+func (mr *MockIMMockRecorder) ReadImage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadImage", reflect.TypeOf((*MockIM)(nil).ReadImage), arg0, arg1, arg2)
 }
 
 // UploadImage mocks base method
-func (m *MockIM) UploadImage(arg0 string, arg1 io.Reader) (string, error) {
-	ret := m.ctrl.Call(m, "UploadImage", arg0, arg1)
+func (m *MockIM) UploadImage(arg0 context.Context, arg1 string, arg2 io.Reader) (string, error) {
+	ret := m.ctrl.Call(m, "UploadImage", arg0, arg1, arg2)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UploadImage indicates an expected call of UploadImage
-func (mr *MockIMMockRecorder) UploadImage(arg0, arg1 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadImage", reflect.TypeOf((*MockIM)(nil).UploadImage), arg0, arg1)
+func (mr *MockIMMockRecorder) UploadImage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadImage", reflect.TypeOf((*MockIM)(nil).UploadImage), arg0, arg1, arg2)
+}
+
+// MockMailer is a mock of Mailer interface
+type MockMailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerMockRecorder
+}
+
+// MockMailerMockRecorder is the mock recorder for MockMailer
+type MockMailerMockRecorder struct {
+	mock *MockMailer
+}
+
+// NewMockMailer creates a new mock instance
+func NewMockMailer(ctrl *gomock.Controller) *MockMailer {
+	mock := &MockMailer{ctrl: ctrl}
+	mock.recorder = &MockMailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
+	return m.recorder
+}
+
+// SendMail mocks base method
+func (m *MockMailer) SendMail(arg0 context.Context, arg1 *model.Mail) error {
+	ret := m.ctrl.Call(m, "SendMail", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMail indicates an expected call of SendMail
+func (mr *MockMailerMockRecorder) SendMail(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMail", reflect.TypeOf((*MockMailer)(nil).SendMail), arg0, arg1)
 }
@@ -0,0 +1,175 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// pagination.go contains paginated response of list of ads
+// and cursors of keyset pagination.
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// adsPage is a paginated response of list of ads which is sent
+// if client requests version 2 of response. Next and Prev are
+// references to the next and previous pages (without base part).
+// NextCursor and PrevCursor are set if order of ads allows keyset
+// pagination. Facets are set if client requests them. Fuzzy is set if ads
+// are found by fuzzy search; then DidYouMean has corrected queries.
+type adsPage struct {
+	Items      []*model.AdItem `json:"items"`
+	Total      int64           `json:"total"`
+	Limit      int             `json:"limit"`
+	Offset     int             `json:"offset"`
+	Next       string          `json:"next,omitempty"`
+	Prev       string          `json:"prev,omitempty"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+	Facets     *model.Facets   `json:"facets,omitempty"`
+	Fuzzy      bool            `json:"fuzzy,omitempty"`
+	DidYouMean []string        `json:"did_you_mean,omitempty"`
+}
+
+// includes checks if parameter include of request
+// has such value. Values are separated by commas.
+func includes(r *http.Request, value string) bool {
+	for _, v := range strings.Split(r.FormValue("include"), ",") {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isKeysetOrder checks if order of ads allows keyset
+// pagination, i.e. ads are ordered by time of creation.
+func isKeysetOrder(sp *model.SearchParams) bool {
+	switch sp.Sort {
+	case model.SortOldest, model.SortNewest:
+		return true
+	case "":
+		return sp.Query == ""
+	}
+	return false
+}
+
+// encodeCursor returns opaque cursor which points to ad. Cursor
+// is backward if it's used to get ads which precede ad.
+func encodeCursor(ad *model.AdItem, backward bool) string {
+	direction := "a"
+	if backward {
+		direction = "b"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" +
+		strconv.FormatInt(ad.CreationTime.UnixNano(), 10) + ":" +
+		strconv.FormatInt(ad.ID, 10)))
+}
+
+// decodeCursor sets cursor of search parameters. It returns false
+// if cursor is malformed.
+func decodeCursor(cursor string, sp *model.SearchParams) bool {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") {
+		return false
+	}
+	nsec, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || id <= 0 {
+		return false
+	}
+
+	sp.CursorTime = time.Unix(0, nsec).UTC()
+	sp.CursorID = id
+	sp.Backward = parts[0] == "b"
+	return true
+}
+
+// newAdsPage creates page of ads. Ads must be requested with limit greater
+// by one than sp.Limit to know if there are more ads in direction of request.
+func newAdsPage(r *http.Request, sp *model.SearchParams, ads []*model.AdItem, total int64) *adsPage {
+	hasMore := len(ads) > sp.Limit
+	if hasMore && sp.Backward {
+		// the extra ad precedes the others
+		ads = ads[1:]
+	} else if hasMore {
+		ads = ads[:sp.Limit]
+	}
+
+	page := &adsPage{
+		Items:  ads,
+		Total:  total,
+		Limit:  sp.Limit,
+		Offset: sp.Offset,
+		Fuzzy:  sp.IsFuzzy(),
+	}
+
+	hasNext, hasPrev := hasMore, sp.Offset > 0
+	if sp.CursorID > 0 {
+		// page which is requested by cursor has neighbour
+		// in the opposite direction of request
+		hasNext, hasPrev = true, true
+		if sp.Backward {
+			hasPrev = hasMore
+		} else {
+			hasNext = hasMore
+		}
+	}
+
+	keyset := isKeysetOrder(sp) && len(ads) != 0
+	if hasNext && keyset {
+		page.NextCursor = encodeCursor(ads[len(ads)-1], false)
+	}
+	if hasPrev && keyset {
+		page.PrevCursor = encodeCursor(ads[0], true)
+	}
+
+	switch {
+	case sp.CursorID > 0:
+		if page.NextCursor != "" {
+			page.Next = pageLink(r, sp, "cursor", page.NextCursor)
+		}
+		if page.PrevCursor != "" {
+			page.Prev = pageLink(r, sp, "cursor", page.PrevCursor)
+		}
+	default:
+		if hasNext {
+			page.Next = pageLink(r, sp, "offset", strconv.Itoa(sp.Offset+sp.Limit))
+		}
+		if hasPrev {
+			prev := sp.Offset - sp.Limit
+			if prev < 0 {
+				prev = 0
+			}
+			page.Prev = pageLink(r, sp, "offset", strconv.Itoa(prev))
+		}
+	}
+
+	return page
+}
+
+// pageLink returns reference to page of request with parameter key (offset
+// or cursor) set to value. Fuzzy search is kept on pages after fallback to it.
+func pageLink(r *http.Request, sp *model.SearchParams, key, value string) string {
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Del("cursor")
+	query.Set(key, value)
+	if sp.IsFuzzy() {
+		query.Set("fuzzy", "true")
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,220 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// password.go contains handlers of reset and change of password of user.
+
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/asaskevich/govalidator"
+	"golang.org/x/crypto/bcrypt"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// forgotPasswordPage handles */users/password/forgot with method POST. Sends token
+// of reset of password to email from parameter email. Status is OK even if there is
+// no user with such email or token isn't sent, so client can't find out emails of users.
+func forgotPasswordPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		email := r.FormValue("email")
+		if email == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterRequiredInfoForgot, requiredinfoErr,
+				errors.New("Client didn't sent email"), requiredEmailMsg))
+			return
+		}
+
+		// trying to find user with such email in database;
+		// failures are only logged without email
+		ctx, cancel := dbContext(r)
+		user, err := m.GetUserWithEmail(ctx, email)
+		cancel()
+		switch {
+		case user.ID == -1:
+			// unknown email isn't logged
+		case err != nil:
+			log.Println("Can't get user to reset password", err.Error())
+		default:
+			forgotPassword(r, m, user)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// resetPasswordPage handles */users/password/reset with method POST. Replaces
+// password of user by parameter password if parameter token is valid. Token can
+// be used once. All sessions and refresh tokens of user are deleted on success.
+func resetPasswordPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		token := r.FormValue("token")
+		password := r.FormValue("password")
+		if token == "" || password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterRequiredInfoReset, requiredinfoErr,
+				errors.New("Client didn't sent required info"), requiredinfoMsgReset))
+			return
+		}
+		if !govalidator.IsPrintableASCII(password) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(validRequiredPassword, reqValidErr,
+				errors.New("Password isn't printable ASCII"), reqValidMsg))
+			return
+		}
+
+		// make hash from incoming password
+		hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+		// token is removed only if password is replaced
+		var userID int64
+		ctx, cancel := dbContext(r)
+		err := m.WithTx(ctx, func(tx model.DB) error {
+			var err error
+			userID, err = tx.UseToken(ctx, model.HashToken(token), model.TokenResetPassword)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.EditPassword(ctx, userID, string(hash)); err != nil {
+				return err
+			}
+			_, err = tx.RemoveTokens(ctx, userID, model.TokenRefresh)
+			return err
+		})
+		cancel()
+		if userID == -1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidToken, badTokenErr, err, badTokenMsg))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		// sessions which were created with old password are deleted
+		ctx, cancel = smContext(r)
+		err = m.DeleteUserSessions(ctx, userID, nil)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sessDelErr, err, sessDelMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// changePasswordPage handles */users/profile/password with method POST. Requires
+// checkCookieMiddleware. Replaces password of current user by parameter new_password
+// if parameter password is current password. Other sessions and all refresh tokens
+// of user are deleted.
+func changePasswordPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		password := r.FormValue("password")
+		newPassword := r.FormValue("new_password")
+		if password == "" || newPassword == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterRequiredInfoChange, requiredinfoErr,
+				errors.New("Client didn't sent required info"), requiredinfoMsgChange))
+			return
+		}
+		if !govalidator.IsPrintableASCII(newPassword) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(validRequiredPassword, reqValidErr,
+				errors.New("Password isn't printable ASCII"), reqValidMsg))
+			return
+		}
+
+		// check current password
+		userID := getIDfromCookie(m, r)
+		ok, err := checkPassword(r, m, userID, password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidPassword, badAuthErr,
+				errors.New("Client has entered wrong password"), badPasswordMsg))
+			return
+		}
+
+		// make hash from incoming password
+		hash, _ := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+
+		ctx, cancel := dbContext(r)
+		err = m.WithTx(ctx, func(tx model.DB) error {
+			if _, err := tx.EditPassword(ctx, userID, string(hash)); err != nil {
+				return err
+			}
+			_, err := tx.RemoveTokens(ctx, userID, model.TokenRefresh)
+			return err
+		})
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		// current session is kept
+		tocken, _ := sessionTocken(r)
+		ctx, cancel = smContext(r)
+		err = m.DeleteUserSessions(ctx, userID, &model.SessionID{ID: tocken})
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sessDelErr, err, sessDelMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// forgotPassword creates token of reset of password and sends it to email
+// of user. Failures are logged with ID of user instead of email.
+func forgotPassword(r *http.Request, m *model.Model, user *model.User) {
+	ctx, cancel := dbContext(r)
+	token, err := newUserToken(ctx, m, user.ID, model.TokenResetPassword,
+		requestTimeouts(r).reset)
+	cancel()
+	if err != nil {
+		log.Println("Can't create token of reset of password of user", user.ID, err.Error())
+		return
+	}
+	if err = sendPasswordReset(r, m, user, token); err != nil {
+		log.Println("Can't send token of reset of password to user", user.ID, err.Error())
+	}
+}
+
+// sendPasswordReset sends token of reset of password to email of user.
+func sendPasswordReset(r *http.Request, m *model.Model, user *model.User, token string) error {
+	ctx, cancel := mailContext(r)
+	defer cancel()
+	return m.SendMail(ctx, &model.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hello, " + user.FirstName + "!\n\n" +
+			"To reset your password send new password with this link:\n" +
+			domain + "/users/password/reset?token=" + url.QueryEscape(token) + "\n\n" +
+			"or enter this code in the application:\n" + token + "\n\n" +
+			"If you didn't request reset of password, ignore this mail.\n",
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// searches.go contains handlers of saved searches of user
+// and alerts about new ads which match them.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// maxSavedSearches is a maximal number of searches saved by one user
+const maxSavedSearches = 20
+
+// savedSearchesPage handles */users/profile/searches with method GET. Requires checkCookieMiddleware.
+// Returns JSON array of searches saved by current user.
+func savedSearchesPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// get saved searches from DB
+		ctx, cancel := dbContext(r)
+		searches, err := m.GetSavedSearches(ctx, getIDfromCookie(m, r))
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		searchesData, _ := json.Marshal(searches)
+
+		// send response
+		w.WriteHeader(http.StatusOK)
+		w.Write(searchesData)
+	})
+}
+
+// savedSearchCreatePage handles */users/profile/searches with method POST. Requires checkCookieMiddleware.
+// Saves search with name and parameters of search of ads from request.
+func savedSearchCreatePage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// get parameters of search from request
+		search := model.SavedSearch{
+			UserID: getIDfromCookie(m, r),
+			Params: decodeSearchParams(r),
+			Name:   r.FormValue("name"),
+		}
+		if search.Name == "" || utf8.RuneCountInString(search.Name) > 80 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, requiredinfoErr,
+				errors.New("Client didn't sent name of search"), requiredInfoSearchMsg))
+			return
+		}
+		if !checkSearchParams(w, &search.Params) {
+			return
+		}
+
+		// save search if user has not too many of them
+		ctx, cancel := dbContext(r)
+		id, err := m.NewSavedSearch(ctx, &search, maxSavedSearches)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, addSearchDBErr, err, addSearchDBMsg))
+			return
+		}
+		if id == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, tooManySearchesErr,
+				errors.New("User has too many saved searches"), tooManySearchesMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		searchData, _ := json.Marshal(struct {
+			ID  int64
+			Ref string
+		}{
+			ID:  id,
+			Ref: "/users/profile/searches",
+		})
+
+		// send response
+		w.WriteHeader(http.StatusCreated)
+		w.Write(searchData)
+	})
+}
+
+// savedSearchDeletePage handles */users/profile/searches/{id:[0-9]+} with method DELETE.
+// Requires checkCookieMiddleware. Removes search saved by current user and its alerts.
+func savedSearchDeletePage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// take id from url
+		idStr, _ := mux.Vars(r)["id"]
+		id, _ := strconv.ParseInt(idStr, 10, 64)
+
+		// remove search only of current user
+		ctx, cancel := dbContext(r)
+		affected, err := m.RemoveSavedSearch(ctx, getIDfromCookie(m, r), id)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, removeSearchDBErr, err, removeSearchDBMsg))
+			return
+		}
+		if affected == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterExID, searchIDErr,
+				errors.New("Client entered wrong ID of search"), searchIDMsg))
+			return
+		}
+
+		// send response
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// alertsPage handles */users/profile/alerts with method GET. Requires checkCookieMiddleware.
+// Returns JSON array of alerts of current user from the newest one.
+func alertsPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// take params from request, invalid values are ignored
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		offset, _ := strconv.Atoi(r.FormValue("offset"))
+		if limit <= 0 {
+			limit = 15
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		// get alerts from DB
+		ctx, cancel := dbContext(r)
+		alerts, err := m.GetAlerts(ctx, getIDfromCookie(m, r), limit, offset)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		alertsData, _ := json.Marshal(alerts)
+
+		// send response
+		w.WriteHeader(http.StatusOK)
+		w.Write(alertsData)
+	})
+}
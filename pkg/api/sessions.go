@@ -0,0 +1,98 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// sessions.go contains handlers of sessions of user.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// sessionResp is a session of user in list of sessions. ID is hash
+// of tocken of session, so tocken isn't revealed.
+type sessionResp struct {
+	ID           string    `json:"id"`
+	UserAgent    string    `json:"user_agent"`
+	IP           string    `json:"ip"`
+	CreationTime time.Time `json:"creation_time"`
+	LastSeen     time.Time `json:"last_seen"`
+	Current      bool      `json:"current"`
+}
+
+// userSessionsPage handles */users/sessions with method GET. Requires checkCookieMiddleware.
+// Returns JSON array of active sessions of current user from the newest one.
+func userSessionsPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// get sessions from SM
+		tocken, _ := sessionTocken(r)
+		ctx, cancel := smContext(r)
+		sessions, err := m.GetUserSessions(ctx, getIDfromCookie(m, r))
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getSessErr, err, getSessMsg))
+			return
+		}
+
+		current := model.HashToken(tocken)
+		resp := make([]*sessionResp, len(sessions))
+		for i, sess := range sessions {
+			resp[i] = &sessionResp{
+				ID:           sess.Hash,
+				UserAgent:    sess.UserAgent,
+				IP:           sess.IP,
+				CreationTime: sess.CreationTime,
+				LastSeen:     sess.LastSeen,
+				Current:      sess.Hash == current,
+			}
+		}
+
+		// marshall data to JSON format
+		sessionsData, _ := json.Marshal(resp)
+
+		// send response
+		w.WriteHeader(http.StatusOK)
+		w.Write(sessionsData)
+	})
+}
+
+// userSessionDeletePage handles */users/sessions/{id} with method DELETE. Requires
+// checkCookieMiddleware. Deletes session of current user with such ID; current
+// session can be deleted too.
+func userSessionDeletePage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// take id from url
+		hash, _ := mux.Vars(r)["id"]
+
+		// remove session only of current user
+		ctx, cancel := smContext(r)
+		affected, err := m.DeleteUserSession(ctx, getIDfromCookie(m, r), hash)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sessDelErr, err, sessDelMsg))
+			return
+		}
+		if affected == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterExID, sessIDErr,
+				errors.New("Client entered wrong ID of session"), sessIDMsg))
+			return
+		}
+
+		// send response
+		w.WriteHeader(http.StatusOK)
+	})
+}
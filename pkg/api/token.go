@@ -0,0 +1,202 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// token.go contains handlers of bearer tokens which are used by clients
+// without cookies, i.e. mobile applications.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// tokenResp is returned by */users/token. Access token is a tocken of session
+// which is sent in header Authorization with Bearer scheme; it expires in
+// ExpiresIn seconds. Refresh token is used once to get new pair of tokens.
+type tokenResp struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+}
+
+// tokenPage handles */users/token with method POST. If parameter grant_type is
+// password then user is authentificated by parameters email and password. If it's
+// refresh_token then parameter refresh_token is used and replaced by new one.
+// On succeed creates session and returns JSON object of tokenResp.
+func tokenPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		var user *model.User
+		var refresh string
+		switch r.FormValue("grant_type") {
+		case "password":
+			email := r.FormValue("email")
+			password := r.FormValue("password")
+			if email == "" || password == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(enterRequiredInfoLogin, requiredinfoErr,
+					errors.New("Client didn't sent required info"), requiredinfoMsgLogin))
+				return
+			}
+
+			// trying to find user with such email in database
+			ctx, cancel := dbContext(r)
+			userFromDB, err := m.GetUserWithEmail(ctx, email)
+			cancel()
+			if userFromDB.ID == -1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(enterValidAuth, badAuthErr,
+					errors.New("Client has entered non-existing email"), badAuthMsg))
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+				return
+			}
+			if err = bcrypt.CompareHashAndPassword([]byte(userFromDB.Password),
+				[]byte(password)); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(enterValidAuth, badAuthErr,
+					errors.New("Client has entered wrong password"), badAuthMsg))
+				return
+			}
+			user = userFromDB
+
+			// add refresh token of new client
+			ctx, cancel = dbContext(r)
+			refresh, err = newRefreshToken(ctx, m, user.ID, requestTimeouts(r).refresh)
+			cancel()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+				return
+			}
+
+		case "refresh_token":
+			oldRefresh := r.FormValue("refresh_token")
+			if oldRefresh == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(enterRequiredInfoToken, requiredinfoErr,
+					errors.New("Client didn't sent refresh token"), requiredinfoMsgToken))
+				return
+			}
+
+			// refresh token is rotated: used token is replaced by new one
+			var userID int64
+			ctx, cancel := dbContext(r)
+			err := m.WithTx(ctx, func(tx model.DB) error {
+				var err error
+				userID, err = tx.UseToken(ctx, model.HashToken(oldRefresh), model.TokenRefresh)
+				if err != nil {
+					return err
+				}
+				if user, err = tx.GetUserWithID(ctx, userID); err != nil {
+					return err
+				}
+				refresh, err = newRefreshToken(ctx, tx, userID, requestTimeouts(r).refresh)
+				return err
+			})
+			cancel()
+			if userID == -1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(apiErrorHandle(enterValidRefresh, badTokenErr, err, badTokenMsg))
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+				return
+			}
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterGrantType, grantTypeErr,
+				errors.New("Client sent unsupported grant type"), grantTypeMsg))
+			return
+		}
+
+		// access token is a session which expires
+		ctx, cancel := smContext(r)
+		sess, err := m.CreateSession(ctx, &model.Session{
+			ID:        user.ID,
+			Login:     user.Email,
+			UserAgent: r.UserAgent(),
+			IP:        clientIP(r),
+		}, true)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sessCreErr, err, sessCreMsg))
+			return
+		}
+
+		// marshall data to JSON format
+		tokenData, _ := json.Marshal(&tokenResp{
+			AccessToken:  sess.ID,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(time.Until(sess.Expires).Round(time.Second) / time.Second),
+			RefreshToken: refresh,
+			ID:           user.ID,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+		})
+
+		// tokens mustn't be cached
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(tokenData)
+	})
+}
+
+// revokeTokenPage handles */users/token/revoke with method POST. Revokes refresh
+// or access token from parameter token. Status is OK even if token is unknown.
+func revokeTokenPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		token := r.FormValue("token")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidToken, requiredinfoErr,
+				errors.New("Client didn't sent token"), requiredTokenMsg))
+			return
+		}
+
+		// token can be refresh token
+		ctx, cancel := dbContext(r)
+		userID, err := m.UseToken(ctx, model.HashToken(token), model.TokenRefresh)
+		cancel()
+		if err != nil && userID != -1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		// or access token
+		if userID == -1 {
+			ctx, cancel = smContext(r)
+			err = m.DeleteSession(ctx, &model.SessionID{ID: token})
+			cancel()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(apiErrorHandle(connectProvider, sessDelErr, err, sessDelMsg))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// transaction.go contains unit of work which is used by handlers
+// that change database and images in one request.
+
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// unitOfWork runs changes of database in one transaction and keeps
+// actions with images which depend on result of this transaction.
+// Compensations undo work that was done before transaction (i.e. remove
+// uploaded images) and are called if transaction fails. Actions after
+// commit are called only if transaction succeeds (i.e. removing of images
+// which are not referenced anymore).
+type unitOfWork struct {
+	m *model.Model
+	r *http.Request
+
+	compensations []func()
+	afterCommit   []func()
+}
+
+// newUnitOfWork creates unit of work for request r.
+func newUnitOfWork(m *model.Model, r *http.Request) *unitOfWork {
+	return &unitOfWork{
+		m: m,
+		r: r,
+	}
+}
+
+// uploaded registers images which must be removed if transaction fails.
+func (u *unitOfWork) uploaded(filenames []string) {
+	if len(filenames) == 0 {
+		return
+	}
+	u.compensations = append(u.compensations, func() {
+		deleteImages(u.r, filenames, u.m)
+	})
+}
+
+// replaced registers images which must be removed if transaction succeeds.
+func (u *unitOfWork) replaced(filenames []string) {
+	if len(filenames) == 0 {
+		return
+	}
+	u.afterCommit = append(u.afterCommit, func() {
+		deleteImages(u.r, filenames, u.m)
+	})
+}
+
+// fail calls compensations in reverse order. It must be used if
+// request fails before transaction is started.
+func (u *unitOfWork) fail() {
+	for i := len(u.compensations) - 1; i >= 0; i-- {
+		u.compensations[i]()
+	}
+	u.compensations = nil
+}
+
+// commit runs fn in transaction and calls compensations or
+// actions after commit depending on result of transaction.
+// ctx passed to fn has deadline of operation with DB.
+func (u *unitOfWork) commit(fn func(ctx context.Context, tx model.DB) error) error {
+	ctx, cancel := dbContext(u.r)
+	err := u.m.WithTx(ctx, func(tx model.DB) error {
+		return fn(ctx, tx)
+	})
+	cancel()
+	if err != nil {
+		u.fail()
+		return err
+	}
+
+	for _, action := range u.afterCommit {
+		action()
+	}
+	return nil
+}
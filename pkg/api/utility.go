@@ -8,6 +8,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
@@ -16,33 +17,126 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/nfnt/resize"
+	"golang.org/x/crypto/bcrypt"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 )
 
 var domain = os.Getenv("URL_OF_API")
 
-// getIDfromCookie returns ID of user using cookie from request.
+// getIDfromCookie returns ID of user using cookie or bearer token from request.
 // This function must be used with checkSessionMiddleware because
 // it doesn't handle any errors.
 func getIDfromCookie(m *model.Model, r *http.Request) int64 {
-	cookieSession, _ := r.Cookie("session_id")
-	session, _ := m.CheckSession(&model.SessionID{
-		ID: cookieSession.Value,
+	tocken, _ := sessionTocken(r)
+	ctx, cancel := smContext(r)
+	defer cancel()
+	session, _ := m.CheckSession(ctx, &model.SessionID{
+		ID: tocken,
 	})
 	return session.ID
 }
 
+// sessionTocken returns tocken of session from header Authorization with
+// Bearer scheme or from cookie session_id. Header is preferred.
+func sessionTocken(r *http.Request) (string, error) {
+	const prefix = "bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.ToLower(auth[:len(prefix)]) == prefix {
+		return strings.TrimSpace(auth[len(prefix):]), nil
+	}
+
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// timeouts contains deadlines of operations with providers of model.
+// Zero value means that operation has no deadline.
+type timeouts struct {
+	db   time.Duration
+	sm   time.Duration
+	im   time.Duration
+	mail time.Duration
+
+	// lifetime of URL for uploading
+	upload time.Duration
+
+	// lifetime of token of verification of email
+	verification time.Duration
+
+	// lifetime of token of reset of password
+	reset time.Duration
+
+	// lifetime of refresh token
+	refresh time.Duration
+}
+
+// timeoutsKey is a key of timeouts in context of request.
+type timeoutsKey struct{}
+
+// withTimeout returns context of request with such deadline.
+func withTimeout(r *http.Request, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), d)
+}
+
+// requestTimeouts returns timeouts which were set by timeoutsMiddleware.
+func requestTimeouts(r *http.Request) timeouts {
+	t, _ := r.Context().Value(timeoutsKey{}).(timeouts)
+	return t
+}
+
+// dbContext returns context for one operation with DB.
+func dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return withTimeout(r, requestTimeouts(r).db)
+}
+
+// smContext returns context for one operation with SM.
+func smContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return withTimeout(r, requestTimeouts(r).sm)
+}
+
+// imContext returns context for one operation with IM.
+func imContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return withTimeout(r, requestTimeouts(r).im)
+}
+
+// mailContext returns context for sending of one mail.
+func mailContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return withTimeout(r, requestTimeouts(r).mail)
+}
+
 // loadImages process incoming request to upload images from it.
 // ParseMultipartFrom must called before this function.
 // It returns array of image's paths which were created.
+// If some image can't be uploaded, already uploaded images are removed.
 func loadImages(r *http.Request, m *model.Model) ([]string, error) {
+	filenames, err := uploadImages(r, m)
+	if err != nil {
+		deleteImages(r, filenames, m)
+		return nil, err
+	}
+	return filenames, nil
+}
+
+// uploadImages uploads images from request. It returns
+// paths of images which were uploaded before error.
+func uploadImages(r *http.Request, m *model.Model) ([]string, error) {
 	files := r.MultipartForm.File["images"]
 
 	filenames := make([]string, 0)
@@ -50,86 +144,159 @@ func loadImages(r *http.Request, m *model.Model) ([]string, error) {
 	for _, item := range files {
 		// open file header
 		file, err := item.Open()
-		defer file.Close()
 		if err != nil {
-			return nil, err
+			return filenames, err
 		}
 
-		// make buf for first 512 bytes of file
-		buf := make([]byte, 512)
-		_, err = file.Read(buf)
+		// convert and upload image
+		addr, err := saveImage(r, m, file)
+		file.Close()
 		if err != nil {
-			return nil, err
+			return filenames, err
 		}
 
-		// detect type of file from request
-		typeOfFile := http.DetectContentType(buf)
-		if typeOfFile != "image/png" && typeOfFile != "image/jpeg" {
-			return nil, errors.New("Trying to upload wrong file extension")
+		filenames = append(filenames, addr)
+
+		// if we create or update user we need only one file
+		if strings.Contains(r.URL.Path, "/users/") {
+			break
 		}
+	}
 
-		// decode image
-		file.Seek(0, 0)
-		var img image.Image
+	return filenames, nil
+}
 
-		if typeOfFile == "image/png" {
-			img, err = png.Decode(file)
-		} else {
-			img, err = jpeg.Decode(file)
-		}
-		if err != nil {
-			return nil, err
-		}
+// saveImage converts image and uploads it to image manager.
+// It returns address of uploaded image.
+func saveImage(r *http.Request, m *model.Model, file io.ReadSeeker) (string, error) {
+	filename, encoded, err := convertImage(file)
+	if err != nil {
+		return "", err
+	}
 
-		// resize image
-		imgNew := resize.Thumbnail(1280, 720, img, resize.Lanczos3)
-
-		// make md5 sum for file name
-		hasher := md5.New()
-		io.Copy(hasher, file)
-		dataTime, _ := time.Now().MarshalBinary()
-		randBuf := make([]byte, 32)
-		rand.Read(randBuf)
-		io.Copy(hasher, bytes.NewReader(dataTime))
-		io.Copy(hasher, bytes.NewReader(randBuf))
-		filename := hex.EncodeToString(hasher.Sum(nil))
-		dst, _ := os.Create("./images/" + filename + ".png")
-		defer os.Remove("./images/" + filename + ".png")
-		defer dst.Close()
-
-		// save image
-		err = png.Encode(dst, imgNew)
-		if err != nil {
-			return nil, err
-		}
+	ctx, cancel := imContext(r)
+	defer cancel()
+	return m.UploadImage(ctx, "/images/"+filename+".png", encoded)
+}
 
-		sourceFile, _ := os.Open("./images/" + filename + ".png")
-		defer sourceFile.Close()
+// convertImage checks that file is PNG or JPEG image, resizes it and
+// encodes to PNG in memory. It returns unique name of image without extension.
+func convertImage(file io.ReadSeeker) (string, *bytes.Buffer, error) {
+	// make buf for first 512 bytes of file
+	buf := make([]byte, 512)
+	_, err := file.Read(buf)
+	if err != nil {
+		return "", nil, err
+	}
 
-		// use aws s3 for uploading
-		addr, err := m.UploadImage("/images/"+filename+".png", sourceFile)
-		if err != nil {
-			return nil, err
-		}
+	// detect type of file from request
+	typeOfFile := http.DetectContentType(buf)
+	if typeOfFile != "image/png" && typeOfFile != "image/jpeg" {
+		return "", nil, errors.New("Trying to upload wrong file extension")
+	}
 
-		filenames = append(filenames, addr)
+	// decode image
+	file.Seek(0, 0)
+	var img image.Image
 
-		// if we create or update user we need only one file
-		if strings.Contains(r.URL.Path, "/users/") {
-			break
+	if typeOfFile == "image/png" {
+		img, err = png.Decode(file)
+	} else {
+		img, err = jpeg.Decode(file)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	// resize image
+	imgNew := resize.Thumbnail(1280, 720, img, resize.Lanczos3)
+
+	// make md5 sum for file name
+	hasher := md5.New()
+	io.Copy(hasher, file)
+	dataTime, _ := time.Now().MarshalBinary()
+	randBuf := make([]byte, 32)
+	rand.Read(randBuf)
+	io.Copy(hasher, bytes.NewReader(dataTime))
+	io.Copy(hasher, bytes.NewReader(randBuf))
+	filename := hex.EncodeToString(hasher.Sum(nil))
+
+	// encode image in memory
+	encoded := &bytes.Buffer{}
+	err = png.Encode(encoded, imgNew)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filename, encoded, nil
+}
+
+// maxUploadSize is maximum size of image uploaded by URL
+const maxUploadSize = 32 << 20
+
+// errImageSize is returned by readUpload if file is too big
+var errImageSize = errors.New("Image is bigger than allowed")
+
+// uploadKey returns key of file uploaded by URL with such ID.
+// Such files are not referenced, so they are removed by GC if
+// they are not finalized.
+func uploadKey(id string) string {
+	return "/images/uploads/" + id
+}
+
+// isUploadKey reports if address is file uploaded by URL which
+// isn't finalized. Such files can't be attached to ads and users.
+func isUploadKey(address string) bool {
+	return strings.Contains(address, "/images/uploads/")
+}
+
+// checkImages checks that images can be attached to ad or user:
+// they must exist and must not be unfinalized uploads.
+func checkImages(r *http.Request, m *model.Model, images []string) bool {
+	for _, image := range images {
+		if isUploadKey(image) {
+			return false
+		}
+		ctx, cancel := imContext(r)
+		exist := m.IsExist(ctx, image)
+		cancel()
+		if !exist {
+			return false
 		}
 	}
+	return true
+}
 
-	return filenames, nil
+// readUpload reads file uploaded by URL to memory.
+func readUpload(ctx context.Context, m *model.Model, key string) ([]byte, error) {
+	img, err := m.ReadImage(ctx, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Body.Close()
+
+	if img.Size > maxUploadSize {
+		return nil, errImageSize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(img.Body, maxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUploadSize {
+		return nil, errImageSize
+	}
+	return data, nil
 }
 
 // deleteImages deletes files with filenames.
-func deleteImages(filenames []string, m *model.Model) error {
+func deleteImages(r *http.Request, filenames []string, m *model.Model) error {
 	for _, filename := range filenames {
 		if filename == "" {
 			break
 		}
-		err := m.DeleteImage(filename)
+		ctx, cancel := imContext(r)
+		err := m.DeleteImage(ctx, filename)
+		cancel()
 		if err != nil {
 			return err
 		}
@@ -145,3 +312,273 @@ func deleteImages(filenames []string, m *model.Model) error {
 	}
 	return s
 } */
+
+// imageStream is a stream of image from image manager which can seek.
+// Stream is reopened from new offset when reading after seeking,
+// so http.ServeContent can serve ranges of image.
+type imageStream struct {
+	ctx context.Context
+	m   *model.Model
+	key string
+
+	body        io.ReadCloser
+	bodyOffset  int64
+	offset      int64
+	size        int64
+	contentType string
+	modTime     time.Time
+}
+
+// openImage opens stream of image with such key.
+func openImage(ctx context.Context, m *model.Model, key string) (*imageStream, error) {
+	img, err := m.ReadImage(ctx, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &imageStream{
+		ctx:         ctx,
+		m:           m,
+		key:         key,
+		body:        img.Body,
+		size:        img.Size,
+		contentType: img.ContentType,
+		modTime:     img.ModTime,
+	}, nil
+}
+
+// Read implements io.Reader interface.
+func (s *imageStream) Read(p []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.body != nil && s.bodyOffset != s.offset {
+		s.body.Close()
+		s.body = nil
+	}
+	if s.body == nil {
+		img, err := s.m.ReadImage(s.ctx, s.key, s.offset)
+		if err != nil {
+			return 0, err
+		}
+		s.body, s.bodyOffset = img.Body, s.offset
+	}
+
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	s.bodyOffset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker interface. It doesn't read anything.
+func (s *imageStream) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("Invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Negative position")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+// Close closes current stream of image.
+func (s *imageStream) Close() error {
+	if s.body == nil {
+		return nil
+	}
+	return s.body.Close()
+}
+
+// convertTime is a converter of schema decoder for parameters of time.
+// Time must be in RFC 3339 format or date like 2006-01-02 (UTC).
+func convertTime(value string) reflect.Value {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return reflect.ValueOf(t)
+		}
+	}
+	return reflect.Value{}
+}
+
+// checkFilters returns false if ranges of filters are empty.
+func checkFilters(sp *model.SearchParams) bool {
+	if sp.MinPrice > 0 && sp.MaxPrice > 0 && sp.MinPrice > sp.MaxPrice {
+		return false
+	}
+	if !sp.CreatedAfter.IsZero() && !sp.CreatedBefore.IsZero() &&
+		!sp.CreatedAfter.Before(sp.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// checkSort returns false if sort order is unknown. Relevance is allowed
+// only if ads are searched by query and distance only by search in radius.
+func checkSort(sort string, search, geo bool) bool {
+	switch sort {
+	case "", model.SortNewest, model.SortOldest, model.SortPriceAsc, model.SortPriceDesc:
+		return true
+	case model.SortRelevance:
+		return search
+	case model.SortDistance:
+		return geo
+	}
+	return false
+}
+
+// checkLocation returns false if only one coordinate is set
+// or coordinates are out of range.
+func checkLocation(latitude, longitude *float64) bool {
+	if latitude == nil || longitude == nil {
+		return latitude == nil && longitude == nil
+	}
+	return math.Abs(*latitude) <= 90 && math.Abs(*longitude) <= 180
+}
+
+// checkVerified returns false if email of user isn't verified.
+func checkVerified(r *http.Request, m *model.Model, userID int64) (bool, error) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+	user, err := m.GetUserWithID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+// checkCategory returns false if ad has category which doesn't exist.
+func checkCategory(r *http.Request, m *model.Model, ad *model.AdItem) (bool, error) {
+	if !ad.CategoryID.Valid {
+		return true, nil
+	}
+	ctx, cancel := dbContext(r)
+	categories, err := m.GetCategories(ctx)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	for _, c := range categories {
+		if c.ID == ad.CategoryID.Int64 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// categoryTree builds tree of categories ordered by ID
+// and returns root categories.
+func categoryTree(categories []*model.Category) []*model.Category {
+	byID := make(map[int64]*model.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	roots := make([]*model.Category, 0)
+	for _, c := range categories {
+		if parent, ok := byID[c.ParentID.Int64]; c.ParentID.Valid && ok {
+			parent.Children = append(parent.Children, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	return roots
+}
+
+// canFallback checks if ads can be searched in fuzzy mode when exact search
+// finds nothing. Fallback is made only for the first page of search.
+func canFallback(sp *model.SearchParams) bool {
+	return sp.Query != "" && !sp.Fuzzy && sp.Offset == 0 && sp.CursorID <= 0
+}
+
+// correctQuery returns queries in which words of query are replaced by
+// similar words of ads. The i-th query is made of the i-th similar words;
+// query itself isn't returned.
+func correctQuery(ctx context.Context, m *model.Model, query string) ([]string, error) {
+	words := strings.Fields(strings.ToLower(query))
+	similar := make([][]string, len(words))
+	for i, word := range words {
+		var err error
+		if similar[i], err = m.GetSimilarWords(ctx, word, maxCorrections); err != nil {
+			return nil, err
+		}
+	}
+
+	corrections := make([]string, 0, maxCorrections)
+	seen := map[string]bool{strings.Join(words, " "): true}
+	for k := 0; k < maxCorrections; k++ {
+		corrected := make([]string, len(words))
+		for i, word := range words {
+			switch n := len(similar[i]); {
+			case n > k:
+				corrected[i] = similar[i][k]
+			case n > 0:
+				// word without more similar words is replaced by the last one
+				corrected[i] = similar[i][n-1]
+			default:
+				corrected[i] = word
+			}
+		}
+		if c := strings.Join(corrected, " "); !seen[c] {
+			seen[c] = true
+			corrections = append(corrections, c)
+		}
+	}
+	return corrections, nil
+}
+
+// newUserToken stores new token of such kind of user in db
+// and returns it. Token expires after ttl.
+func newUserToken(ctx context.Context, db model.DB, userID int64, kind string, ttl time.Duration) (string, error) {
+	token, t, err := model.NewToken(userID, kind, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err = db.NewToken(ctx, t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// newRefreshToken stores new refresh token of user in db and returns it.
+// Other refresh tokens of user are kept, so user can have many clients.
+func newRefreshToken(ctx context.Context, db model.DB, userID int64, ttl time.Duration) (string, error) {
+	token, t, err := model.NewToken(userID, model.TokenRefresh, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err = db.AddToken(ctx, t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkPassword returns false if password isn't password of user with such ID.
+func checkPassword(r *http.Request, m *model.Model, userID int64, password string) (bool, error) {
+	ctx, cancel := dbContext(r)
+	defer cancel()
+	user, err := m.GetUserWithID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	// only query by email returns hash of password
+	if user, err = m.GetUserWithEmail(ctx, user.Email); err != nil {
+		return false, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return err == nil, nil
+}
+
+// clientIP returns address of client without port. Address is taken
+// from X-Forwarded-For by proxyMiddleware if proxy is trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
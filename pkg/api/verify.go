@@ -0,0 +1,265 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+// verify.go contains handlers of verification and change of email of user.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/asaskevich/govalidator"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// verifyEmailPage handles */users/verify with methods GET and POST. Marks email
+// of user as verified by token from parameter token. Token can be used once.
+func verifyEmailPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		token := r.FormValue("token")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, requiredinfoErr,
+				errors.New("Client didn't sent token"), requiredTokenMsg))
+			return
+		}
+
+		// token is removed only if email is verified
+		var userID int64
+		ctx, cancel := dbContext(r)
+		err := m.WithTx(ctx, func(tx model.DB) error {
+			var err error
+			userID, err = tx.UseToken(ctx, model.HashToken(token), model.TokenVerifyEmail)
+			if err != nil {
+				return err
+			}
+			_, err = tx.VerifyEmail(ctx, userID)
+			return err
+		})
+		cancel()
+		if userID == -1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidToken, badTokenErr, err, badTokenMsg))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// resendVerificationPage handles */users/verify/resend with method POST. Requires
+// checkCookieMiddleware. Sends new token of verification to email of current user;
+// tokens sent before can't be used anymore.
+func resendVerificationPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		// get user from DB
+		ctx, cancel := dbContext(r)
+		user, err := m.GetUserWithID(ctx, getIDfromCookie(m, r))
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if user.EmailVerified {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, alreadyVerifiedErr,
+				errors.New("Client tried to verify email again"), alreadyVerifiedMsg))
+			return
+		}
+
+		// create token and send it
+		ctx, cancel = dbContext(r)
+		token, err := newUserToken(ctx, m, user.ID, model.TokenVerifyEmail,
+			requestTimeouts(r).verification)
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if err = sendVerification(r, m, user, token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sendMailErr, err, sendMailMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// sendVerification sends token of verification to email of user. Mail
+// has link to */users/verify with token, so email can be verified in browser.
+func sendVerification(r *http.Request, m *model.Model, user *model.User, token string) error {
+	ctx, cancel := mailContext(r)
+	defer cancel()
+	return m.SendMail(ctx, &model.Mail{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: "Hello, " + user.FirstName + "!\n\n" +
+			"To verify your email open this link:\n" +
+			domain + "/users/verify?token=" + url.QueryEscape(token) + "\n\n" +
+			"or enter this code in the application:\n" + token + "\n\n" +
+			"You can't create ads until your email is verified.\n",
+	})
+}
+
+// changeEmailPage handles */users/profile/email with method POST. Requires
+// checkCookieMiddleware. Sends token of confirmation to new email from parameter
+// email if parameter password is current password. Email of user is replaced
+// only after confirmation.
+func changeEmailPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		email := r.FormValue("email")
+		password := r.FormValue("password")
+		if email == "" || password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterRequiredInfoEmail, requiredinfoErr,
+				errors.New("Client didn't sent required info"), requiredinfoMsgEmail))
+			return
+		}
+		if !govalidator.IsEmail(email) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(validRequiredEmail, reqValidErr,
+				errors.New("Email isn't valid"), reqValidMsg))
+			return
+		}
+
+		// check current password
+		userID := getIDfromCookie(m, r)
+		ok, err := checkPassword(r, m, userID, password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidPassword, badAuthErr,
+				errors.New("Client has entered wrong password"), badPasswordMsg))
+			return
+		}
+
+		// email must be unique
+		ctx, cancel := dbContext(r)
+		user, err := m.GetUserWithEmail(ctx, email)
+		cancel()
+		if err == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterExEmail, userExErr,
+				errors.New("Client tried to use email of existing user"), userExMsg))
+			return
+		}
+		if user.ID != -1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, getInfoDBErr, err, getInfoDBMsg))
+			return
+		}
+
+		// store new email with token of its confirmation
+		var token string
+		ctx, cancel = dbContext(r)
+		err = m.WithTx(ctx, func(tx model.DB) error {
+			var err error
+			if _, err = tx.SetNewEmail(ctx, userID, email); err != nil {
+				return err
+			}
+			token, err = newUserToken(ctx, tx, userID, model.TokenChangeEmail,
+				requestTimeouts(r).verification)
+			return err
+		})
+		cancel()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		if err = sendEmailChange(r, m, email, token); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, sendMailErr, err, sendMailMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// confirmEmailPage handles */users/profile/email/confirm with methods GET and POST.
+// Replaces email of user by new one with token from parameter token. Token can be
+// used once. New email is verified.
+func confirmEmailPage(m *model.Model) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+
+		token := r.FormValue("token")
+		if token == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(checkReq, requiredinfoErr,
+				errors.New("Client didn't sent token"), requiredTokenMsg))
+			return
+		}
+
+		// token is removed only if email is replaced
+		var userID, affected int64
+		ctx, cancel := dbContext(r)
+		err := m.WithTx(ctx, func(tx model.DB) error {
+			var err error
+			userID, err = tx.UseToken(ctx, model.HashToken(token), model.TokenChangeEmail)
+			if err != nil {
+				return err
+			}
+			affected, err = tx.ConfirmNewEmail(ctx, userID)
+			return err
+		})
+		cancel()
+		if userID == -1 || (err == nil && affected == 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterValidToken, badTokenErr, err, badTokenMsg))
+			return
+		}
+		// email could be taken by other user after token was sent
+		if affected == -1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(apiErrorHandle(enterExEmail, userExErr, err, userExMsg))
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(apiErrorHandle(connectProvider, updateUserDBErr, err, updateUserDBMsg))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// sendEmailChange sends token of confirmation to new email of user.
+func sendEmailChange(r *http.Request, m *model.Model, email, token string) error {
+	ctx, cancel := mailContext(r)
+	defer cancel()
+	return m.SendMail(ctx, &model.Mail{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: "Hello!\n\n" +
+			"To use this email for your account open this link:\n" +
+			domain + "/users/profile/email/confirm?token=" + url.QueryEscape(token) + "\n\n" +
+			"or enter this code in the application:\n" + token + "\n\n" +
+			"If you didn't request change of email, ignore this mail.\n",
+	})
+}
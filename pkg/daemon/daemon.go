@@ -10,12 +10,21 @@ session manager and run API server.
 package daemon
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"bmstu.codes/developers34/SBWeb/pkg/alerts"
+	"bmstu.codes/developers34/SBWeb/pkg/fsimage"
+	"bmstu.codes/developers34/SBWeb/pkg/imagegc"
+	"bmstu.codes/developers34/SBWeb/pkg/mailer"
+	"bmstu.codes/developers34/SBWeb/pkg/memdb"
 	"bmstu.codes/developers34/SBWeb/pkg/s3"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
@@ -27,63 +36,260 @@ import (
 
 // Config is config structure for whole service.
 type Config struct {
-	DB  db.Config
-	SM  sm.Config
-	API api.Config
-	IM  s3.Config
+	DB     DBConfig
+	SM     sm.Config
+	API    api.Config
+	IM     IMConfig
+	GC     imagegc.Config
+	Alerts alerts.Config
+	Mailer MailerConfig
+}
+
+// DBConfig is config of database. Type chooses implementation
+// of database: "postgres" (default) or "memory". Data of "memory"
+// database is lost when service stops. Fields of db.Config are
+// embedded to keep old configs valid.
+type DBConfig struct {
+	Type string `json:"Type"`
+	db.Config
+}
+
+// IMConfig is config of image manager. Type chooses implementation
+// of image manager: "s3" (default) or "fs". Fields of s3.Config are
+// embedded to keep old configs valid.
+type IMConfig struct {
+	Type string `json:"Type"`
+	s3.Config
+	FS fsimage.Config `json:"FS"`
+}
+
+// MailerConfig is config of mailer. Type chooses implementation
+// of mailer: "outbox" (default) or "smtp". Outbox doesn't send
+// mails, so it's used for development. Outbox without directory
+// can be used only with in-memory database.
+type MailerConfig struct {
+	Type   string              `json:"Type"`
+	SMTP   mailer.SMTPConfig   `json:"SMTP"`
+	Outbox mailer.OutboxConfig `json:"Outbox"`
 }
 
 // RunService is a function that starts the whole service using
 // provided config. Every error that happens during this function
 // is fatal. So program can't run if any error happens.
 func RunService(cfg *Config) error {
+	// mails of outbox without directory are lost, so it's allowed
+	// only with in-memory database used by development and tests
+	if (cfg.Mailer.Type == "" || cfg.Mailer.Type == "outbox") &&
+		cfg.Mailer.Outbox.Directory == "" && cfg.DB.Type != "memory" {
+		err := errors.New("Outbox of mailer has no directory")
+		log.Println("Can't start mailer", err.Error())
+		return err
+	}
+
 	// init connection with database
-	db, err := db.InitConnDB(cfg.DB)
+	db, err := initDB(cfg.DB)
 	if err != nil {
 		log.Println("Can't connect to database", err.Error())
 		return err
 	}
-	log.Println("Connected to DB")
 
 	// init connection with session manager
-	sm, err := sm.InitConnSM(cfg.SM)
+	sm, err := sm.InitSM(cfg.SM)
 	if err != nil {
 		log.Println("Can't start session manager", err.Error())
 		return err
 	}
 	log.Println("Connected to SM")
 
-	im, err := s3.InitS3(cfg.IM)
+	// init image manager
+	im, err := initIM(cfg.IM)
+	if err != nil {
+		log.Println("Can't start image manager", err.Error())
+		return err
+	}
+
+	// init mailer
+	ml, err := initMailer(cfg.Mailer)
 	if err != nil {
-		log.Println("Can't access AWS S3", err.Error())
+		log.Println("Can't start mailer", err.Error())
 		return err
 	}
-	log.Println("Connected to AWS S3")
 
 	// create model for API
-	m := model.New(db, sm, im)
+	m := model.New(db, sm, im, ml)
+
+	// start collector of orphaned images if it's enabled
+	gc, err := imagegc.New(cfg.GC, db, im)
+	if err != nil {
+		log.Println("Can't parse GC config", err.Error())
+		return err
+	}
+	ctx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if gc.Enabled() {
+		log.Println("Starting collector of orphaned images")
+		go gc.Run(ctx)
+	}
+
+	// start checker of saved searches if it's enabled
+	var notifier alerts.Notifier
+	if cfg.Alerts.Mail {
+		notifier = alerts.NewMailNotifier(db, ml)
+	}
+	checker, err := alerts.New(cfg.Alerts, db, notifier)
+	if err != nil {
+		log.Println("Can't parse alerts config", err.Error())
+		return err
+	}
+	if checker.Enabled() {
+		log.Println("Starting checker of saved searches")
+		go checker.Run(ctx)
+	}
+
+	// parse time for graceful shutdown of server
+	var shutdownTimeout time.Duration
+	if cfg.API.ShutdownTimeout != "" {
+		shutdownTimeout, err = time.ParseDuration(cfg.API.ShutdownTimeout)
+		if err != nil {
+			log.Println("Can't parse API config", err.Error())
+			return err
+		}
+	}
 
 	// start server
 	log.Println("Starting API server...")
 	srv, ch := api.StartServer(cfg.API, m)
 
 	// wait signal of server shutdown
-	waitForSignal(srv, ch)
+	waitForSignal(srv, ch, shutdownTimeout)
+	stopJobs()
+
+	// stop background work of session manager if it has any
+	if closer, ok := sm.(interface{ Close() }); ok {
+		closer.Close()
+	}
 
 	return nil
 }
 
+// Migrate runs command of migration ("up", "down" or "status") on database
+// from config and writes result to w. Only postgres database has migrations.
+func Migrate(cfg *Config, command string, w io.Writer) error {
+	if cfg.DB.Type != "" && cfg.DB.Type != "postgres" {
+		return errors.New("Migrations are supported only by postgres database")
+	}
+	return db.Migrate(cfg.DB.Config, command, w)
+}
+
+// CollectGarbage removes orphaned images once and writes report to w.
+// Images are only reported if dryRun is true or config of GC has DryRun.
+// In-memory database has no images of previous runs, so it's not supported.
+func CollectGarbage(cfg *Config, dryRun bool, w io.Writer) error {
+	if cfg.DB.Type == "memory" {
+		return errors.New("GC can't be run with in-memory database")
+	}
+
+	db, err := initDB(cfg.DB)
+	if err != nil {
+		log.Println("Can't connect to database", err.Error())
+		return err
+	}
+	im, err := initIM(cfg.IM)
+	if err != nil {
+		log.Println("Can't start image manager", err.Error())
+		return err
+	}
+
+	gcCfg := cfg.GC
+	gcCfg.DryRun = gcCfg.DryRun || dryRun
+	gc, err := imagegc.New(gcCfg, db, im)
+	if err != nil {
+		return err
+	}
+
+	report, err := gc.Sweep(context.Background())
+	if err != nil {
+		return err
+	}
+	return report.Print(w)
+}
+
+// initDB initiates database of type provided in config.
+func initDB(cfg DBConfig) (model.DB, error) {
+	switch cfg.Type {
+	case "", "postgres":
+		h, err := db.InitConnDB(cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Connected to DB")
+		return h, nil
+	case "memory":
+		log.Println("Using in-memory DB")
+		return memdb.New(), nil
+	default:
+		return nil, errors.New("Unknown type of database: " + cfg.Type)
+	}
+}
+
+// initIM initiates image manager of type provided in config.
+func initIM(cfg IMConfig) (model.IM, error) {
+	switch cfg.Type {
+	case "", "s3":
+		im, err := s3.InitS3(cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Connected to AWS S3")
+		return im, nil
+	case "fs":
+		im, err := fsimage.InitFS(cfg.FS)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Using local directory for images", cfg.FS.Directory)
+		return im, nil
+	default:
+		return nil, errors.New("Unknown type of image manager: " + cfg.Type)
+	}
+}
+
+// initMailer initiates mailer of type provided in config.
+func initMailer(cfg MailerConfig) (model.Mailer, error) {
+	switch cfg.Type {
+	case "", "outbox":
+		log.Println("Using outbox for mails", cfg.Outbox.Directory)
+		return mailer.NewOutbox(cfg.Outbox)
+	case "smtp":
+		log.Println("Using SMTP server for mails", cfg.SMTP.Address)
+		return mailer.NewSMTP(cfg.SMTP)
+	default:
+		return nil, errors.New("Unknown type of mailer: " + cfg.Type)
+	}
+}
+
 // waitForSignal waits signal from OS to shutdown server and
-// error from server himself.
-func waitForSignal(srv *http.Server, chSrv chan error) error {
-	ch := make(chan os.Signal)
+// error from server himself. Server has timeout time to finish active
+// requests, after that their connections are closed and contexts of
+// requests are canceled. Zero timeout means waiting without limit.
+func waitForSignal(srv *http.Server, chSrv chan error, timeout time.Duration) error {
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 
 	for {
 		select {
 		case s := <-ch:
-			_ = srv.Shutdown(nil)
 			log.Printf("Got signal: %v, exiting.", s)
+			ctx := context.Background()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Println("Can't shutdown server gracefully", err.Error())
+				srv.Close()
+			}
 			return nil
 		case err := <-chSrv:
 			log.Println(err)
@@ -5,12 +5,19 @@
 package daemon_test
 
 import (
-	"database/sql"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/jmoiron/sqlx"
+
+	"bmstu.codes/developers34/SBWeb/pkg/fsimage"
+	"bmstu.codes/developers34/SBWeb/pkg/imagegc"
+	"bmstu.codes/developers34/SBWeb/pkg/mailer"
 	"bmstu.codes/developers34/SBWeb/pkg/s3"
 
 	"bmstu.codes/developers34/SBWeb/pkg/api"
@@ -21,10 +28,18 @@ import (
 
 // must be executed from docker container linked with postgres and redis
 func TestRunService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
 	cfg := &daemon.Config{
-		DB: db.Config{
-			DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
-			MaxOpenConns: 10,
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
 		},
 		SM: sessionmanager.Config{
 			DBAddress:      "redis://redis:6379/0",
@@ -37,41 +52,20 @@ func TestRunService(t *testing.T) {
 			WriteTimeout: "10s",
 			IdleTimeout:  "10s",
 		},
-		IM: s3.Config{
-			Region: "eu-central-1",
-		},
-	}
-
-	database, _ := sql.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS users
-(
-    id                SERIAL      PRIMARY KEY,
-    first_name        varchar(80) NOT NULL,
-    last_name         varchar(80) NOT NULL,
-    email             varchar(80) UNIQUE NOT NULL,
-    password_hash     text        NOT NULL,
-    telephone         varchar(80),
-    about             text,
-    avatar_address    text,
-    reg_time          timestamp   DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS ads
-(
-    id             SERIAL       PRIMARY KEY,
-    title          varchar(80)  NOT NULL,
-    price          integer      CONSTRAINT positive_price CHECK (price > 0),
-    country        varchar(80),
-    city           varchar(80),
-    subway_station varchar(80),
-    ad_images      varchar(256)[],
-    -- when deleting user we should delete his ads
-    owner_ad       integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
-    description_ad text,
-    creation_time  timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
+		IM: daemon.IMConfig{
+			Config: s3.Config{
+				Region: "eu-central-1",
+			},
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
+		},
+	}
 
+	database, _ := sqlx.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
+	db.MigrateUp(database)
 	database.Close()
 
 	ch := make(chan error)
@@ -87,9 +81,11 @@ func TestRunService(t *testing.T) {
 	}
 
 	cfg = &daemon.Config{
-		DB: db.Config{
-			DBAddress:    "postgresql://runner:@badhost/data?sslmode=disable",
-			MaxOpenConns: 10,
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@badhost/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
 		},
 		SM: sessionmanager.Config{
 			DBAddress:      "redis://redis:6379/0",
@@ -102,8 +98,15 @@ func TestRunService(t *testing.T) {
 			WriteTimeout: "10s",
 			IdleTimeout:  "10s",
 		},
-		IM: s3.Config{
-			Region: "eu-central-1",
+		IM: daemon.IMConfig{
+			Config: s3.Config{
+				Region: "eu-central-1",
+			},
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
 		},
 	}
 
@@ -116,9 +119,11 @@ func TestRunService(t *testing.T) {
 	}
 
 	cfg = &daemon.Config{
-		DB: db.Config{
-			DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
-			MaxOpenConns: 10,
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
 		},
 		SM: sessionmanager.Config{
 			DBAddress:      "redis:/dwedfewfewfd:6379/0",
@@ -131,8 +136,15 @@ func TestRunService(t *testing.T) {
 			WriteTimeout: "10s",
 			IdleTimeout:  "10s",
 		},
-		IM: s3.Config{
-			Region: "eu-central-1",
+		IM: daemon.IMConfig{
+			Config: s3.Config{
+				Region: "eu-central-1",
+			},
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
 		},
 	}
 
@@ -145,9 +157,11 @@ func TestRunService(t *testing.T) {
 	}
 
 	cfg = &daemon.Config{
-		DB: db.Config{
-			DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
-			MaxOpenConns: 10,
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
 		},
 		SM: sessionmanager.Config{
 			DBAddress:      "redis://redis:6379/0",
@@ -160,8 +174,15 @@ func TestRunService(t *testing.T) {
 			WriteTimeout: "10s",
 			IdleTimeout:  "10s",
 		},
-		IM: s3.Config{
-			Region: "eu-central-1",
+		IM: daemon.IMConfig{
+			Config: s3.Config{
+				Region: "eu-central-1",
+			},
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
 		},
 	}
 
@@ -174,9 +195,47 @@ func TestRunService(t *testing.T) {
 	}
 
 	cfg = &daemon.Config{
-		DB: db.Config{
-			DBAddress:    "postgresql://runner:@badhost/data?sslmode=disable",
-			MaxOpenConns: 10,
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
+		},
+		SM: sessionmanager.Config{
+			DBAddress:      "redis://redis:6379/0",
+			TockenLength:   32,
+			ExpirationTime: 86400,
+		},
+		API: api.Config{
+			Address:      ":54000",
+			ReadTimeout:  "10s",
+			WriteTimeout: "10s",
+			IdleTimeout:  "10s",
+		},
+		IM: daemon.IMConfig{
+			Type: "unknown",
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
+		},
+	}
+
+	go func() {
+		ch <- daemon.RunService(cfg)
+	}()
+
+	if err := <-ch; err == nil {
+		t.Error("Error must be not nil")
+	}
+
+	cfg = &daemon.Config{
+		DB: daemon.DBConfig{
+			Config: db.Config{
+				DBAddress:    "postgresql://runner:@badhost/data?sslmode=disable",
+				MaxOpenConns: 10,
+			},
 		},
 		SM: sessionmanager.Config{
 			DBAddress:      "redis://redis:6379/0",
@@ -189,8 +248,15 @@ func TestRunService(t *testing.T) {
 			WriteTimeout: "10s",
 			IdleTimeout:  "10s",
 		},
-		IM: s3.Config{
-			Region: "eu-central-1",
+		IM: daemon.IMConfig{
+			Config: s3.Config{
+				Region: "eu-central-1",
+			},
+		},
+		Mailer: daemon.MailerConfig{
+			Outbox: mailer.OutboxConfig{
+				Directory: dir,
+			},
 		},
 	}
 
@@ -204,3 +270,92 @@ func TestRunService(t *testing.T) {
 		t.Error("Error must be not nil")
 	}
 }
+
+func TestRunServiceInMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &daemon.Config{
+		DB: daemon.DBConfig{
+			Type: "memory",
+		},
+		SM: sessionmanager.Config{
+			Type:           "memory",
+			TockenLength:   32,
+			ExpirationTime: 86400,
+		},
+		API: api.Config{
+			Address:      ":54001",
+			ReadTimeout:  "10s",
+			WriteTimeout: "10s",
+			IdleTimeout:  "10s",
+		},
+		IM: daemon.IMConfig{
+			Type: "fs",
+			FS: fsimage.Config{
+				Directory: dir,
+			},
+		},
+		GC: imagegc.Config{
+			Interval:    "10ms",
+			GracePeriod: "1h",
+		},
+	}
+
+	ch := make(chan error)
+	go func() {
+		ch <- daemon.RunService(cfg)
+	}()
+	time.Sleep(time.Millisecond * 500)
+
+	res, err := http.Get("http://localhost:54001/ads")
+	if err != nil {
+		t.Error("Unexpected error: ", err.Error())
+	} else if res.StatusCode != http.StatusOK {
+		t.Error("Expected status 200 got ", res.StatusCode)
+	}
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+
+	if err := <-ch; err != nil {
+		t.Error("Unexpected error: ", err.Error())
+	}
+
+	cfg.DB.Type = "unknown"
+	go func() {
+		ch <- daemon.RunService(cfg)
+	}()
+
+	if err := <-ch; err == nil {
+		t.Error("Error must be not nil")
+	}
+
+	// in-memory database has no images of previous runs
+	cfg.DB.Type = "memory"
+	if err := daemon.CollectGarbage(cfg, true, ioutil.Discard); err == nil {
+		t.Error("Error must be not nil")
+	}
+
+	cfg.GC.Interval = "day"
+	go func() {
+		ch <- daemon.RunService(cfg)
+	}()
+
+	if err := <-ch; err == nil {
+		t.Error("Error must be not nil")
+	}
+
+	// mails of outbox without directory would be lost
+	cfg.GC.Interval = ""
+	cfg.DB.Type = "postgres"
+	go func() {
+		ch <- daemon.RunService(cfg)
+	}()
+
+	if err := <-ch; err == nil || !strings.Contains(err.Error(), "Outbox") {
+		t.Error("Expected error of outbox", err)
+	}
+}
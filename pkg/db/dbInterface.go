@@ -5,10 +5,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
+
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 )
 
@@ -16,173 +19,22 @@ const (
 	notUniqueEmail = `pq: duplicate key value violates unique constraint "users_email_key"`
 )
 
-// prepareStateents preapares SQL statements for interaction with postgres database.
-func (h *Handler) prepareStatements() (err error) {
-	if h.ReadAds, err = h.DB.PrepareNamed( // return list of ads
-		`SELECT
-		 ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad,
-		 users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address
-		 FROM
-		 ads
-		 INNER JOIN
-		 users 
-		 ON
-		 users.id = ads.owner_ad
-		 LIMIT :limit OFFSET :offset`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.SearchAds, err = h.DB.PrepareNamed(
-		`SELECT
-		ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad,
-		users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address
-		FROM
-		ads
-		INNER JOIN
-		users 
-		ON
-		users.id = ads.owner_ad
-		WHERE ads.title ILIKE '%' || :query || '%'
-		LIMIT :limit OFFSET :offset`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.ReadAdsOfUser, err = h.DB.Preparex( // return list of ads of such user
-		`SELECT
-		 ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad,
-		 users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address
-		 FROM
-		 ads
-		 INNER JOIN
-		 users 
-		 ON
-		 users.id = ads.owner_ad
-		 AND ads.owner_ad = $1`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.ReadAd, err = h.DB.Preparex( // return ad with such id
-		`SELECT
-		ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad,
-		users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address
-		FROM
-		ads
-		INNER JOIN
-		users
-		ON
-		users.id = ads.owner_ad AND ads.id = $1`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.ReadUserWithID, err = h.DB.Preparex( // return user with such id
-		"SELECT id, first_name, last_name, email, telephone, about, reg_time, avatar_address FROM users WHERE id=$1",
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.ReadUserWithEmail, err = h.DB.Preparex( // return user with such email
-		"SELECT id, first_name, last_name, email, telephone, about, reg_time, password_hash, avatar_address FROM users WHERE email=$1",
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.CreateUser, err = h.DB.PrepareNamed( // create new user
-		`INSERT INTO users
-			(first_name, last_name, email, password_hash, telephone, about, avatar_address)
-			VALUES
-			(:first_name, :last_name, :email, :password_hash, :telephone, :about, :avatar_address)
-			RETURNING id`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.CreateAd, err = h.DB.PrepareNamed( // create new ad
-		`INSERT INTO ads
-			(title, owner_ad, description_ad, price, country, city, subway_station, ad_images)
-			VALUES
-			(:title, :owner_ad, :description_ad, :price, :country, :city, :subway_station, string_to_array(:ad_images, ','))
-			RETURNING id`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.UpdateUser, err = h.DB.PrepareNamed( // update user
-		`UPDATE users SET
-			first_name=:first_name,
-			last_name=:last_name,
-			telephone=:telephone,
-			about=:about,
-			avatar_address=:avatar_address
-			WHERE id=:id`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.UpdateAd, err = h.DB.PrepareNamed( // update ad
-		`UPDATE ads SET
-			title=:title,
-			description_ad=:description_ad,
-			price=:price,
-			country=:country,
-			city=:city,
-			subway_station=:subway_station,
-			ad_images=string_to_array(:ad_images, ',')
-			WHERE id=:idad`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.DeleteUser, err = h.DB.Preparex( // delete user
-		`DELETE FROM users WHERE id=$1`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	if h.DeleteAd, err = h.DB.Preparex( // delete ad
-		`DELETE FROM ads WHERE id=$1`,
-	); err != nil {
-		log.Println(err.Error())
-
-		return err
-	}
-
-	return nil
-}
-
 // GetAds returns slice of model.AdItem from database based on incoming filters.
-func (h *Handler) GetAds(sp *model.SearchParams) ([]*model.AdItem, error) {
+func (h *Handler) GetAds(ctx context.Context, sp *model.SearchParams) ([]*model.AdItem, error) {
 	ads := make([]*model.AdItem, 0)
-	var err error
-	if sp.Query == "" {
-		err = h.ReadAds.Select(&ads, sp)
-	} else {
-		err = h.SearchAds.Select(&ads, sp)
+	query, args, err := sqlx.Named(searchQuery(sp), sp)
+	if err != nil {
+		log.Println(err.Error())
+		return ads, err
+	}
+	err = h.trgmQueryer(ctx, sp.IsFuzzy(), func(q sqlx.QueryerContext) error {
+		return sqlx.SelectContext(ctx, q, &ads, h.DB.Rebind(query), args...)
+	})
+	if sp.CursorID > 0 && sp.Backward {
+		// ads before cursor are selected in reverse order
+		for i, j := 0, len(ads)-1; i < j; i, j = i+1, j-1 {
+			ads[i], ads[j] = ads[j], ads[i]
+		}
 	}
 	if len(ads) != 0 {
 		for _, ad := range ads {
@@ -197,10 +49,24 @@ func (h *Handler) GetAds(sp *model.SearchParams) ([]*model.AdItem, error) {
 	return ads, err
 }
 
+// CountAds returns number of ads matching search parameters.
+func (h *Handler) CountAds(ctx context.Context, sp *model.SearchParams) (int64, error) {
+	var count int64
+	query, args, err := sqlx.Named(countQuery(sp), sp)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	err = h.trgmQueryer(ctx, sp.IsFuzzy(), func(q sqlx.QueryerContext) error {
+		return sqlx.GetContext(ctx, q, &count, h.DB.Rebind(query), args...)
+	})
+	return count, err
+}
+
 // GetAdsOfUser returns slice of model.AdItem with such user from database.
-func (h *Handler) GetAdsOfUser(userID int64) ([]*model.AdItem, error) {
+func (h *Handler) GetAdsOfUser(ctx context.Context, userID int64, sort string) ([]*model.AdItem, error) {
 	ads := make([]*model.AdItem, 0)
-	err := h.ReadAdsOfUser.Select(&ads, userID)
+	err := sqlx.SelectContext(ctx, h.queryer(), &ads, adsOfUserQuery(sort), userID)
 	if len(ads) != 0 {
 		for _, ad := range ads {
 			if ad.AdImagesStr.String != "" {
@@ -214,9 +80,9 @@ func (h *Handler) GetAdsOfUser(userID int64) ([]*model.AdItem, error) {
 }
 
 // GetAd returns model.AdItem struct with such ID.
-func (h *Handler) GetAd(adID int64) (*model.AdItem, error) {
+func (h *Handler) GetAd(ctx context.Context, adID int64) (*model.AdItem, error) {
 	ad := &model.AdItem{}
-	err := h.ReadAd.Get(ad, adID)
+	err := h.ReadAd.GetContext(ctx, ad, adID)
 	if ad.AdImagesStr.String != "" {
 		ad.AdImages = strings.Split(ad.AdImagesStr.String, ",")
 	} else {
@@ -229,9 +95,9 @@ func (h *Handler) GetAd(adID int64) (*model.AdItem, error) {
 }
 
 // GetUserWithID returns model.User struct with such ID.
-func (h *Handler) GetUserWithID(userID int64) (*model.User, error) {
+func (h *Handler) GetUserWithID(ctx context.Context, userID int64) (*model.User, error) {
 	user := &model.User{}
-	err := h.ReadUserWithID.Get(user, userID)
+	err := h.ReadUserWithID.GetContext(ctx, user, userID)
 	if err == sql.ErrNoRows { // is 'false' possible?
 		user.ID = -1
 	}
@@ -239,9 +105,9 @@ func (h *Handler) GetUserWithID(userID int64) (*model.User, error) {
 }
 
 // GetUserWithEmail returns model.User struct with such email.
-func (h *Handler) GetUserWithEmail(email string) (*model.User, error) {
+func (h *Handler) GetUserWithEmail(ctx context.Context, email string) (*model.User, error) {
 	user := &model.User{}
-	err := h.ReadUserWithEmail.Get(user, email)
+	err := h.ReadUserWithEmail.GetContext(ctx, user, email)
 	if err == sql.ErrNoRows {
 		user.ID = -1
 	}
@@ -249,10 +115,10 @@ func (h *Handler) GetUserWithEmail(email string) (*model.User, error) {
 }
 
 // NewUser adds new User to database if it is possible.
-func (h *Handler) NewUser(user *model.User) (int64, error) {
+func (h *Handler) NewUser(ctx context.Context, user *model.User) (int64, error) {
 	var lastInserted int64
 
-	err := h.CreateUser.Get(&lastInserted, user)
+	err := h.CreateUser.GetContext(ctx, &lastInserted, user)
 	if err != nil && err.Error() == notUniqueEmail {
 		lastInserted = -1
 	}
@@ -261,17 +127,48 @@ func (h *Handler) NewUser(user *model.User) (int64, error) {
 }
 
 // NewAd creates a new row in "ads" table in database.
-func (h *Handler) NewAd(ad *model.AdItem) (int64, error) {
+func (h *Handler) NewAd(ctx context.Context, ad *model.AdItem) (int64, error) {
 	var lastInserted int64
 	ad.AdImagesStr.SetValid(strings.Join(ad.AdImages, ","))
-	err := h.CreateAd.Get(&lastInserted, ad)
+	err := h.CreateAd.GetContext(ctx, &lastInserted, ad)
 
 	return lastInserted, err
 }
 
 // EditUser updates User with ID provided from function argument.
-func (h *Handler) EditUser(user *model.User) (int64, error) {
-	res, err := h.UpdateUser.Exec(user)
+func (h *Handler) EditUser(ctx context.Context, user *model.User) (int64, error) {
+	res, err := h.UpdateUser.ExecContext(ctx, user)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
+
+// EditPassword replaces hash of password of user with such ID.
+func (h *Handler) EditPassword(ctx context.Context, userID int64, hash string) (int64, error) {
+	res, err := h.UpdatePassword.ExecContext(ctx, userID, hash)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
+
+// SetNewEmail stores email which replaces email of user
+// with such ID after confirmation.
+func (h *Handler) SetNewEmail(ctx context.Context, userID int64, email string) (int64, error) {
+	res, err := h.UpdateNewEmail.ExecContext(ctx, userID, email)
 	if err != nil {
 		return -1, err
 	}
@@ -284,11 +181,30 @@ func (h *Handler) EditUser(user *model.User) (int64, error) {
 	return affected, nil
 }
 
+// ConfirmNewEmail replaces email of user with such ID by new one
+// and marks it as verified. It returns -1 if email isn't unique.
+func (h *Handler) ConfirmNewEmail(ctx context.Context, userID int64) (int64, error) {
+	res, err := h.UpdateEmail.ExecContext(ctx, userID)
+	if err != nil {
+		if err.Error() == notUniqueEmail {
+			return -1, err
+		}
+		return 0, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
+
 // EditAd updates information about ad with ID provided from function argument.
-func (h *Handler) EditAd(ad *model.AdItem) (int64, error) {
+func (h *Handler) EditAd(ctx context.Context, ad *model.AdItem) (int64, error) {
 	ad.AdImagesStr.SetValid(strings.Join(ad.AdImages, ","))
 
-	res, err := h.UpdateAd.Exec(ad)
+	res, err := h.UpdateAd.ExecContext(ctx, ad)
 	if err != nil {
 		return -1, err
 	}
@@ -302,8 +218,8 @@ func (h *Handler) EditAd(ad *model.AdItem) (int64, error) {
 }
 
 // RemoveUser deletes user with such ID from database.
-func (h *Handler) RemoveUser(userID int64) (int64, error) {
-	res, err := h.DeleteUser.Exec(userID)
+func (h *Handler) RemoveUser(ctx context.Context, userID int64) (int64, error) {
+	res, err := h.DeleteUser.ExecContext(ctx, userID)
 	if err != nil {
 		return -1, err
 	}
@@ -317,8 +233,8 @@ func (h *Handler) RemoveUser(userID int64) (int64, error) {
 }
 
 // RemoveAd deletes ad with such ID from database.
-func (h *Handler) RemoveAd(adID int64) (int64, error) {
-	res, err := h.DeleteAd.Exec(adID)
+func (h *Handler) RemoveAd(ctx context.Context, adID int64) (int64, error) {
+	res, err := h.DeleteAd.ExecContext(ctx, adID)
 	if err != nil {
 		return -1, err
 	}
@@ -330,3 +246,17 @@ func (h *Handler) RemoveAd(adID int64) (int64, error) {
 
 	return affected, nil
 }
+
+// GetCategories returns all categories ordered by ID.
+func (h *Handler) GetCategories(ctx context.Context) ([]*model.Category, error) {
+	categories := make([]*model.Category, 0)
+	err := h.ReadCategories.SelectContext(ctx, &categories)
+	return categories, err
+}
+
+// GetImages returns addresses of images of all ads and avatars of users.
+func (h *Handler) GetImages(ctx context.Context) ([]string, error) {
+	images := make([]string, 0)
+	err := h.ReadImages.SelectContext(ctx, &images)
+	return images, err
+}
@@ -5,9 +5,15 @@
 package db_test
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"gopkg.in/guregu/null.v3/zero"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
@@ -15,42 +21,88 @@ import (
 	"bmstu.codes/developers34/SBWeb/pkg/db"
 )
 
-func TestInit(t *testing.T) {
+// resetSchema reverts all migrations and applies them again.
+func resetSchema(t *testing.T, database *sqlx.DB) {
+	for {
+		version, err := db.MigrateDown(database)
+		if err != nil {
+			t.Fatal("Unexpected error", err.Error())
+		}
+		if version == 0 {
+			break
+		}
+	}
+
+	if _, err := db.MigrateUp(database); err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+}
+
+func TestMigrate(t *testing.T) {
 	cfg := db.Config{
 		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
 		MaxOpenConns: 10,
 	}
 
-	database, _ := sql.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS users
-(
-    id                SERIAL      PRIMARY KEY,
-    first_name        varchar(80) NOT NULL,
-    last_name         varchar(80) NOT NULL,
-    email             varchar(80) UNIQUE NOT NULL,
-    password_hash     text        NOT NULL,
-    telephone         varchar(80),
-    about             text,
-    avatar_address    text,
-    reg_time          timestamp   DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS ads
-(
-    id             SERIAL       PRIMARY KEY,
-    title          varchar(80)  NOT NULL,
-    price          integer      CONSTRAINT positive_price CHECK (price > 0),
-    country        varchar(80),
-    city           varchar(80),
-    subway_station varchar(80),
-    ad_images      varchar(256)[],
-    -- when deleting user we should delete his ads
-    owner_ad       integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
-    description_ad text,
-    creation_time  timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	defer database.Close()
+	resetSchema(t, database)
+
+	version, err := db.SchemaVersion(database)
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if version != db.LatestVersion() {
+		t.Error("Expected latest version got", version)
+	}
+
+	out := &bytes.Buffer{}
+	if err = db.Migrate(cfg, "up", out); err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if out.String() != "schema is up to date\n" {
+		t.Error("Unexpected output", out.String())
+	}
 
+	out.Reset()
+	if err = db.Migrate(cfg, "down", out); err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if !strings.HasPrefix(out.String(), "reverted") {
+		t.Error("Unexpected output", out.String())
+	}
+
+	out.Reset()
+	if err = db.Migrate(cfg, "status", out); err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if !strings.Contains(out.String(), "pending") {
+		t.Error("Unexpected output", out.String())
+	}
+
+	statuses, err := db.MigrationsStatus(database)
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if len(statuses) != db.LatestVersion() || statuses[len(statuses)-1].Applied {
+		t.Error("Expected last migration not applied")
+	}
+
+	out.Reset()
+	if err = db.Migrate(cfg, "up", out); err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if !strings.HasPrefix(out.String(), "applied") {
+		t.Error("Unexpected output", out.String())
+	}
+
+	if err = db.Migrate(cfg, "sideways", out); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestInit(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
+	resetSchema(t, database)
 	database.Close()
 
 	_, err := db.InitConnDB(cfg)
@@ -73,8 +125,19 @@ func TestInit(t *testing.T) {
 		MaxOpenConns: 10,
 	}
 
-	database, _ = sql.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
-	database.Exec("DROP TABLE ads")
+	database, _ = sqlx.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
+	// alerts reference ads, so they are dropped too
+	if _, err = database.Exec("DROP TABLE ads CASCADE"); err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+
+	_, err = db.InitConnDB(cfg)
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	// schema is behind
+	db.MigrateDown(database)
 	database.Close()
 
 	_, err = db.InitConnDB(cfg)
@@ -89,35 +152,8 @@ func TestInterface(t *testing.T) {
 		MaxOpenConns: 10,
 	}
 
-	database, _ := sql.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS users
-(
-    id                SERIAL      PRIMARY KEY,
-    first_name        varchar(80) NOT NULL,
-    last_name         varchar(80) NOT NULL,
-    email             varchar(80) UNIQUE NOT NULL,
-    password_hash     text        NOT NULL,
-    telephone         varchar(80),
-    about             text,
-    avatar_address    text,
-    reg_time          timestamp   DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
-	database.Exec(`
-	CREATE TABLE IF NOT EXISTS ads
-(
-    id             SERIAL       PRIMARY KEY,
-    title          varchar(80)  NOT NULL,
-    price          integer      CONSTRAINT positive_price CHECK (price > 0),
-    country        varchar(80),
-    city           varchar(80),
-    subway_station varchar(80),
-    ad_images      varchar(256)[],
-    -- when deleting user we should delete his ads
-    owner_ad       integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
-    description_ad text,
-    creation_time  timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL
-);`)
+	database, _ := sqlx.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
+	resetSchema(t, database)
 
 	database.Exec(`INSERT INTO users
 	(first_name, last_name, email, password_hash)
@@ -138,8 +174,9 @@ func TestInterface(t *testing.T) {
 
 	h, err := db.InitConnDB(cfg)
 	if err != nil {
-		t.Error("Unexpected error", err.Error())
+		t.Fatal("Unexpected error", err.Error())
 	}
+	ctx := context.Background()
 
 	user := model.User{
 		ID:        1,
@@ -183,7 +220,7 @@ func TestInterface(t *testing.T) {
 		City:        "Moscow",
 	}
 
-	ads, err := h.GetAds(&model.SearchParams{
+	ads, err := h.GetAds(ctx, &model.SearchParams{
 		Limit:  15,
 		Offset: 0,
 	})
@@ -195,9 +232,9 @@ func TestInterface(t *testing.T) {
 		t.Error("Expected equal ads")
 	}
 
-	ads, err = h.GetAds(&model.SearchParams{
+	ads, err = h.GetAds(ctx, &model.SearchParams{
 		Limit:  15,
-		Query:  "that",
+		Query:  "built",
 		Offset: 0,
 	})
 	if err != nil {
@@ -208,7 +245,7 @@ func TestInterface(t *testing.T) {
 		t.Error("Expected equal ads")
 	}
 
-	ads, err = h.GetAdsOfUser(1)
+	ads, err = h.GetAdsOfUser(ctx, 1, "")
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if len(ads) != 2 {
@@ -217,84 +254,876 @@ func TestInterface(t *testing.T) {
 		t.Error("Expected equal ads")
 	}
 
-	ad, err := h.GetAd(1)
+	ad, err := h.GetAd(ctx, 1)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if ad.Title != ad1.Title {
 		t.Error("Expected equal ads")
 	}
 
-	ad, _ = h.GetAd(15)
+	ad, _ = h.GetAd(ctx, 15)
 	if ad.ID != -1 {
 		t.Error("Expected ID = -1")
 	}
 
-	u, err := h.GetUserWithID(1)
+	// ad shows whether email of owner is verified
+	if ad, _ = h.GetAd(ctx, 1); ad.EmailVerified {
+		t.Error("Expected not verified email of owner")
+	}
+	h.VerifyEmail(ctx, 1)
+	if ad, _ = h.GetAd(ctx, 1); !ad.EmailVerified {
+		t.Error("Expected verified email of owner")
+	}
+
+	u, err := h.GetUserWithID(ctx, 1)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if u.FirstName != user.FirstName {
 		t.Error("Expected equal users")
 	}
 
-	u, _ = h.GetUserWithID(15)
+	u, _ = h.GetUserWithID(ctx, 15)
 	if u.ID != -1 {
 		t.Error("Expected ID = -1")
 	}
 
-	u, err = h.GetUserWithEmail("ivan@gmail.com")
+	u, err = h.GetUserWithEmail(ctx, "ivan@gmail.com")
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if u.FirstName != user.FirstName {
 		t.Error("Expected equal users")
 	}
 
-	u, _ = h.GetUserWithEmail("feffr2C")
+	u, _ = h.GetUserWithEmail(ctx, "feffr2C")
 	if u.ID != -1 {
 		t.Error("Expected ID = -1")
 	}
 
-	id, _ := h.NewUser(&user)
+	id, _ := h.NewUser(ctx, &user)
 	if id != -1 {
 		t.Error("Expected ID = -1 got = ", id)
 	}
 
-	_, err = h.NewUser(&userNew)
+	_, err = h.NewUser(ctx, &userNew)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	}
 
-	id, err = h.NewAd(&adNew)
+	id, err = h.NewAd(ctx, &adNew)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if id != 3 {
 		t.Error("Expected id = 3 got = ", id)
 	}
 
-	id, err = h.EditUser(&user)
+	id, err = h.EditUser(ctx, &user)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if id != 1 {
 		t.Error("Expected id = 1 got = ", id)
 	}
 
-	id, err = h.EditAd(&ad1)
+	id, err = h.EditAd(ctx, &ad1)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if id != 1 {
 		t.Error("Expected id = 1 got = ", id)
 	}
 
-	id, err = h.RemoveAd(1)
+	id, err = h.RemoveAd(ctx, 1)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if id != 1 {
 		t.Error("Expected id = 1 got = ", id)
 	}
 
-	id, err = h.RemoveUser(1)
+	id, err = h.RemoveUser(ctx, 1)
 	if err != nil {
 		t.Error("Unexpected error", err.Error())
 	} else if id != 1 {
 		t.Error("Expected id = 1 got = ", id)
 	}
 }
+
+func TestSearchAds(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city, price, ad_images)
+	VALUES
+	('Ремонт квартир', 1, 'Укладываем плитку в ванной <быстро>', 'Москва', NULL, NULL),
+	('Укладка плитки', 1, 'Плитка любой сложности', 'Москва', 500, '{}'),
+	('Building', 1, 'Roofs and walls', 'Moscow', 1500, '{/images/a.png}')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	// words are stemmed and title is ranked higher than description
+	ads, err := h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "укладка плитки"})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(ads) != 2 || ads[0].ID != 2 || ads[1].ID != 1 {
+		t.Fatal("Expected second and first ads", len(ads))
+	}
+	if ads[0].TitleSnippet != "<b>Укладка</b> <b>плитки</b>" {
+		t.Error("Unexpected snippet", ads[0].TitleSnippet)
+	}
+	if !strings.Contains(ads[1].DescriptionSnippet, "<b>плитку</b>") ||
+		!strings.Contains(ads[1].DescriptionSnippet, "&lt;быстро&gt;") {
+		t.Error("Unexpected snippet", ads[1].DescriptionSnippet)
+	}
+
+	// english words are stemmed too
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "roof"})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "Moscow"})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "нет такого"})
+	if len(ads) != 0 {
+		t.Error("Expected no ads")
+	}
+
+	// filters are combined with query
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "плитки", City: "МОСКВА", MaxPrice: 1000})
+	if len(ads) != 1 || ads[0].ID != 2 {
+		t.Error("Expected second ad")
+	}
+
+	hasImages := true
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, HasImages: &hasImages})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{
+		Limit:         15,
+		MinPrice:      100,
+		OwnerID:       1,
+		CreatedAfter:  time.Now().Add(-time.Hour),
+		CreatedBefore: time.Now().Add(time.Hour),
+	})
+	if len(ads) != 2 || ads[0].ID != 2 || ads[1].ID != 3 {
+		t.Error("Expected second and third ads")
+	}
+
+	// ads without price are the last ones
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Sort: model.SortPriceDesc})
+	if len(ads) != 3 || ads[0].ID != 3 || ads[1].ID != 2 || ads[2].ID != 1 {
+		t.Error("Expected ads ordered by price")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Sort: model.SortPriceAsc})
+	if len(ads) != 3 || ads[0].ID != 2 || ads[1].ID != 3 || ads[2].ID != 1 {
+		t.Error("Expected ads ordered by price")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 2, Offset: 1, Sort: model.SortNewest})
+	if len(ads) != 2 || ads[0].ID != 2 || ads[1].ID != 1 {
+		t.Error("Expected ads ordered by time of creation")
+	}
+
+	ads, _ = h.GetAdsOfUser(ctx, 1, model.SortNewest)
+	if len(ads) != 3 || ads[0].ID != 3 {
+		t.Error("Expected ads of user ordered by time of creation")
+	}
+
+	// keyset pagination after and before the second ad
+	second, _ := h.GetAd(ctx, 2)
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, CursorTime: second.CreationTime, CursorID: 2})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Sort: model.SortNewest,
+		CursorTime: second.CreationTime, CursorID: 2, Backward: true})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+
+	count, err := h.CountAds(ctx, &model.SearchParams{Limit: 1, Query: "плитки", City: "Москва"})
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if count != 2 {
+		t.Error("Expected 2 ads got", count)
+	}
+}
+
+func TestGeoSearch(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city, latitude, longitude)
+	VALUES
+	('Roof', 1, 'Roofs', 'Zelenograd', 55.9825, 37.1814),
+	('Roof', 1, 'Roofs', 'Saint Petersburg', 59.9343, 30.3351),
+	('Roof', 1, 'Roofs', 'Moscow', 55.7601, 37.6186),
+	('Roof', 1, 'Roofs', 'Moscow', NULL, NULL)`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	latitude, longitude := 55.7558, 37.6173
+	sp := &model.SearchParams{
+		Limit:     15,
+		Latitude:  &latitude,
+		Longitude: &longitude,
+		RadiusKm:  50,
+		Sort:      model.SortDistance,
+	}
+	ads, err := h.GetAds(ctx, sp)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(ads) != 2 || ads[0].ID != 3 || ads[1].ID != 1 {
+		t.Fatal("Expected ads in Moscow and Zelenograd", len(ads))
+	}
+	if ads[0].Distance == nil || *ads[0].Distance > 1 || *ads[1].Distance < 36 || *ads[1].Distance > 38 {
+		t.Error("Unexpected distance")
+	}
+	if *ads[0].Latitude != 55.7601 || *ads[0].Longitude != 37.6186 {
+		t.Error("Unexpected location")
+	}
+	if count, _ := h.CountAds(ctx, sp); count != 2 {
+		t.Error("Expected 2 ads got", count)
+	}
+
+	// only one coordinate can't be set
+	_, err = h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, Description: "Roofs", City: "Moscow", Latitude: &latitude})
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15})
+	if len(ads) != 4 || ads[0].Distance != nil || ads[3].Latitude != nil {
+		t.Error("Expected location without distance")
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", "postgresql://runner:@postgres/data?sslmode=disable")
+	resetSchema(t, database)
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	user := model.User{
+		FirstName: "Ivan",
+		LastName:  "Ivanov",
+		Email:     "ivan@gmail.com",
+		Password:  "123456",
+	}
+
+	// failed transaction mustn't change anything
+	errTx := errors.New("Rollback")
+	err = h.WithTx(ctx, func(tx model.DB) error {
+		if _, err := tx.NewUser(ctx, &user); err != nil {
+			t.Error("Unexpected error", err.Error())
+		}
+		return errTx
+	})
+	if err != errTx {
+		t.Error("Expected error of transaction")
+	}
+	if u, _ := h.GetUserWithEmail(ctx, user.Email); u.ID != -1 {
+		t.Error("Expected user to be rolled back")
+	}
+
+	// changes of succeeded transaction are visible
+	var id int64
+	err = h.WithTx(ctx, func(tx model.DB) error {
+		var err error
+		id, err = tx.NewUser(ctx, &user)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewAd(ctx, &model.AdItem{
+			Title:       "Building",
+			UserID:      id,
+			Description: "Some description",
+			City:        "Moscow",
+		})
+		return err
+	})
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	}
+	if ads, _ := h.GetAdsOfUser(ctx, id, ""); len(ads) != 1 {
+		t.Error("Expected 1 ad got", len(ads))
+	}
+
+	// all statements are bound to transaction
+	h.WithTx(ctx, func(tx model.DB) error {
+		txValue := reflect.ValueOf(tx.(*db.Handler)).Elem()
+		value := reflect.ValueOf(h).Elem()
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.Type != reflect.TypeOf(&sqlx.Stmt{}) &&
+				field.Type != reflect.TypeOf(&sqlx.NamedStmt{}) {
+				continue
+			}
+			if txValue.Field(i).IsNil() || txValue.Field(i).Pointer() == value.Field(i).Pointer() {
+				t.Error("Expected statement bound to transaction", field.Name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestCategories(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	// initial categories are created by migration
+	var parent string
+	err := database.Get(&parent, `SELECT parent.slug FROM categories
+		INNER JOIN categories parent ON parent.id = categories.parent_id
+		WHERE categories.slug = 'roofs'`)
+	if err != nil || parent != "construction" {
+		t.Error("Expected initial categories", parent, err)
+	}
+	if _, err = database.Exec("TRUNCATE categories RESTART IDENTITY CASCADE"); err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO categories
+	(parent_id, slug, name)
+	VALUES
+	(NULL, 'repair', 'Repair'),
+	(1, 'plumbing', 'Plumbing'),
+	(2, 'boilers', 'Boilers'),
+	(NULL, 'roofs', 'Roofs')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city, category_id)
+	VALUES
+	('Boiler', 1, 'Boilers', 'Moscow', 3),
+	('Pipes', 1, 'Pipes', 'Moscow', 2),
+	('Roof', 1, 'Roofs', 'Moscow', 4),
+	('Anything', 1, 'Anything', 'Moscow', NULL)`)
+
+	if _, err := database.Exec(`INSERT INTO categories (slug, name) VALUES ('Bad slug', 'Bad')`); err == nil {
+		t.Error("Expected error of slug")
+	}
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	categories, err := h.GetCategories(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(categories) != 4 || categories[2].Slug != "boilers" || categories[2].ParentID.Int64 != 2 ||
+		categories[0].ParentID.Valid {
+		t.Error("Unexpected categories", len(categories))
+	}
+
+	for _, c := range []struct {
+		slug  string
+		count int
+	}{
+		{"repair", 2},
+		{"plumbing", 2},
+		{"boilers", 1},
+		{"unknown", 0},
+	} {
+		sp := &model.SearchParams{Limit: 15, Category: c.slug}
+		ads, err := h.GetAds(ctx, sp)
+		if err != nil {
+			t.Fatal("Unexpected error", err.Error())
+		}
+		if len(ads) != c.count {
+			t.Error("Expected", c.count, "ads of", c.slug, "got", len(ads))
+		}
+		if count, _ := h.CountAds(ctx, sp); count != int64(c.count) {
+			t.Error("Expected", c.count, "ads of", c.slug, "got", count)
+		}
+	}
+
+	ad, _ := h.GetAd(ctx, 1)
+	if ad.CategoryID.Int64 != 3 {
+		t.Error("Expected category of ad")
+	}
+	ad.CategoryID = zero.IntFrom(4)
+	if _, err := h.EditAd(ctx, ad); err != nil {
+		t.Error("Unexpected error", err.Error())
+	}
+	if _, err := h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, Description: "Roofs", City: "Moscow", CategoryID: zero.IntFrom(10)}); err == nil {
+		t.Error("Expected error of category")
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456'),
+	('Petr', 'Petrov', 'petr@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city)
+	VALUES
+	('Roof', 2, 'Roofs', 'Moscow'),
+	('Boiler', 2, 'Boilers', 'Moscow')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	id, err := h.NewSavedSearch(ctx, &model.SavedSearch{UserID: 1, Name: "Roofs",
+		Params: model.SearchParams{Query: "roof", City: "Moscow"}}, 20)
+	if err != nil || id != 1 {
+		t.Fatal("Unexpected error", err)
+	}
+	h.NewSavedSearch(ctx, &model.SavedSearch{UserID: 2, Name: "Anything"}, 20)
+	if id, err = h.NewSavedSearch(ctx, &model.SavedSearch{UserID: 2, Name: "Anything"}, 1); err != nil || id != 0 {
+		t.Error("Expected no search over limit", id, err)
+	}
+
+	searches, err := h.GetSavedSearches(ctx, 1)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(searches) != 1 || searches[0].Name != "Roofs" || searches[0].Params.Query != "roof" ||
+		searches[0].Params.City != "Moscow" || searches[0].CheckedTime.IsZero() {
+		t.Error("Unexpected saved searches", len(searches))
+	}
+	if searches, _ = h.GetAllSavedSearches(ctx); len(searches) != 2 {
+		t.Error("Expected searches of all users")
+	}
+
+	checked := time.Now()
+	added, err := h.AddAlerts(ctx, 1, []int64{1, 2, 10}, checked)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(added) != 2 {
+		t.Error("Expected alerts about existing ads", added)
+	}
+	if added, _ = h.AddAlerts(ctx, 1, []int64{1}, checked); len(added) != 0 {
+		t.Error("Expected no new alerts", added)
+	}
+	if added, _ = h.AddAlerts(ctx, 1, nil, checked); len(added) != 0 {
+		t.Error("Expected no new alerts", added)
+	}
+
+	alerts, err := h.GetAlerts(ctx, 1, 15, 0)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(alerts) != 2 || alerts[0].AdTitle != "Boiler" || alerts[0].SearchName != "Roofs" {
+		t.Error("Unexpected alerts", len(alerts))
+	}
+	if alerts, _ = h.GetAlerts(ctx, 2, 15, 0); len(alerts) != 0 {
+		t.Error("Expected no alerts of other user")
+	}
+
+	if affected, _ := h.RemoveSavedSearch(ctx, 2, 1); affected != 0 {
+		t.Error("Search of other user mustn't be removed")
+	}
+	if affected, _ := h.RemoveSavedSearch(ctx, 1, 1); affected != 1 {
+		t.Error("Expected removing of search")
+	}
+	if alerts, _ = h.GetAlerts(ctx, 1, 15, 0); len(alerts) != 0 {
+		t.Error("Expected removing of alerts with search")
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city, subway_station)
+	VALUES
+	('Монтаж котла', 1, 'Котлы', 'Москва', NULL),
+	('монтаж котла', 1, 'Котлы', 'Москва', 'Мякинино'),
+	('Монтаж крыши', 1, 'Крыши', 'Тверь', NULL),
+	('Roof 100%', 1, 'Roofs', 'Moscow', NULL),
+	('Roof 1000', 1, 'Roofs', 'Moscow', NULL)`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	suggestions, err := h.GetSuggestions(ctx, "Мо", 10)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(suggestions) != 3 || suggestions[0].Text != "Монтаж котла" || suggestions[0].Count != 2 ||
+		suggestions[1].Text != "Москва" || suggestions[1].Kind != model.SuggestCity {
+		t.Error("Unexpected suggestions", len(suggestions))
+	}
+	if suggestions, _ = h.GetSuggestions(ctx, "мяк", 10); len(suggestions) != 1 ||
+		suggestions[0].Kind != model.SuggestSubwayStation {
+		t.Error("Expected suggestion of subway station")
+	}
+	// wildcards of prefix are escaped
+	if suggestions, _ = h.GetSuggestions(ctx, "roof 100%", 10); len(suggestions) != 1 {
+		t.Error("Expected only suggestion with percent sign")
+	}
+}
+
+func TestFacets(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city, country, subway_station, price)
+	VALUES
+	('Roof', 1, 'Roofs', 'Moscow', 'Russia', NULL, 500),
+	('Roof', 1, 'Roofs', 'moscow', NULL, NULL, 1000),
+	('Roof', 1, 'Roofs', 'Kazan', NULL, NULL, 4999),
+	('Roof', 1, 'Roofs', 'Moscow', NULL, 'Arbatskaya', 200000),
+	('Boiler', 1, 'Boilers', 'Kazan', NULL, NULL, NULL)`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	facets, err := h.GetFacets(ctx, &model.SearchParams{Query: "roof", Limit: 1})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(facets.Cities) != 2 || facets.Cities[0].Value != "Moscow" || facets.Cities[0].Count != 3 {
+		t.Error("Unexpected facets of cities", len(facets.Cities))
+	}
+	if len(facets.Countries) != 1 || len(facets.SubwayStations) != 1 {
+		t.Error("Unexpected facets of countries and subway stations")
+	}
+	prices := facets.Prices
+	if len(prices) != 3 || prices[0].Max != 1000 || prices[0].Count != 1 ||
+		prices[1].Min != 1000 || prices[1].Count != 2 || prices[2].Min != 100000 || prices[2].Max != 0 {
+		t.Error("Unexpected facets of prices")
+	}
+
+	facets, _ = h.GetFacets(ctx, &model.SearchParams{City: "kazan"})
+	if len(facets.Cities) != 1 || facets.Cities[0].Count != 2 || len(facets.Prices) != 1 {
+		t.Error("Expected facets of filtered ads")
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Exec(`INSERT INTO ads
+	(title, owner_ad, description_ad, city)
+	VALUES
+	('Монтаж котла', 1, 'Котлы', 'Москва'),
+	('Ремонт крыши', 1, 'Крыши', 'Тверь'),
+	('Roof repair', 1, 'Roofs', 'Moscow')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	if ads, _ := h.GetAds(ctx, &model.SearchParams{Query: "котел", Limit: 10}); len(ads) != 0 {
+		t.Error("Expected no ads found exactly")
+	}
+	ads, err := h.GetAds(ctx, &model.SearchParams{Query: "котел", Fuzzy: true, Limit: 10})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(ads) != 1 || ads[0].ID != 1 || ads[0].TitleSnippet != "" {
+		t.Error("Expected ad with similar title without snippets")
+	}
+	if ads, _ = h.GetAds(ctx, &model.SearchParams{Query: "Масква", Fuzzy: true, Limit: 10}); len(ads) != 1 || ads[0].ID != 1 {
+		t.Error("Expected ad with similar city")
+	}
+	if count, _ := h.CountAds(ctx, &model.SearchParams{Query: "repiar", Fuzzy: true}); count != 1 {
+		t.Error("Expected 1 ad counted got", count)
+	}
+
+	words, err := h.GetSimilarWords(ctx, "Котел", 3)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(words) != 1 || words[0] != "котла" {
+		t.Error("Unexpected similar words", words)
+	}
+
+	// words of removed ads aren't suggested
+	h.RemoveAd(ctx, 1)
+	if words, _ = h.GetSimilarWords(ctx, "Котел", 3); len(words) != 0 {
+		t.Error("Expected no words of removed ad", words)
+	}
+	if words, _ = h.GetSimilarWords(ctx, "Тверь", 3); len(words) != 1 {
+		t.Error("Expected words of other ads", words)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	if u, _ := h.GetUserWithID(ctx, 1); u.EmailVerified {
+		t.Error("Expected not verified email of new user")
+	}
+
+	err = h.NewToken(ctx, &model.Token{Hash: "a", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if id, _ := h.UseToken(ctx, "a", "other"); id != -1 {
+		t.Error("Expected no token of other kind")
+	}
+	id, err := h.UseToken(ctx, "a", model.TokenVerifyEmail)
+	if err != nil || id != 1 {
+		t.Error("Expected user of token got", id)
+	}
+	if id, _ = h.UseToken(ctx, "a", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected token can be used once")
+	}
+
+	// new token replaces previous one
+	h.NewToken(ctx, &model.Token{Hash: "b", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.NewToken(ctx, &model.Token{Hash: "c", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if id, _ = h.UseToken(ctx, "b", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected replaced token can't be used")
+	}
+	h.NewToken(ctx, &model.Token{Hash: "d", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(-time.Second)})
+	if id, _ = h.UseToken(ctx, "d", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected expired token can't be used")
+	}
+
+	// added tokens are kept
+	h.AddToken(ctx, &model.Token{Hash: "e", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.AddToken(ctx, &model.Token{Hash: "f", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.AddToken(ctx, &model.Token{Hash: "g", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if id, _ = h.UseToken(ctx, "e", model.TokenRefresh); id != 1 {
+		t.Error("Expected added token can be used")
+	}
+	if n, _ := h.RemoveTokens(ctx, 1, model.TokenRefresh); n != 2 {
+		t.Error("Expected 2 tokens removed got", n)
+	}
+	if id, _ = h.UseToken(ctx, "f", model.TokenRefresh); id != -1 {
+		t.Error("Expected removed token can't be used")
+	}
+
+	if n, err := h.VerifyEmail(ctx, 1); err != nil || n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithID(ctx, 1); !u.EmailVerified {
+		t.Error("Expected verified email")
+	}
+}
+
+func TestEditPassword(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	if n, err := h.EditPassword(ctx, 1, "654321"); err != nil || n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithEmail(ctx, "ivan@gmail.com"); u.Password != "654321" {
+		t.Error("Expected new hash of password")
+	}
+	if n, _ := h.EditPassword(ctx, 2, "654321"); n != 0 {
+		t.Error("Expected no users updated got", n)
+	}
+}
+
+func TestNewEmail(t *testing.T) {
+	cfg := db.Config{
+		DBAddress:    "postgresql://runner:@postgres/data?sslmode=disable",
+		MaxOpenConns: 10,
+	}
+
+	database, _ := sqlx.Open("postgres", cfg.DBAddress)
+	resetSchema(t, database)
+
+	database.Exec(`INSERT INTO users
+	(first_name, last_name, email, password_hash)
+	VALUES
+	('Ivan', 'Ivanov', 'ivan@gmail.com', '123456'),
+	('Petr', 'Petrov', 'petr@gmail.com', '123456')`)
+
+	database.Close()
+
+	h, err := db.InitConnDB(cfg)
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	ctx := context.Background()
+
+	if n, _ := h.ConfirmNewEmail(ctx, 1); n != 0 {
+		t.Error("Expected no new email got", n)
+	}
+
+	h.SetNewEmail(ctx, 1, "petr@gmail.com")
+	if n, err := h.ConfirmNewEmail(ctx, 1); n != -1 || err == nil {
+		t.Error("Expected error of not unique email")
+	}
+
+	if n, err := h.SetNewEmail(ctx, 1, "ivanov@gmail.com"); err != nil || n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if n, err := h.ConfirmNewEmail(ctx, 1); err != nil || n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithID(ctx, 1); u.Email != "ivanov@gmail.com" || !u.EmailVerified {
+		t.Error("Expected new verified email", u.Email)
+	}
+	if n, _ := h.ConfirmNewEmail(ctx, 1); n != 0 {
+		t.Error("Expected new email can be confirmed once")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// GetFacets returns numbers of ads matching search parameters grouped
+// by country, city, subway station and bucket of price. Limit, offset
+// and cursor of search parameters aren't used.
+func (h *Handler) GetFacets(ctx context.Context, sp *model.SearchParams) (*model.Facets, error) {
+	facets := &model.Facets{
+		Prices: make([]*model.PriceBucket, 0),
+	}
+	for _, f := range []struct {
+		column string
+		values *[]*model.FacetValue
+	}{
+		{"ads.country", &facets.Countries},
+		{"ads.city", &facets.Cities},
+		{"ads.subway_station", &facets.SubwayStations},
+	} {
+		*f.values = make([]*model.FacetValue, 0)
+		if err := h.selectFacet(ctx, f.values, facetQuery(sp, f.column), sp); err != nil {
+			return nil, err
+		}
+	}
+
+	buckets := make([]struct {
+		Bucket int   `db:"bucket"`
+		Count  int64 `db:"count"`
+	}, 0)
+	if err := h.selectFacet(ctx, &buckets, priceFacetQuery(sp), sp); err != nil {
+		return nil, err
+	}
+	for _, b := range buckets {
+		bucket := model.NewPriceBucket(b.Bucket)
+		bucket.Count = b.Count
+		facets.Prices = append(facets.Prices, bucket)
+	}
+
+	return facets, nil
+}
+
+// selectFacet selects rows of facet query with named parameters to dest.
+func (h *Handler) selectFacet(ctx context.Context, dest interface{}, query string, sp *model.SearchParams) error {
+	query, args, err := sqlx.Named(query, sp)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	return h.trgmQueryer(ctx, sp.IsFuzzy(), func(q sqlx.QueryerContext) error {
+		return sqlx.SelectContext(ctx, q, dest, h.DB.Rebind(query), args...)
+	})
+}
+
+// facetQuery returns query with named parameters which counts ads matching
+// search parameters for every value of column ignoring case. Value is chosen
+// in "C" collation to be the same in any locale of database.
+func facetQuery(sp *model.SearchParams, column string) string {
+	return `SELECT min(` + column + ` COLLATE "C") "value", count(*) "count" FROM ` +
+		countTables(sp) + where(append(filters(sp), column+" IS NOT NULL", column+" <> ''")) +
+		" GROUP BY lower(" + column + ") ORDER BY count DESC, value LIMIT " +
+		strconv.Itoa(model.MaxFacetValues)
+}
+
+// priceFacetQuery returns query with named parameters which counts ads
+// matching search parameters for every non-empty bucket of price.
+func priceFacetQuery(sp *model.SearchParams) string {
+	bounds := make([]string, len(model.PriceBuckets))
+	for i, bound := range model.PriceBuckets {
+		bounds[i] = strconv.FormatInt(bound, 10)
+	}
+	return `SELECT width_bucket(ads.price, ARRAY[` + strings.Join(bounds, ",") + `]) "bucket", count(*) "count" FROM ` +
+		countTables(sp) + where(append(filters(sp), "ads.price IS NOT NULL")) +
+		" GROUP BY bucket ORDER BY bucket"
+}
@@ -10,19 +10,39 @@ import (
 
 // Handler is used to store database connection and
 // implements database interface needed by API.
+// Handler which is passed to function of WithTx has
+// statements bound to transaction tx. Statements are
+// prepared from the list of Handler.statements.
 type Handler struct {
 	DB *sqlx.DB
+	tx *sqlx.Tx
 
 	CreateUser        *sqlx.NamedStmt
 	CreateAd          *sqlx.NamedStmt
 	UpdateUser        *sqlx.NamedStmt
 	UpdateAd          *sqlx.NamedStmt
-	ReadAds           *sqlx.NamedStmt
-	SearchAds         *sqlx.NamedStmt
-	ReadAdsOfUser     *sqlx.Stmt
 	ReadAd            *sqlx.Stmt
 	ReadUserWithID    *sqlx.Stmt
 	ReadUserWithEmail *sqlx.Stmt
 	DeleteUser        *sqlx.Stmt
 	DeleteAd          *sqlx.Stmt
+	ReadCategories    *sqlx.Stmt
+	ReadImages        *sqlx.Stmt
+	LockUser          *sqlx.Stmt
+
+	CreateSavedSearch    *sqlx.NamedStmt
+	ReadSavedSearches    *sqlx.Stmt
+	ReadAllSavedSearches *sqlx.Stmt
+	DeleteSavedSearch    *sqlx.Stmt
+	CreateAlerts         *sqlx.Stmt
+	ReadAlerts           *sqlx.Stmt
+
+	UpdateEmailVerified *sqlx.Stmt
+	UpdatePassword      *sqlx.Stmt
+	UpdateNewEmail      *sqlx.Stmt
+	UpdateEmail         *sqlx.Stmt
+	CreateToken         *sqlx.NamedStmt
+	DeleteToken         *sqlx.Stmt
+	InsertToken         *sqlx.NamedStmt
+	DeleteUserTokens    *sqlx.Stmt
 }
@@ -5,6 +5,7 @@
 package db
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/jmoiron/sqlx"
@@ -12,7 +13,8 @@ import (
 )
 
 // InitConnDB initiates connection to database and prepare statements
-// for interaction with database.
+// for interaction with database. It refuses to work with database which
+// schema is older than required; migrations must be applied before.
 func InitConnDB(cfg Config) (*Handler, error) {
 	db, err := sqlx.Open("postgres", cfg.DBAddress)
 	if err != nil {
@@ -28,6 +30,17 @@ func InitConnDB(cfg Config) (*Handler, error) {
 		return nil, err
 	}
 
+	version, err := SchemaVersion(db)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	if version < LatestVersion() {
+		err = fmt.Errorf("Schema of database has version %d but %d is required, run migrations", version, LatestVersion())
+		log.Println(err.Error())
+		return nil, err
+	}
+
 	handler := &Handler{
 		DB: db,
 	}
@@ -0,0 +1,231 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationLock is a key of postgres advisory lock that prevents
+// several instances of service from migrating at the same time.
+const migrationLock = 34034034
+
+// migration describes one versioned change of database schema.
+// Up applies change and down reverts it.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus describes state of one migration in database.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LatestVersion returns version of schema that is required by this package.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// createMigrationsTable creates table with applied migrations if needed.
+func createMigrationsTable(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    integer   PRIMARY KEY,
+    applied_at timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+// SchemaVersion returns version of the last applied migration.
+// It returns 0 if no migrations were applied.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return version, err
+}
+
+// MigrateUp applies all migrations that weren't applied yet. Every
+// migration is applied in own transaction. It returns versions of
+// applied migrations.
+func MigrateUp(db *sqlx.DB) ([]int, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	applied := make([]int, 0)
+	for _, m := range migrations {
+		ok, err := runMigration(db, m, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %v", m.version, m.name, err)
+		}
+		if ok {
+			applied = append(applied, m.version)
+		}
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the last applied migration. It returns version
+// of reverted migration or 0 if there was nothing to revert.
+func MigrateDown(db *sqlx.DB) (int, error) {
+	version, err := SchemaVersion(db)
+	if err != nil || version == 0 {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if m.version != version {
+			continue
+		}
+		if _, err := runMigration(db, m, false); err != nil {
+			return 0, fmt.Errorf("migration %d (%s): %v", m.version, m.name, err)
+		}
+		return version, nil
+	}
+
+	return 0, fmt.Errorf("migration %d is unknown", version)
+}
+
+// MigrationsStatus returns state of every known migration.
+func MigrationsStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	if err := createMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows := []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}{}
+	if err := db.Select(&rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := appliedAt[m.version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.version,
+			Name:      m.name,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+
+	return statuses, nil
+}
+
+// runMigration applies (up is true) or reverts migration in transaction.
+// It returns false if there was nothing to do.
+func runMigration(db *sqlx.DB, m migration, up bool) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// wait for other instances and check state only after that
+	if _, err = tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return false, err
+	}
+
+	var count int
+	if err = tx.Get(&count, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", m.version); err != nil {
+		return false, err
+	}
+	if (count == 1) == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err = tx.Exec(m.up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", m.version)
+	} else {
+		if _, err = tx.Exec(m.down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.version)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Migrate connects to database and runs command of migration: "up" applies
+// all new migrations, "down" reverts the last one and "status" shows state
+// of migrations. Result is written to w.
+func Migrate(cfg Config, command string, w io.Writer) error {
+	db, err := sqlx.Open("postgres", cfg.DBAddress)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		applied, err := MigrateUp(db)
+		for _, version := range applied {
+			fmt.Fprintf(w, "applied %d\n", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(w, "schema is up to date")
+		}
+	case "down":
+		version, err := MigrateDown(db)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			fmt.Fprintln(w, "nothing to revert")
+		} else {
+			fmt.Fprintf(w, "reverted %d\n", version)
+		}
+	case "status":
+		statuses, err := MigrationsStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Fprintf(w, "%4d  %-40s applied at %s\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Fprintf(w, "%4d  %-40s pending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		return errors.New("Unknown migrate command: " + command)
+	}
+
+	return nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+// migrations contains all changes of database schema ordered by version.
+// Applied migration must never be changed; add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create users and ads",
+		up: `
+CREATE TABLE IF NOT EXISTS users
+(
+    id                SERIAL      PRIMARY KEY,
+    first_name        varchar(80) NOT NULL,
+    last_name         varchar(80) NOT NULL,
+    email             varchar(80) UNIQUE NOT NULL,
+    password_hash     text        NOT NULL,
+    telephone         varchar(80),
+    about             text,
+    avatar_address    text,
+    reg_time          timestamp   DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ads
+(
+    id             SERIAL       PRIMARY KEY,
+    title          varchar(80)  NOT NULL,
+    price          integer      CONSTRAINT positive_price CHECK (price > 0),
+    country        varchar(80),
+    city           varchar(80),
+    subway_station varchar(80),
+    ad_images      varchar(256)[],
+    -- when deleting user we should delete his ads
+    owner_ad       integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
+    description_ad text,
+    creation_time  timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL
+);`,
+		down: `
+DROP TABLE IF EXISTS ads;
+DROP TABLE IF EXISTS users;`,
+	},
+	{
+		version: 2,
+		name:    "full-text search of ads",
+		// configuration "russian" stems russian words and uses english
+		// stemmer for words of latin letters, so both languages are searched
+		up: `
+ALTER TABLE ads ADD COLUMN search_vector tsvector;
+
+CREATE FUNCTION ads_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('russian', coalesce(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('russian', coalesce(NEW.description_ad, '')), 'B') ||
+        setweight(to_tsvector('russian', coalesce(NEW.city, '') || ' ' || coalesce(NEW.subway_station, '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ads_search_vector BEFORE INSERT OR UPDATE ON ads
+    FOR EACH ROW EXECUTE PROCEDURE ads_search_vector();
+
+-- fill vectors of existing ads by trigger
+UPDATE ads SET title = title;
+
+CREATE INDEX ads_search_vector_idx ON ads USING GIN (search_vector);
+
+-- snippets are returned as HTML, so text of ad must be escaped
+CREATE FUNCTION html_escape(text) RETURNS text AS $$
+    SELECT replace(replace(replace($1, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')
+$$ LANGUAGE sql IMMUTABLE;`,
+		down: `
+DROP FUNCTION IF EXISTS html_escape(text);
+DROP INDEX IF EXISTS ads_search_vector_idx;
+DROP TRIGGER IF EXISTS ads_search_vector ON ads;
+DROP FUNCTION IF EXISTS ads_search_vector();
+ALTER TABLE ads DROP COLUMN IF EXISTS search_vector;`,
+	},
+	{
+		version: 3,
+		name:    "indexes of filters of ads",
+		up: `
+CREATE INDEX ads_price_idx ON ads (price);
+CREATE INDEX ads_city_idx ON ads (lower(city));
+CREATE INDEX ads_creation_time_idx ON ads (creation_time);
+CREATE INDEX ads_owner_ad_idx ON ads (owner_ad);`,
+		down: `
+DROP INDEX IF EXISTS ads_owner_ad_idx;
+DROP INDEX IF EXISTS ads_creation_time_idx;
+DROP INDEX IF EXISTS ads_city_idx;
+DROP INDEX IF EXISTS ads_price_idx;`,
+	},
+	{
+		version: 4,
+		name:    "location of ads",
+		up: `
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+ALTER TABLE ads
+    ADD COLUMN latitude  double precision CONSTRAINT valid_latitude CHECK (latitude BETWEEN -90 AND 90),
+    ADD COLUMN longitude double precision CONSTRAINT valid_longitude CHECK (longitude BETWEEN -180 AND 180),
+    ADD CONSTRAINT full_location CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+CREATE INDEX ads_location_idx ON ads USING gist (ll_to_earth(latitude, longitude));`,
+		down: `
+DROP INDEX IF EXISTS ads_location_idx;
+ALTER TABLE ads
+    DROP CONSTRAINT IF EXISTS full_location,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;`,
+	},
+	{
+		version: 5,
+		name:    "categories of ads",
+		up: `
+CREATE TABLE categories (
+    id        SERIAL PRIMARY KEY,
+    parent_id integer REFERENCES categories ON DELETE CASCADE,
+    slug      varchar(64) NOT NULL UNIQUE CONSTRAINT valid_slug CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    name      varchar(128) NOT NULL
+);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+-- ads of removed category stay without category
+ALTER TABLE ads ADD COLUMN category_id integer REFERENCES categories ON DELETE SET NULL;
+
+CREATE INDEX ads_category_id_idx ON ads (category_id);`,
+		down: `
+DROP INDEX IF EXISTS ads_category_id_idx;
+ALTER TABLE ads DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS categories;`,
+	},
+	{
+		version: 6,
+		name:    "saved searches and alerts",
+		up: `
+CREATE TABLE saved_searches (
+    id            SERIAL       PRIMARY KEY,
+    owner_id      integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
+    name          varchar(80)  NOT NULL,
+    params        jsonb        NOT NULL,
+    creation_time timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    -- ads created after this time are new for search
+    checked_time  timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX saved_searches_owner_id_idx ON saved_searches (owner_id);
+
+CREATE TABLE alerts (
+    id            SERIAL       PRIMARY KEY,
+    search_id     integer      REFERENCES saved_searches (id) ON DELETE CASCADE NOT NULL,
+    ad_id         integer      REFERENCES ads (id) ON DELETE CASCADE NOT NULL,
+    creation_time timestamp    DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    -- user is alerted about ad once for every search
+    UNIQUE (search_id, ad_id)
+);
+
+CREATE INDEX alerts_ad_id_idx ON alerts (ad_id);`,
+		down: `
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS saved_searches;`,
+	},
+	{
+		version: 7,
+		name:    "indexes of suggestions",
+		up: `
+-- text_pattern_ops allows to use index for prefix search by LIKE
+-- in any locale of database
+CREATE INDEX ads_title_prefix_idx ON ads (lower(title) text_pattern_ops);
+CREATE INDEX ads_city_prefix_idx ON ads (lower(city) text_pattern_ops);
+CREATE INDEX ads_subway_station_prefix_idx ON ads (lower(subway_station) text_pattern_ops);`,
+		down: `
+DROP INDEX IF EXISTS ads_subway_station_prefix_idx;
+DROP INDEX IF EXISTS ads_city_prefix_idx;
+DROP INDEX IF EXISTS ads_title_prefix_idx;`,
+	},
+	{
+		version: 8,
+		name:    "fuzzy search",
+		up: `
+-- similarity of words by trigrams
+CREATE EXTENSION IF NOT EXISTS pg_trgm;`,
+		down: `
+DROP EXTENSION IF EXISTS pg_trgm;`,
+	},
+	{
+		version: 9,
+		name:    "email verification",
+		up: `
+ALTER TABLE users ADD COLUMN email_verified boolean DEFAULT false NOT NULL;
+
+-- users were activated without verification before
+UPDATE users SET email_verified = true;
+
+CREATE TABLE tokens (
+    token_hash      char(64)     PRIMARY KEY,
+    user_id         integer      REFERENCES users (id) ON DELETE CASCADE NOT NULL,
+    kind            varchar(20)  NOT NULL,
+    -- time with zone is compared with CURRENT_TIMESTAMP in any zone of server
+    expiration_time timestamptz  NOT NULL
+);
+
+CREATE INDEX tokens_user_id_idx ON tokens (user_id);`,
+		down: `
+DROP TABLE IF EXISTS tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;`,
+	},
+	{
+		version: 10,
+		name:    "email change",
+		up: `
+-- email which replaces email of user after confirmation
+ALTER TABLE users ADD COLUMN new_email varchar(80);`,
+		down: `
+ALTER TABLE users DROP COLUMN IF EXISTS new_email;`,
+	},
+	{
+		version: 11,
+		name:    "trigram indexes",
+		up: `
+-- indexes of operator <% used by fuzzy search
+CREATE INDEX ads_title_trgm_idx ON ads USING gin (title gin_trgm_ops);
+CREATE INDEX ads_city_trgm_idx ON ads USING gin (city gin_trgm_ops);
+
+-- words of titles and cities of ads which are used to correct
+-- misspelled queries; count is a number of ads with word
+CREATE TABLE ad_words (
+    word  text     PRIMARY KEY,
+    count integer  NOT NULL
+);
+
+CREATE INDEX ad_words_trgm_idx ON ad_words USING gin (word gin_trgm_ops);
+
+-- words shorter than three letters are skipped: they have
+-- too few trigrams to be compared
+CREATE FUNCTION split_ad_words(title text, city text) RETURNS SETOF text AS $$
+    SELECT DISTINCT word
+    FROM regexp_split_to_table(lower(title || ' ' || coalesce(city, '')), '[[:space:][:punct:]]+') word
+    WHERE length(word) >= 3
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE FUNCTION ads_words() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE ad_words SET count = count - 1
+        WHERE word IN (SELECT split_ad_words(OLD.title, OLD.city));
+        DELETE FROM ad_words
+        WHERE word IN (SELECT split_ad_words(OLD.title, OLD.city)) AND count <= 0;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        INSERT INTO ad_words (word, count)
+        SELECT split_ad_words(NEW.title, NEW.city), 1
+        ON CONFLICT (word) DO UPDATE SET count = ad_words.count + 1;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ads_words AFTER INSERT OR DELETE OR UPDATE OF title, city ON ads
+    FOR EACH ROW EXECUTE PROCEDURE ads_words();
+
+INSERT INTO ad_words (word, count)
+SELECT word, count(*) FROM ads, split_ad_words(ads.title, ads.city) word GROUP BY word;`,
+		down: `
+DROP TRIGGER IF EXISTS ads_words ON ads;
+DROP FUNCTION IF EXISTS ads_words();
+DROP FUNCTION IF EXISTS split_ad_words(text, text);
+DROP TABLE IF EXISTS ad_words;
+DROP INDEX IF EXISTS ads_city_trgm_idx;
+DROP INDEX IF EXISTS ads_title_trgm_idx;`,
+	},
+	{
+		version: 12,
+		name:    "initial categories",
+		// categories can't be created by API, so the initial tree
+		// of categories is created here; parents are found by slug
+		up: `
+INSERT INTO categories (slug, name) VALUES
+    ('repair', 'Ремонт'),
+    ('construction', 'Строительство'),
+    ('finishing', 'Отделка'),
+    ('materials', 'Стройматериалы'),
+    ('equipment-rental', 'Аренда техники')
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO categories (parent_id, slug, name)
+SELECT parent.id, c.slug, c.name FROM (VALUES
+    (1, 'repair', 'apartment-repair', 'Ремонт квартир'),
+    (2, 'repair', 'plumbing', 'Сантехника'),
+    (3, 'repair', 'electrics', 'Электрика'),
+    (4, 'repair', 'heating', 'Отопление'),
+    (5, 'construction', 'houses', 'Строительство домов'),
+    (6, 'construction', 'foundations', 'Фундаменты'),
+    (7, 'construction', 'roofs', 'Кровля'),
+    (8, 'finishing', 'painting', 'Малярные работы'),
+    (9, 'finishing', 'tiling', 'Плиточные работы'),
+    (10, 'finishing', 'floors', 'Полы')
+) c (pos, parent, slug, name)
+INNER JOIN categories parent ON parent.slug = c.parent
+ORDER BY c.pos
+ON CONFLICT (slug) DO NOTHING;`,
+		// subcategories are removed by cascade
+		down: `
+DELETE FROM categories
+WHERE slug IN ('repair', 'construction', 'finishing', 'materials', 'equipment-rental');`,
+	},
+}
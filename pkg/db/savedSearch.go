@@ -0,0 +1,113 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// NewSavedSearch creates a new row in "saved_searches" table in database
+// if user has less than limit searches. Parameters of search are stored in JSON.
+// Row of user is locked so concurrent calls can't exceed the limit.
+func (h *Handler) NewSavedSearch(ctx context.Context, search *model.SavedSearch, limit int) (int64, error) {
+	var lastInserted int64
+	params, err := json.Marshal(search.Params)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+	search.ParamsStr = string(params)
+
+	err = h.WithTx(ctx, func(tx model.DB) error {
+		txHandler := tx.(*Handler)
+		if _, err := txHandler.LockUser.ExecContext(ctx, search.UserID); err != nil {
+			return err
+		}
+
+		err := txHandler.CreateSavedSearch.GetContext(ctx, &lastInserted, struct {
+			*model.SavedSearch
+			Limit int `db:"limit"`
+		}{search, limit})
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	})
+
+	return lastInserted, err
+}
+
+// GetSavedSearches returns saved searches of user with such ID.
+func (h *Handler) GetSavedSearches(ctx context.Context, userID int64) ([]*model.SavedSearch, error) {
+	searches := make([]*model.SavedSearch, 0)
+	if err := h.ReadSavedSearches.SelectContext(ctx, &searches, userID); err != nil {
+		return searches, err
+	}
+	return searches, decodeParams(searches)
+}
+
+// GetAllSavedSearches returns saved searches of all users.
+func (h *Handler) GetAllSavedSearches(ctx context.Context) ([]*model.SavedSearch, error) {
+	searches := make([]*model.SavedSearch, 0)
+	if err := h.ReadAllSavedSearches.SelectContext(ctx, &searches); err != nil {
+		return searches, err
+	}
+	return searches, decodeParams(searches)
+}
+
+// RemoveSavedSearch deletes saved search with such ID if it's saved by such user.
+func (h *Handler) RemoveSavedSearch(ctx context.Context, userID, searchID int64) (int64, error) {
+	res, err := h.DeleteSavedSearch.ExecContext(ctx, userID, searchID)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
+
+// AddAlerts creates alerts of saved search about ads and sets checked
+// time of search. Ads which are already deleted are skipped. It returns
+// IDs of ads which had no alerts of this search before.
+func (h *Handler) AddAlerts(ctx context.Context, searchID int64, adIDs []int64, checked time.Time) ([]int64, error) {
+	ids := make([]string, len(adIDs))
+	for i, id := range adIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	added := make([]int64, 0)
+	err := h.CreateAlerts.SelectContext(ctx, &added, searchID, strings.Join(ids, ","), checked)
+	return added, err
+}
+
+// GetAlerts returns alerts of user from the newest one.
+func (h *Handler) GetAlerts(ctx context.Context, userID int64, limit, offset int) ([]*model.Alert, error) {
+	alerts := make([]*model.Alert, 0)
+	err := h.ReadAlerts.SelectContext(ctx, &alerts, userID, limit, offset)
+	return alerts, err
+}
+
+// decodeParams decodes parameters of saved searches from JSON.
+func decodeParams(searches []*model.SavedSearch) error {
+	for _, search := range searches {
+		if err := json.Unmarshal([]byte(search.ParamsStr), &search.Params); err != nil {
+			log.Println(err.Error())
+			return err
+		}
+	}
+	return nil
+}
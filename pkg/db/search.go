@@ -0,0 +1,261 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// parts of query which returns list of ads. Query is built only from
+// this constant parts; values of search parameters are always passed
+// as named parameters of query.
+const (
+	adsColumns = `ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad, latitude, longitude, category_id,
+		users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address, email_verified`
+
+	snippetColumns = `,
+		ts_headline('russian', html_escape(title), q, 'StartSel=<b>, StopSel=</b>, HighlightAll=true') "title_snippet",
+		ts_headline('russian', html_escape(coalesce(description_ad, '')), q, 'StartSel=<b>, StopSel=</b>, MaxFragments=2, FragmentDelimiter=" ... "') "description_snippet"`
+
+	adsTables = `ads
+		INNER JOIN
+		users
+		ON
+		users.id = ads.owner_ad`
+
+	// configuration "russian" stems russian words and uses english
+	// stemmer for words of latin letters
+	queryTable = `,
+		plainto_tsquery('russian', :query) q`
+
+	// similarity of query with title or city of ad used to rank ads found by fuzzy search
+	fuzzyRank = `greatest(word_similarity(:query, ads.title), word_similarity(:query, coalesce(ads.city, '')))`
+
+	// title or city of ad has words similar to query; operator <% uses
+	// trigram indexes and threshold set by trgmQueryer
+	fuzzyCondition = `(:query <% ads.title OR :query <% ads.city)`
+
+	// category with such slug and all its subcategories
+	categoryCondition = `ads.category_id IN (
+		WITH RECURSIVE subcategories AS (
+			SELECT id FROM categories WHERE slug = :category
+			UNION ALL
+			SELECT categories.id FROM categories
+			INNER JOIN subcategories ON categories.parent_id = subcategories.id
+		)
+		SELECT id FROM subcategories)`
+
+	// distance in kilometres from point of search to location of ad
+	distanceColumn = `,
+		earth_distance(ll_to_earth(:latitude, :longitude), ll_to_earth(ads.latitude, ads.longitude)) / 1000 "distance"`
+
+	// earth_box selects ads by index of location, but it's a bit bigger
+	// than circle of radius, so distance is checked too
+	radiusCondition = `earth_box(ll_to_earth(:latitude, :longitude), CAST(:radius_km AS double precision) * 1000) @> ll_to_earth(ads.latitude, ads.longitude)
+		AND earth_distance(ll_to_earth(:latitude, :longitude), ll_to_earth(ads.latitude, ads.longitude)) <= CAST(:radius_km AS double precision) * 1000`
+)
+
+// searchQuery returns query with named parameters which selects ads
+// matching search parameters. Ads found by text query are ordered by rank;
+// snippets aren't selected by fuzzy search. Ads before cursor are selected in reverse order if sp.Backward is set.
+func searchQuery(sp *model.SearchParams) string {
+	columns, tables := adsColumns, adsTables
+	if sp.Query != "" && !sp.Fuzzy {
+		columns += snippetColumns
+		tables += queryTable
+	}
+	if sp.IsGeo() {
+		columns += distanceColumn
+	}
+	conditions := append(filters(sp), cursorCondition(sp)...)
+
+	order := orderBy(sp.Sort, rank(sp))
+	if sp.CursorID > 0 && sp.Backward {
+		order = reverseOrder(sp.Sort)
+	}
+	return "SELECT " + columns + " FROM " + tables + where(conditions) +
+		" ORDER BY " + order + " LIMIT :limit OFFSET :offset"
+}
+
+// countQuery returns query with named parameters which counts ads
+// matching search parameters regardless of pagination.
+func countQuery(sp *model.SearchParams) string {
+	return "SELECT count(*) FROM " + countTables(sp) + where(filters(sp))
+}
+
+// countTables returns tables of queries which count ads
+// matching search parameters; ads aren't joined with users.
+func countTables(sp *model.SearchParams) string {
+	if sp.Query != "" && !sp.Fuzzy {
+		return "ads" + queryTable
+	}
+	return "ads"
+}
+
+// where returns WHERE clause of conditions joined by AND.
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// cursorCondition returns condition which selects ads after cursor of
+// keyset pagination (or before it if sp.Backward is set) in order by
+// time of creation. It returns nothing if cursor isn't set.
+func cursorCondition(sp *model.SearchParams) []string {
+	if sp.CursorID <= 0 {
+		return nil
+	}
+	op := ">"
+	if (sp.Sort == model.SortNewest) != sp.Backward {
+		op = "<"
+	}
+	return []string{"(ads.creation_time, ads.id) " + op +
+		" (CAST(:cursor_time AS timestamp), :cursor_id)"}
+}
+
+// reverseOrder returns expression of ORDER BY which is reverse
+// to order by time of creation. It's used to select ads before cursor.
+func reverseOrder(sort string) string {
+	if sort == model.SortNewest {
+		return "ads.creation_time, ads.id"
+	}
+	return "ads.creation_time DESC, ads.id DESC"
+}
+
+// adsOfUserQuery returns query which selects ads of user passed as $1.
+func adsOfUserQuery(sort string) string {
+	return "SELECT " + adsColumns + " FROM " + adsTables +
+		" AND ads.owner_ad = $1 ORDER BY " + orderBy(sort, "")
+}
+
+// rank returns expression of relevance of ads found by query
+// or nothing if ads aren't searched by query.
+func rank(sp *model.SearchParams) string {
+	switch {
+	case sp.IsFuzzy():
+		return fuzzyRank
+	case sp.Query != "":
+		return "ts_rank(ads.search_vector, q)"
+	}
+	return ""
+}
+
+// orderBy returns expression of ORDER BY for sort order. Relevance
+// (rank) is used if ads are searched by query and order isn't chosen.
+// Order by distance can be used only by search in radius.
+func orderBy(sort, rank string) string {
+	switch {
+	case sort == model.SortNewest:
+		return "ads.creation_time DESC, ads.id DESC"
+	case sort == model.SortPriceAsc:
+		return "ads.price ASC NULLS LAST, ads.id"
+	case sort == model.SortPriceDesc:
+		return "ads.price DESC NULLS LAST, ads.id"
+	case sort == model.SortDistance:
+		return "distance, ads.id"
+	case rank != "" && (sort == model.SortRelevance || sort == ""):
+		return rank + " DESC, ads.id"
+	}
+	return "ads.creation_time, ads.id"
+}
+
+// filters returns conditions for search query and filters which are set in sp.
+func filters(sp *model.SearchParams) []string {
+	conditions := make([]string, 0)
+	if sp.IsFuzzy() {
+		conditions = append(conditions, fuzzyCondition)
+	} else if sp.Query != "" {
+		conditions = append(conditions, "ads.search_vector @@ q")
+	}
+	if sp.MinPrice > 0 {
+		conditions = append(conditions, "ads.price >= :min_price")
+	}
+	if sp.MaxPrice > 0 {
+		conditions = append(conditions, "ads.price <= :max_price")
+	}
+	if sp.Country != "" {
+		conditions = append(conditions, "lower(ads.country) = lower(:country)")
+	}
+	if sp.City != "" {
+		conditions = append(conditions, "lower(ads.city) = lower(:city)")
+	}
+	if sp.SubwayStation != "" {
+		conditions = append(conditions, "lower(ads.subway_station) = lower(:subway_station)")
+	}
+	if sp.OwnerID > 0 {
+		conditions = append(conditions, "ads.owner_ad = :owner_id")
+	}
+	if !sp.CreatedAfter.IsZero() {
+		conditions = append(conditions, "ads.creation_time >= :created_after")
+	}
+	if !sp.CreatedBefore.IsZero() {
+		conditions = append(conditions, "ads.creation_time < :created_before")
+	}
+	if sp.Category != "" {
+		conditions = append(conditions, categoryCondition)
+	}
+	if sp.IsGeo() {
+		conditions = append(conditions, radiusCondition)
+	}
+	if sp.HasImages != nil {
+		if *sp.HasImages {
+			conditions = append(conditions, "cardinality(ads.ad_images) > 0")
+		} else {
+			conditions = append(conditions, "coalesce(cardinality(ads.ad_images), 0) = 0")
+		}
+	}
+	return conditions
+}
+
+// queryer returns transaction of handler if it's passed
+// to function of WithTx and connection to database otherwise.
+func (h *Handler) queryer() sqlx.QueryerContext {
+	if h.tx != nil {
+		return h.tx
+	}
+	return h.DB
+}
+
+// thresholdQuery sets minimal trigram similarity of operators
+// % and <% until the end of transaction.
+const thresholdQuery = `SELECT set_config('pg_trgm.similarity_threshold', $1, true),
+	set_config('pg_trgm.word_similarity_threshold', $1, true)`
+
+// trgmQueryer calls fn with queryer whose operators of trigram similarity use
+// model.FuzzyThreshold if trgm is set and with queryer of h otherwise. Threshold
+// is set only in transaction, so read-only transaction is started if handler
+// isn't passed to function of WithTx.
+func (h *Handler) trgmQueryer(ctx context.Context, trgm bool, fn func(q sqlx.QueryerContext) error) error {
+	if !trgm {
+		return fn(h.queryer())
+	}
+
+	tx := h.tx
+	if tx == nil {
+		var err error
+		if tx, err = h.DB.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+			log.Println(err.Error())
+			return err
+		}
+		// transaction only reads, so it's never committed
+		defer tx.Rollback()
+	}
+
+	threshold := strconv.FormatFloat(model.FuzzyThreshold, 'f', -1, 64)
+	if _, err := tx.ExecContext(ctx, thresholdQuery, threshold); err != nil {
+		return err
+	}
+	return fn(tx)
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"log"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// statement is a prepared statement of Handler with its SQL query.
+// Only one of stmt and named is set.
+type statement struct {
+	stmt  **sqlx.Stmt
+	named **sqlx.NamedStmt
+	query string
+}
+
+// statements returns all prepared statements of h. It's the only list
+// of statements which is used by prepareStatements and WithTx, so new
+// statement is added only here.
+func (h *Handler) statements() []statement {
+	return []statement{
+		{ // return ad with such id
+			stmt: &h.ReadAd,
+			query: `SELECT
+			ads.id "idad", title, description_ad, price, country, city, subway_station, array_to_string(ad_images,',') "ad_images", creation_time, owner_ad, latitude, longitude, category_id,
+			users.id, first_name, last_name, email, telephone, about, reg_time, avatar_address, email_verified
+			FROM
+			ads
+			INNER JOIN
+			users
+			ON
+			users.id = ads.owner_ad AND ads.id = $1`,
+		},
+		{ // return user with such id
+			stmt:  &h.ReadUserWithID,
+			query: "SELECT id, first_name, last_name, email, telephone, about, reg_time, avatar_address, email_verified FROM users WHERE id=$1",
+		},
+		{ // return user with such email
+			stmt:  &h.ReadUserWithEmail,
+			query: "SELECT id, first_name, last_name, email, telephone, about, reg_time, password_hash, avatar_address, email_verified FROM users WHERE email=$1",
+		},
+		{ // create new user
+			named: &h.CreateUser,
+			query: `INSERT INTO users
+				(first_name, last_name, email, password_hash, telephone, about, avatar_address, email_verified)
+				VALUES
+				(:first_name, :last_name, :email, :password_hash, :telephone, :about, :avatar_address, :email_verified)
+				RETURNING id`,
+		},
+		{ // create new ad
+			named: &h.CreateAd,
+			query: `INSERT INTO ads
+				(title, owner_ad, description_ad, price, country, city, subway_station, ad_images, latitude, longitude, category_id)
+				VALUES
+				(:title, :owner_ad, :description_ad, :price, :country, :city, :subway_station, string_to_array(:ad_images, ','), :latitude, :longitude, :category_id)
+				RETURNING id`,
+		},
+		{ // update user
+			named: &h.UpdateUser,
+			query: `UPDATE users SET
+				first_name=:first_name,
+				last_name=:last_name,
+				telephone=:telephone,
+				about=:about,
+				avatar_address=:avatar_address
+				WHERE id=:id`,
+		},
+		{ // update ad
+			named: &h.UpdateAd,
+			query: `UPDATE ads SET
+				title=:title,
+				description_ad=:description_ad,
+				price=:price,
+				country=:country,
+				city=:city,
+				subway_station=:subway_station,
+				ad_images=string_to_array(:ad_images, ','),
+				latitude=:latitude,
+				longitude=:longitude,
+				category_id=:category_id
+				WHERE id=:idad`,
+		},
+		{ // delete user
+			stmt:  &h.DeleteUser,
+			query: `DELETE FROM users WHERE id=$1`,
+		},
+		{ // delete ad
+			stmt:  &h.DeleteAd,
+			query: `DELETE FROM ads WHERE id=$1`,
+		},
+		{ // return all categories
+			stmt:  &h.ReadCategories,
+			query: "SELECT id, parent_id, slug, name FROM categories ORDER BY id",
+		},
+		{ // lock user until the end of transaction
+			stmt:  &h.LockUser,
+			query: `SELECT id FROM users WHERE id=$1 FOR UPDATE`,
+		},
+		{ // create new saved search if user has less than limit searches
+			named: &h.CreateSavedSearch,
+			query: `INSERT INTO saved_searches
+				(owner_id, name, params)
+				SELECT :owner_id, :name, :params
+				WHERE (SELECT count(*) FROM saved_searches WHERE owner_id=:owner_id) < :limit
+				RETURNING id`,
+		},
+		{ // return saved searches of user
+			stmt: &h.ReadSavedSearches,
+			query: `SELECT id, owner_id, name, params, creation_time, checked_time
+			FROM saved_searches WHERE owner_id=$1 ORDER BY id`,
+		},
+		{ // return all saved searches
+			stmt: &h.ReadAllSavedSearches,
+			query: `SELECT id, owner_id, name, params, creation_time, checked_time
+			FROM saved_searches ORDER BY id`,
+		},
+		{ // delete saved search of user
+			stmt:  &h.DeleteSavedSearch,
+			query: `DELETE FROM saved_searches WHERE owner_id=$1 AND id=$2`,
+		},
+		{ // create alerts and set checked time of search
+			stmt: &h.CreateAlerts,
+			query: `WITH checked AS (
+				UPDATE saved_searches SET checked_time=$3 WHERE id=$1
+			)
+			INSERT INTO alerts
+				(search_id, ad_id)
+				SELECT $1, id FROM ads WHERE id = ANY(CAST(string_to_array($2, ',') AS integer[]))
+				ON CONFLICT DO NOTHING
+				RETURNING ad_id`,
+		},
+		{ // return alerts of user
+			stmt: &h.ReadAlerts,
+			query: `SELECT
+			alerts.id, search_id, saved_searches.name "search_name", ad_id, ads.title "ad_title", alerts.creation_time
+			FROM
+			alerts
+			INNER JOIN
+			saved_searches
+			ON
+			saved_searches.id = alerts.search_id AND saved_searches.owner_id = $1
+			INNER JOIN
+			ads
+			ON
+			ads.id = alerts.ad_id
+			ORDER BY alerts.id DESC LIMIT $2 OFFSET $3`,
+		},
+		{ // mark email of user as verified
+			stmt:  &h.UpdateEmailVerified,
+			query: `UPDATE users SET email_verified=true WHERE id=$1`,
+		},
+		{ // replace hash of password of user
+			stmt:  &h.UpdatePassword,
+			query: `UPDATE users SET password_hash=$2 WHERE id=$1`,
+		},
+		{ // store email which isn't confirmed yet
+			stmt:  &h.UpdateNewEmail,
+			query: `UPDATE users SET new_email=$2 WHERE id=$1`,
+		},
+		{ // replace email by confirmed one
+			stmt: &h.UpdateEmail,
+			query: `UPDATE users SET email=new_email, new_email=NULL, email_verified=true
+			WHERE id=$1 AND new_email IS NOT NULL`,
+		},
+		{ // replace token of user and remove expired tokens
+			named: &h.CreateToken,
+			query: `WITH removed AS (
+				DELETE FROM tokens
+				WHERE (user_id=:user_id AND kind=:kind) OR expiration_time <= CURRENT_TIMESTAMP
+			)
+			INSERT INTO tokens
+				(token_hash, user_id, kind, expiration_time)
+				VALUES
+				(:token_hash, :user_id, :kind, :expiration_time)`,
+		},
+		{ // use token which isn't expired
+			stmt: &h.DeleteToken,
+			query: `DELETE FROM tokens
+			WHERE token_hash=$1 AND kind=$2 AND expiration_time > CURRENT_TIMESTAMP
+			RETURNING user_id`,
+		},
+		{ // add token of user and remove expired tokens
+			named: &h.InsertToken,
+			query: `WITH removed AS (
+				DELETE FROM tokens
+				WHERE expiration_time <= CURRENT_TIMESTAMP
+			)
+			INSERT INTO tokens
+				(token_hash, user_id, kind, expiration_time)
+				VALUES
+				(:token_hash, :user_id, :kind, :expiration_time)`,
+		},
+		{ // remove tokens of such kind of user
+			stmt:  &h.DeleteUserTokens,
+			query: `DELETE FROM tokens WHERE user_id=$1 AND kind=$2`,
+		},
+		{ // return all referenced images
+			stmt: &h.ReadImages,
+			query: `SELECT unnest(ad_images) FROM ads
+			UNION
+			SELECT avatar_address FROM users WHERE avatar_address IS NOT NULL`,
+		},
+	}
+}
+
+// prepareStatements prepares SQL statements for interaction with postgres database.
+func (h *Handler) prepareStatements() (err error) {
+	for _, s := range h.statements() {
+		if s.named != nil {
+			*s.named, err = h.DB.PrepareNamed(s.query)
+		} else {
+			*s.stmt, err = h.DB.Preparex(s.query)
+		}
+		if err != nil {
+			log.Println(err.Error())
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// suggestQuery groups titles, cities and subway stations of ads starting
+// with prefix $1 and returns the most popular of them. Text of group is
+// chosen in "C" collation to be the same in any locale of database.
+// Query isn't prepared: postgres uses prefix indexes only if pattern
+// of LIKE is known by planner.
+const suggestQuery = `SELECT text, kind, count FROM (
+		SELECT min(title COLLATE "C") "text", 'title' "kind", count(*) "count"
+		FROM ads WHERE lower(title) LIKE $1 GROUP BY lower(title)
+		UNION ALL
+		SELECT min(city COLLATE "C"), 'city', count(*)
+		FROM ads WHERE lower(city) LIKE $1 GROUP BY lower(city)
+		UNION ALL
+		SELECT min(subway_station COLLATE "C"), 'subway_station', count(*)
+		FROM ads WHERE lower(subway_station) LIKE $1 GROUP BY lower(subway_station)
+	) suggestions
+	ORDER BY count DESC, text, kind LIMIT $2`
+
+// likeEscaper escapes wildcards of LIKE
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetSuggestions returns the most popular titles, cities and
+// subway stations of ads which start with prefix ignoring case.
+func (h *Handler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]*model.Suggestion, error) {
+	suggestions := make([]*model.Suggestion, 0)
+	pattern := likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+	err := sqlx.SelectContext(ctx, h.queryer(), &suggestions, suggestQuery, pattern, limit)
+	return suggestions, err
+}
+
+// similarWordsQuery returns words of titles and cities of ads which are
+// the most similar to $1 by trigrams. Table "ad_words" is filled by trigger
+// of ads and operator % uses its trigram index.
+const similarWordsQuery = `SELECT word FROM ad_words
+	WHERE $1 % word
+	ORDER BY similarity($1, word) DESC, word COLLATE "C" LIMIT $2`
+
+// GetSimilarWords returns words of titles and cities of ads
+// which are the most similar to word.
+func (h *Handler) GetSimilarWords(ctx context.Context, word string, limit int) ([]string, error) {
+	words := make([]string, 0)
+	err := h.trgmQueryer(ctx, true, func(q sqlx.QueryerContext) error {
+		return sqlx.SelectContext(ctx, q, &words, similarWordsQuery, strings.ToLower(word), limit)
+	})
+	return words, err
+}
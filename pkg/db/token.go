@@ -0,0 +1,67 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// VerifyEmail marks email of user with such ID as verified.
+func (h *Handler) VerifyEmail(ctx context.Context, userID int64) (int64, error) {
+	res, err := h.UpdateEmailVerified.ExecContext(ctx, userID)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
+
+// NewToken stores token. Other tokens of the same kind
+// of user and all expired tokens are removed.
+func (h *Handler) NewToken(ctx context.Context, token *model.Token) error {
+	_, err := h.CreateToken.ExecContext(ctx, token)
+	return err
+}
+
+// UseToken removes token of such kind with such hash
+// and returns ID of its user if token isn't expired.
+func (h *Handler) UseToken(ctx context.Context, hash, kind string) (int64, error) {
+	var userID int64
+	err := h.DeleteToken.GetContext(ctx, &userID, hash, kind)
+	if err == sql.ErrNoRows {
+		userID = -1
+	}
+	return userID, err
+}
+
+// AddToken stores token. Other tokens of user are kept,
+// only expired tokens are removed.
+func (h *Handler) AddToken(ctx context.Context, token *model.Token) error {
+	_, err := h.InsertToken.ExecContext(ctx, token)
+	return err
+}
+
+// RemoveTokens removes all tokens of such kind of user with such ID.
+func (h *Handler) RemoveTokens(ctx context.Context, userID int64, kind string) (int64, error) {
+	res, err := h.DeleteUserTokens.ExecContext(ctx, userID, kind)
+	if err != nil {
+		return -1, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return -1, err
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"log"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// WithTx runs fn in transaction. Handler passed to fn uses prepared
+// statements of h bound to this transaction. Transaction is committed
+// if fn returns nil and rolled back otherwise. Nested call of WithTx
+// runs fn in the same transaction.
+func (h *Handler) WithTx(ctx context.Context, fn func(tx model.DB) error) error {
+	if h.tx != nil {
+		return fn(h)
+	}
+
+	tx, err := h.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	txHandler := &Handler{
+		DB: h.DB,
+		tx: tx,
+	}
+	txStatements := txHandler.statements()
+	for i, s := range h.statements() {
+		if s.named != nil {
+			*txStatements[i].named = tx.NamedStmtContext(ctx, *s.named)
+		} else {
+			*txStatements[i].stmt = tx.StmtxContext(ctx, *s.stmt)
+		}
+	}
+
+	if err = fn(txHandler); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			log.Println(errRollback.Error())
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
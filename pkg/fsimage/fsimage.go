@@ -0,0 +1,298 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+/*
+Package fsimage is used to implement model.IM interface. Its purpose
+is controlling images of users and ads.
+
+fsimage stores images in a directory of local filesystem. It doesn't need
+any credentials, so it can be used for development, testing and CI.
+Copying of image is stopped when context is done.
+
+Like presigned URL of S3, URL returned by PresignUpload contains time of
+expiration and HMAC signature of key. Uploads to such URLs are served by
+handler returned by UploadHandler, it must be available at URL prefix/storage/.
+*/
+package fsimage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// Config is config for local filesystem image manager.
+// Directory is a path to directory where images will be stored.
+// URL is a prefix that will be added to location of uploaded image
+// (i.e. http://127.0.0.1:8080). Location is relative if URL is empty.
+// Secret is a key for signing of upload URLs; random key is used if
+// it's empty, so URLs become invalid after restart.
+type Config struct {
+	Directory string `json:"Directory"`
+	URL       string `json:"URL"`
+	Secret    string `json:"Secret"`
+}
+
+// maxUploadSize is maximum size of file uploaded by presigned URL
+const maxUploadSize = 32 << 20
+
+// FS is a struct that implements model.IM interface
+type FS struct {
+	dir    string
+	url    string
+	secret []byte
+}
+
+// InitFS creates directory for images if needed and checks that
+// it's accessible.
+func InitFS(cfg Config) (*FS, error) {
+	if cfg.Directory == "" {
+		return nil, errors.New("No directory for images specified")
+	}
+
+	if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(cfg.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("Path for images is not a directory")
+	}
+
+	r := &FS{
+		dir:    cfg.Directory,
+		url:    strings.TrimSuffix(cfg.URL, "/"),
+		secret: []byte(cfg.Secret),
+	}
+	if cfg.Secret == "" {
+		r.secret = make([]byte, 32)
+		if _, err = rand.Read(r.secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// clean returns rooted key without URL prefix. Key can be
+// location returned by UploadImage. Cleaning of rooted key
+// prevents leaving the directory of images.
+func (f *FS) clean(key string) string {
+	if f.url != "" {
+		key = strings.TrimPrefix(key, f.url)
+	}
+	return path.Clean("/" + key)
+}
+
+// path returns path to file in the directory of images.
+func (f *FS) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(f.clean(key)))
+}
+
+// IsExist checks if such key exists in the directory
+func (f *FS) IsExist(ctx context.Context, key string) bool {
+	info, err := os.Stat(f.path(key))
+	if err != nil {
+		return false
+	}
+	return info.Mode().IsRegular()
+}
+
+// UploadImage saves body as key and returns location of image
+func (f *FS) UploadImage(ctx context.Context, key string, body io.Reader) (string, error) {
+	dst := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	// write to temporary file to prevent reading of partial image
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".upload")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, ctxReader{ctx, body})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+
+	return f.url + f.clean(key), nil
+}
+
+// DeleteImage deletes such key from the directory. Like S3 it
+// doesn't return error if there is no such key.
+func (f *FS) DeleteImage(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ListImages returns all images from the directory /images/
+// except temporary files of unfinished uploads.
+func (f *FS) ListImages(ctx context.Context) ([]*model.ImageInfo, error) {
+	images := make([]*model.ImageInfo, 0)
+	root := f.path("/images")
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return nil
+			}
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".upload") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		images = append(images, &model.ImageInfo{
+			Key:          "/" + filepath.ToSlash(rel),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ReadImage opens image for reading from offset. Content type
+// is detected by extension of file.
+func (f *FS) ReadImage(ctx context.Context, key string, offset int64) (*model.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, model.ErrNoImage
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = model.ErrNoImage
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &model.Image{
+		Body:        file,
+		Size:        info.Size(),
+		ContentType: contentType,
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+// PresignUpload returns signed URL for uploading of such key.
+func (f *FS) PresignUpload(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key = f.clean(key)
+	expiresStr := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expiresStr)
+	query.Set("signature", f.sign(key, expiresStr))
+
+	return f.url + "/storage" + key + "?" + query.Encode(), nil
+}
+
+// sign returns HMAC signature of key and time of expiration.
+func (f *FS) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UploadHandler returns handler of uploads by URLs from PresignUpload.
+// Handler must be registered with path prefix /storage/.
+func (f *FS) UploadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := f.clean(strings.TrimPrefix(r.URL.Path, "/storage"))
+		expiresStr := r.URL.Query().Get("expires")
+		signature := r.URL.Query().Get("signature")
+		expires, err := strconv.ParseInt(expiresStr, 10, 64)
+		if err != nil || time.Now().Unix() > expires ||
+			!hmac.Equal([]byte(signature), []byte(f.sign(key, expiresStr))) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if _, err = f.UploadImage(r.Context(), key, body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// ctxReader is a reader that stops reading when context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements io.Reader interface
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
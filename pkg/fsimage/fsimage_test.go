@@ -0,0 +1,222 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package fsimage_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/fsimage"
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+func TestInitFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsimage")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = fsimage.InitFS(fsimage.Config{})
+	if err == nil {
+		t.Error("FS can't be initiated without directory")
+	}
+
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, []byte("data"), 0644)
+	_, err = fsimage.InitFS(fsimage.Config{Directory: file})
+	if err == nil {
+		t.Error("FS can't be initiated with file as directory")
+	}
+
+	_, err = fsimage.InitFS(fsimage.Config{Directory: filepath.Join(dir, "images")})
+	if err != nil {
+		t.Error("FS must have been initiated", err)
+	}
+}
+
+func TestInterfaceFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsimage")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	im, err := fsimage.InitFS(fsimage.Config{
+		Directory: dir,
+		URL:       "http://127.0.0.1:8080/",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	if im.IsExist(ctx, "/images/a.png") {
+		t.Error("Key mustn't exist")
+	}
+
+	loc, err := im.UploadImage(ctx, "/images/a.png", strings.NewReader("image"))
+	if err != nil {
+		t.Error("Unexpected error", err)
+	} else if loc != "http://127.0.0.1:8080/images/a.png" {
+		t.Error("Unexpected location", loc)
+	}
+
+	if !im.IsExist(ctx, "/images/a.png") || !im.IsExist(ctx, loc) {
+		t.Error("Key must exist")
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "images", "a.png"))
+	if string(data) != "image" {
+		t.Error("Unexpected content", string(data))
+	}
+
+	// key mustn't leave directory
+	loc, err = im.UploadImage(ctx, "/../../b.png", strings.NewReader("image"))
+	if err != nil {
+		t.Error("Unexpected error", err)
+	} else if loc != "http://127.0.0.1:8080/b.png" {
+		t.Error("Unexpected location", loc)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "b.png")); err != nil {
+		t.Error("File must be inside directory")
+	}
+
+	if err = im.DeleteImage(ctx, loc); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	if im.IsExist(ctx, loc) {
+		t.Error("Key mustn't exist")
+	}
+
+	if err = im.DeleteImage(ctx, "/images/nothing.png"); err != nil {
+		t.Error("Unexpected error", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = im.UploadImage(canceled, "/images/d.png", strings.NewReader("image")); err == nil {
+		t.Error("Expected error")
+	}
+	if im.IsExist(ctx, "/images/d.png") {
+		t.Error("Key mustn't exist")
+	}
+
+	im.UploadImage(ctx, "/images/c.png", strings.NewReader("image"))
+
+	img, err := im.ReadImage(ctx, "/images/c.png", 2)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	data, _ = ioutil.ReadAll(img.Body)
+	img.Body.Close()
+	if string(data) != "age" {
+		t.Error("Unexpected content", string(data))
+	}
+	if img.Size != 5 || img.ContentType != "image/png" || img.ModTime.IsZero() {
+		t.Error("Unexpected info of image", img.Size, img.ContentType, img.ModTime)
+	}
+	if _, err = im.ReadImage(ctx, "/images/nothing.png", 0); err != model.ErrNoImage {
+		t.Error("Expected error of absent image", err)
+	}
+}
+
+func TestListImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsimage")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	im, err := fsimage.InitFS(fsimage.Config{Directory: dir})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	images, err := im.ListImages(ctx)
+	if err != nil || len(images) != 0 {
+		t.Error("Expected no images", err)
+	}
+
+	im.UploadImage(ctx, "/images/a.png", strings.NewReader("a"))
+	im.UploadImage(ctx, "/images/b.png", strings.NewReader("b"))
+	im.UploadImage(ctx, "/other/c.png", strings.NewReader("c"))
+	ioutil.WriteFile(filepath.Join(dir, "images", ".upload123"), []byte("d"), 0644)
+
+	images, err = im.ListImages(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if len(images) != 2 || images[0].Key != "/images/a.png" || images[1].Key != "/images/b.png" {
+		t.Error("Expected /images/a.png and /images/b.png")
+	}
+	for _, image := range images {
+		if image.LastModified.IsZero() {
+			t.Error("Expected time of modification")
+		}
+	}
+}
+
+func TestPresignUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsimage")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	im, err := fsimage.InitFS(fsimage.Config{
+		Directory: dir,
+		Secret:    "secret",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	srv := httptest.NewServer(im.UploadHandler())
+	defer srv.Close()
+
+	put := func(url, body string) int {
+		r, _ := http.NewRequest("PUT", url, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal("Unexpected error", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	url, err := im.PresignUpload(ctx, "/images/uploads/a", time.Minute)
+	if err != nil || !strings.HasPrefix(url, "/storage/images/uploads/a?") {
+		t.Fatal("Unexpected URL", url, err)
+	}
+	if code := put(srv.URL+url, "image"); code != http.StatusOK {
+		t.Error("Expected status 200 got", code)
+	}
+	if !im.IsExist(ctx, "/images/uploads/a") {
+		t.Error("Image must be uploaded")
+	}
+
+	// signature is checked for key
+	if code := put(srv.URL+strings.Replace(url, "/a?", "/b?", 1), "image"); code != http.StatusForbidden {
+		t.Error("Expected status 403 got", code)
+	}
+
+	// URL is expired
+	url, _ = im.PresignUpload(ctx, "/images/uploads/c", -time.Minute)
+	if code := put(srv.URL+url, "image"); code != http.StatusForbidden {
+		t.Error("Expected status 403 got", code)
+	}
+	if im.IsExist(ctx, "/images/uploads/c") {
+		t.Error("Image mustn't be uploaded")
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+/*
+Package imagegc removes images which are not referenced by any ad or user.
+
+Such images are left by failed requests and by removing of users and ads.
+Collector lists images stored by IM and compares them with images of ads and
+avatars of users from DB. Image is orphaned if it isn't referenced and it's
+older than grace period: younger images can belong to requests which are not
+finished yet. Collector can run periodically in background or sweep once.
+In dry-run mode orphaned images are only reported.
+*/
+package imagegc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// Config is config of garbage collector. Interval is a period of sweeping
+// in background, empty string disables it. GracePeriod is a minimal age of
+// image that can be removed. DryRun disables removing of images.
+type Config struct {
+	Interval    string `json:"Interval"`
+	GracePeriod string `json:"GracePeriod"`
+	DryRun      bool   `json:"DryRun"`
+}
+
+// Collector removes orphaned images.
+type Collector struct {
+	db model.DB
+	im model.IM
+
+	interval time.Duration
+	grace    time.Duration
+	dryRun   bool
+}
+
+// Report is a result of one sweep.
+type Report struct {
+	DryRun   bool
+	Checked  int
+	Orphaned []string
+	Deleted  []string
+	Failed   []string
+}
+
+// New creates collector with provided config.
+func New(cfg Config, db model.DB, im model.IM) (*Collector, error) {
+	c := &Collector{
+		db:     db,
+		im:     im,
+		dryRun: cfg.DryRun,
+	}
+
+	var err error
+	if cfg.Interval != "" {
+		if c.interval, err = time.ParseDuration(cfg.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.GracePeriod != "" {
+		if c.grace, err = time.ParseDuration(cfg.GracePeriod); err != nil {
+			return nil, err
+		}
+	}
+	if c.interval < 0 || c.grace < 0 {
+		return nil, errors.New("Interval and grace period of GC can't be negative")
+	}
+
+	return c, nil
+}
+
+// Enabled reports if collector has to run in background.
+func (c *Collector) Enabled() bool {
+	return c.interval > 0
+}
+
+// Run sweeps images every interval until context is done.
+func (c *Collector) Run(ctx context.Context) {
+	if !c.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Sweep(ctx)
+			if err != nil {
+				log.Println("Can't collect orphaned images", err.Error())
+				continue
+			}
+			log.Println(report.String())
+		}
+	}
+}
+
+// Sweep removes orphaned images once. Images are listed before
+// reading of references, so image uploaded by request which is
+// not finished yet is protected by grace period.
+func (c *Collector) Sweep(ctx context.Context) (*Report, error) {
+	images, err := c.im.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := c.db.GetImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		if key := keyOf(address); key != "" {
+			referenced[key] = true
+		}
+	}
+
+	report := &Report{
+		DryRun:   c.dryRun,
+		Checked:  len(images),
+		Orphaned: make([]string, 0),
+		Deleted:  make([]string, 0),
+		Failed:   make([]string, 0),
+	}
+	deadline := time.Now().Add(-c.grace)
+	for _, image := range images {
+		if referenced[image.Key] || image.LastModified.After(deadline) {
+			continue
+		}
+		report.Orphaned = append(report.Orphaned, image.Key)
+		if c.dryRun {
+			continue
+		}
+
+		if err := c.im.DeleteImage(ctx, image.Key); err != nil {
+			log.Println("Can't delete image", image.Key, err.Error())
+			report.Failed = append(report.Failed, image.Key)
+			continue
+		}
+		report.Deleted = append(report.Deleted, image.Key)
+	}
+
+	return report, nil
+}
+
+// keyOf returns key of image from its address. Address can be
+// location with host returned by IM (i.e. https://host/images/a.png).
+func keyOf(address string) string {
+	i := strings.Index(address, "/images/")
+	if i == -1 {
+		return ""
+	}
+	return address[i:]
+}
+
+// String returns short summary of report.
+func (r *Report) String() string {
+	if r.DryRun {
+		return fmt.Sprintf("GC: checked %d images, %d orphaned (dry run)",
+			r.Checked, len(r.Orphaned))
+	}
+	return fmt.Sprintf("GC: checked %d images, %d orphaned, %d deleted, %d failed",
+		r.Checked, len(r.Orphaned), len(r.Deleted), len(r.Failed))
+}
+
+// Print writes full report with list of orphaned images to w.
+func (r *Report) Print(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, r.String()); err != nil {
+		return err
+	}
+
+	failed := make(map[string]bool, len(r.Failed))
+	for _, key := range r.Failed {
+		failed[key] = true
+	}
+	for _, key := range r.Orphaned {
+		state := "deleted"
+		if r.DryRun {
+			state = "orphaned"
+		} else if failed[key] {
+			state = "failed"
+		}
+		if _, err := fmt.Fprintf(w, "%-9s %s\n", state, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package imagegc_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/fsimage"
+	"bmstu.codes/developers34/SBWeb/pkg/imagegc"
+	"bmstu.codes/developers34/SBWeb/pkg/memdb"
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := imagegc.New(imagegc.Config{Interval: "hour"}, nil, nil); err == nil {
+		t.Error("Expected error of parsing")
+	}
+	if _, err := imagegc.New(imagegc.Config{GracePeriod: "-1h"}, nil, nil); err == nil {
+		t.Error("Expected error of negative grace period")
+	}
+
+	c, err := imagegc.New(imagegc.Config{}, nil, nil)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if c.Enabled() {
+		t.Error("Collector without interval mustn't be enabled")
+	}
+	c.Run(context.Background()) // returns immediately
+}
+
+func TestSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imagegc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	im, err := fsimage.InitFS(fsimage.Config{
+		Directory: dir,
+		URL:       "http://127.0.0.1:8080",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	db := memdb.New()
+
+	// old images, only avatar and image of ad are referenced
+	old := time.Now().Add(-2 * time.Hour)
+	locations := make(map[string]string)
+	for _, name := range []string{"avatar", "ad", "orphan"} {
+		key := "/images/" + name + ".png"
+		locations[name], _ = im.UploadImage(ctx, key, strings.NewReader(name))
+		os.Chtimes(filepath.Join(dir, "images", name+".png"), old, old)
+	}
+	// new image isn't referenced yet
+	im.UploadImage(ctx, "/images/new.png", strings.NewReader("new"))
+
+	user := &model.User{Email: "ivan@gmail.com"}
+	user.AvatarAddress.SetValid(locations["avatar"])
+	id, _ := db.NewUser(ctx, user)
+	db.NewAd(ctx, &model.AdItem{UserID: id, AdImages: []string{locations["ad"]}})
+
+	// dry run doesn't delete anything
+	c, err := imagegc.New(imagegc.Config{GracePeriod: "1h", DryRun: true}, db, im)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	report, err := c.Sweep(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if report.Checked != 4 || len(report.Orphaned) != 1 || report.Orphaned[0] != "/images/orphan.png" {
+		t.Error("Expected only /images/orphan.png to be orphaned, got", report.Orphaned)
+	}
+	if len(report.Deleted) != 0 || !im.IsExist(ctx, "/images/orphan.png") {
+		t.Error("Images mustn't be deleted in dry run")
+	}
+
+	var buf bytes.Buffer
+	if err = report.Print(&buf); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	if !strings.Contains(buf.String(), "orphaned  /images/orphan.png") {
+		t.Error("Expected orphaned image in report, got", buf.String())
+	}
+
+	// orphaned image is deleted
+	c, _ = imagegc.New(imagegc.Config{GracePeriod: "1h"}, db, im)
+	report, err = c.Sweep(ctx)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if len(report.Deleted) != 1 || im.IsExist(ctx, "/images/orphan.png") {
+		t.Error("Expected /images/orphan.png to be deleted")
+	}
+	for _, key := range []string{"/images/avatar.png", "/images/ad.png", "/images/new.png"} {
+		if !im.IsExist(ctx, key) {
+			t.Error("Image mustn't be deleted", key)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+/*
+Package mailer implements model.Mailer interface. It sends emails
+to users, i.e. tokens of verification of email.
+
+SMTP sends mails through SMTP server. Connection is encrypted by STARTTLS
+if server supports it. Sending is cancelled when context is done.
+
+Outbox doesn't send mails: it keeps the last of them in memory and writes
+them to files of directory, so they can be read by developer or test.
+*/
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// message returns mail from such sender in format of RFC 5322.
+// Subject is encoded if it's not ASCII and body is encoded in base64.
+func message(from string, mail *model.Mail) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + mail.To + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", mail.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	// lines of base64 mustn't be longer than 76 characters
+	body := base64.StdEncoding.EncodeToString([]byte(mail.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package mailer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bmstu.codes/developers34/SBWeb/pkg/mailer"
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, err := mailer.NewOutbox(mailer.OutboxConfig{Directory: filepath.Join(dir, "outbox")})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	ctx := context.Background()
+	o.SendMail(ctx, &model.Mail{To: "ivan@gmail.com", Subject: "Подтверждение", Body: "Token: 123"})
+	o.SendMail(ctx, &model.Mail{To: "petr@gmail.com", Subject: "Hello", Body: "Hi"})
+
+	mails := o.Mails()
+	if len(mails) != 2 || mails[0].To != "ivan@gmail.com" || mails[1].Body != "Hi" {
+		t.Error("Unexpected mails in outbox")
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "outbox"))
+	if len(files) != 2 {
+		t.Fatal("Expected 2 files of mails got", len(files))
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "outbox", files[0].Name()))
+	if !strings.Contains(string(data), "To: ivan@gmail.com\r\n") ||
+		!strings.Contains(string(data), "Subject: =?UTF-8?b?") {
+		t.Error("Unexpected file of mail", string(data))
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	if _, err := mailer.NewSMTP(mailer.SMTPConfig{From: "noreply@example.com"}); err == nil {
+		t.Error("SMTP can't be created without address")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+
+	// server of SMTP which accepts one mail
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 localhost ESMTP")
+		lines := make([]string, 0)
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				c.PrintfLine("250 localhost")
+			case line == "DATA":
+				c.PrintfLine("354 Go ahead")
+				data, _ := c.ReadDotLines()
+				lines = append(lines, data...)
+				c.PrintfLine("250 OK")
+			case line == "QUIT":
+				c.PrintfLine("221 Bye")
+				received <- lines
+				return
+			default:
+				c.PrintfLine("250 OK")
+			}
+		}
+		received <- lines
+	}()
+
+	s, err := mailer.NewSMTP(mailer.SMTPConfig{
+		Address: l.Addr().String(),
+		From:    "noreply@example.com",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	err = s.SendMail(context.Background(), &model.Mail{To: "ivan@gmail.com", Subject: "Hello", Body: "Hi"})
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	lines := strings.Join(<-received, "\n")
+	if !strings.Contains(lines, "MAIL FROM:<noreply@example.com>") ||
+		!strings.Contains(lines, "RCPT TO:<ivan@gmail.com>") ||
+		!strings.Contains(lines, "Subject: Hello") {
+		t.Error("Unexpected session of SMTP", lines)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package mailer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// maxMails is a maximal number of mails kept by Outbox in memory
+const maxMails = 100
+
+// OutboxConfig is config of outbox. Directory is a path to directory
+// where mails are written as .eml files; they aren't written if it's
+// empty. From is an address of sender.
+type OutboxConfig struct {
+	Directory string `json:"Directory"`
+	From      string `json:"From"`
+}
+
+// Outbox is a struct that implements model.Mailer interface.
+// It's safe for concurrent use.
+type Outbox struct {
+	mu    sync.Mutex
+	cfg   OutboxConfig
+	mails []*model.Mail
+	sent  int
+}
+
+// NewOutbox creates outbox and its directory if needed.
+func NewOutbox(cfg OutboxConfig) (*Outbox, error) {
+	if cfg.Directory != "" {
+		if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.From == "" {
+		cfg.From = "noreply@localhost"
+	}
+	return &Outbox{cfg: cfg}, nil
+}
+
+// SendMail keeps mail and writes it to directory of outbox.
+func (o *Outbox) SendMail(ctx context.Context, mail *model.Mail) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sent++
+	if o.cfg.Directory != "" {
+		name := time.Now().UTC().Format("20060102T150405") + "-" + strconv.Itoa(o.sent) + ".eml"
+		err := ioutil.WriteFile(filepath.Join(o.cfg.Directory, name), message(o.cfg.From, mail), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	m := *mail
+	o.mails = append(o.mails, &m)
+	if len(o.mails) > maxMails {
+		o.mails = o.mails[len(o.mails)-maxMails:]
+	}
+	return nil
+}
+
+// Mails returns mails kept by outbox from the oldest one.
+func (o *Outbox) Mails() []*model.Mail {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	mails := make([]*model.Mail, len(o.mails))
+	copy(mails, o.mails)
+	return mails
+}
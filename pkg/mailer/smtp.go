@@ -0,0 +1,93 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// SMTPConfig is config of SMTP mailer. Address is a host with port of
+// SMTP server (i.e. smtp.example.com:587). Username and Password are
+// used for authentication if Username isn't empty. From is an address
+// of sender.
+type SMTPConfig struct {
+	Address  string `json:"Address"`
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+	From     string `json:"From"`
+}
+
+// SMTP is a struct that implements model.Mailer interface.
+type SMTP struct {
+	cfg  SMTPConfig
+	host string
+}
+
+// NewSMTP creates SMTP mailer. Connection to server is made for every mail.
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	if cfg.Address == "" || cfg.From == "" {
+		return nil, errors.New("No address of SMTP server or sender specified")
+	}
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTP{cfg: cfg, host: host}, nil
+}
+
+// SendMail sends mail through SMTP server.
+func (s *SMTP) SendMail(ctx context.Context, mail *model.Mail) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.host)
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	if err = c.Rcpt(mail.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(message(s.cfg.From, mail)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
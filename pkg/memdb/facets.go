@@ -0,0 +1,84 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// GetFacets returns numbers of ads matching search parameters grouped
+// by country, city, subway station and bucket of price. Limit, offset
+// and cursor of search parameters aren't used.
+func (h *Handler) GetFacets(ctx context.Context, sp *model.SearchParams) (*model.Facets, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ads := h.matchAds(sp)
+	facets := &model.Facets{
+		Countries:      facetValues(ads, func(ad *model.AdItem) string { return ad.Country.String }),
+		Cities:         facetValues(ads, func(ad *model.AdItem) string { return ad.City }),
+		SubwayStations: facetValues(ads, func(ad *model.AdItem) string { return ad.SubwayStation.String }),
+		Prices:         make([]*model.PriceBucket, 0),
+	}
+
+	counts := make([]int64, len(model.PriceBuckets)+1)
+	for _, ad := range ads {
+		if ad.Price.Valid {
+			counts[sort.Search(len(model.PriceBuckets), func(i int) bool {
+				return model.PriceBuckets[i] > ad.Price.Int64
+			})]++
+		}
+	}
+	for i, count := range counts {
+		if count > 0 {
+			bucket := model.NewPriceBucket(i)
+			bucket.Count = count
+			facets.Prices = append(facets.Prices, bucket)
+		}
+	}
+
+	return facets, nil
+}
+
+// facetValues counts ads for every non-empty value of field ignoring case
+// like postgres does and returns the most frequent values.
+func facetValues(ads []*model.AdItem, field func(*model.AdItem) string) []*model.FacetValue {
+	groups := make(map[string]*model.FacetValue)
+	for _, ad := range ads {
+		value := field(ad)
+		if value == "" {
+			continue
+		}
+		key := strings.ToLower(value)
+		v, ok := groups[key]
+		if !ok {
+			v = &model.FacetValue{Value: value}
+			groups[key] = v
+		}
+		if value < v.Value {
+			v.Value = value
+		}
+		v.Count++
+	}
+
+	values := make([]*model.FacetValue, 0, len(groups))
+	for _, v := range groups {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if len(values) > model.MaxFacetValues {
+		values = values[:model.MaxFacetValues]
+	}
+	return values
+}
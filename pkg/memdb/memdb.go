@@ -0,0 +1,519 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+/*
+Package memdb implements model.DB interface. It keeps users and ads in memory
+of the process, so it can be used to run the service without database
+(i.e. for demonstration) and for fast tests.
+
+Handler behaves like db.Handler: the ID of returned user or ad is -1 if there is
+no such user or ad, NewUser returns -1 if email is not unique and removing of user
+removes all his ads. Categories can be added only by AddCategory. Operations don't
+block, so context passed to them is not used. Search of ads ranks and highlights
+words like postgres does, but words of query aren't stemmed.
+
+WithTx runs function on a copy of data and replaces data with this copy when
+function succeeds. Other operations wait until transaction is finished.
+*/
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// this errors are returned in the same cases as constraint errors of postgres
+var (
+	errNotUniqueEmail = errors.New(`duplicate key value violates unique constraint "users_email_key"`)
+	errNoOwner        = errors.New(`insert or update on table "ads" violates foreign key constraint "ads_owner_ad_fkey"`)
+	errPositivePrice  = errors.New(`new row for relation "ads" violates check constraint "positive_price"`)
+	errLocation       = errors.New(`new row for relation "ads" violates check constraint "full_location"`)
+	errNoCategory     = errors.New(`insert or update on table "ads" violates foreign key constraint "ads_category_id_fkey"`)
+	errNoParent       = errors.New(`insert or update on table "categories" violates foreign key constraint "categories_parent_id_fkey"`)
+	errNotUniqueSlug  = errors.New(`duplicate key value violates unique constraint "categories_slug_key"`)
+	errNoSearch       = errors.New(`insert or update on table "alerts" violates foreign key constraint "alerts_search_id_fkey"`)
+	errNoTokenOwner   = errors.New(`insert or update on table "tokens" violates foreign key constraint "tokens_user_id_fkey"`)
+)
+
+// Handler stores users, ads, categories, saved searches, alerts and tokens and
+// implements database interface needed by API. Tokens are stored by their hashes.
+type Handler struct {
+	mu sync.RWMutex
+
+	users      map[int64]*model.User
+	ads        map[int64]*model.AdItem
+	categories map[int64]*model.Category
+	searches   map[int64]*model.SavedSearch
+	alerts     map[int64]*model.Alert
+	tokens     map[string]*model.Token
+
+	// emails of users which aren't confirmed yet
+	newEmails map[int64]string
+
+	// sequences of IDs like SERIAL in postgres
+	lastUserID     int64
+	lastAdID       int64
+	lastCategoryID int64
+	lastSearchID   int64
+	lastAlertID    int64
+
+	// inTx is true for copy of data used by transaction
+	inTx bool
+}
+
+// New creates empty in-memory database.
+func New() *Handler {
+	return &Handler{
+		users:      make(map[int64]*model.User),
+		ads:        make(map[int64]*model.AdItem),
+		categories: make(map[int64]*model.Category),
+		searches:   make(map[int64]*model.SavedSearch),
+		alerts:     make(map[int64]*model.Alert),
+		tokens:     make(map[string]*model.Token),
+		newEmails:  make(map[int64]string),
+	}
+}
+
+// GetAds returns slice of model.AdItem based on incoming filters.
+// Ads found by query are ordered by rank like in db.Handler.
+func (h *Handler) GetAds(ctx context.Context, sp *model.SearchParams) ([]*model.AdItem, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ads := h.matchAds(sp)
+	if sp.CursorID > 0 {
+		ads = pageAfterCursor(ads, sp)
+	} else if sp.Offset < len(ads) {
+		ads = ads[sp.Offset:]
+	} else {
+		ads = ads[:0]
+	}
+	if len(ads) > sp.Limit {
+		ads = ads[:sp.Limit]
+	}
+	for i, ad := range ads {
+		ads[i] = h.readAd(ad)
+	}
+
+	return ads, nil
+}
+
+// CountAds returns number of ads matching search parameters.
+func (h *Handler) CountAds(ctx context.Context, sp *model.SearchParams) (int64, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return int64(len(h.matchAds(sp))), nil
+}
+
+// GetAdsOfUser returns slice of model.AdItem with such user.
+func (h *Handler) GetAdsOfUser(ctx context.Context, userID int64, sort string) ([]*model.AdItem, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ads := make([]*model.AdItem, 0)
+	for id := int64(1); id <= h.lastAdID; id++ {
+		if ad, ok := h.ads[id]; ok && ad.UserID == userID {
+			ads = append(ads, h.readAd(ad))
+		}
+	}
+	sortAds(ads, sort, false)
+
+	return ads, nil
+}
+
+// GetAd returns model.AdItem struct with such ID.
+func (h *Handler) GetAd(ctx context.Context, adID int64) (*model.AdItem, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ad, ok := h.ads[adID]
+	if !ok {
+		return &model.AdItem{ID: -1, AdImages: make([]string, 0)}, sql.ErrNoRows
+	}
+
+	return h.readAd(ad), nil
+}
+
+// GetUserWithID returns model.User struct with such ID.
+func (h *Handler) GetUserWithID(ctx context.Context, userID int64) (*model.User, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	user, ok := h.users[userID]
+	if !ok {
+		return &model.User{ID: -1}, sql.ErrNoRows
+	}
+
+	u := *user
+	u.Password = ""
+	return &u, nil
+}
+
+// GetUserWithEmail returns model.User struct with such email.
+func (h *Handler) GetUserWithEmail(ctx context.Context, email string) (*model.User, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, user := range h.users {
+		if user.Email == email {
+			u := *user
+			return &u, nil
+		}
+	}
+
+	return &model.User{ID: -1}, sql.ErrNoRows
+}
+
+// NewUser adds new User if it is possible.
+func (h *Handler) NewUser(ctx context.Context, user *model.User) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, u := range h.users {
+		if u.Email == user.Email {
+			return -1, errNotUniqueEmail
+		}
+	}
+
+	h.lastUserID++
+	u := *user
+	u.ID = h.lastUserID
+	u.RegTime = time.Now()
+	h.users[u.ID] = &u
+
+	return u.ID, nil
+}
+
+// NewAd creates a new ad.
+func (h *Handler) NewAd(ctx context.Context, ad *model.AdItem) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ad.AdImagesStr.SetValid(strings.Join(ad.AdImages, ","))
+	if _, ok := h.users[ad.UserID]; !ok {
+		return 0, errNoOwner
+	}
+	if ad.Price.Valid && ad.Price.Int64 <= 0 {
+		return 0, errPositivePrice
+	}
+	if !validLocation(ad) {
+		return 0, errLocation
+	}
+	if _, ok := h.categories[ad.CategoryID.Int64]; ad.CategoryID.Valid && !ok {
+		return 0, errNoCategory
+	}
+
+	h.lastAdID++
+	a := *ad
+	a.ID = h.lastAdID
+	a.User = model.User{}
+	a.CreationTime = time.Now()
+	h.ads[a.ID] = &a
+
+	return a.ID, nil
+}
+
+// EditUser updates User with ID provided from function argument.
+func (h *Handler) EditUser(ctx context.Context, user *model.User) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	u, ok := h.users[user.ID]
+	if !ok {
+		return 0, nil
+	}
+
+	u.FirstName = user.FirstName
+	u.LastName = user.LastName
+	u.TelNumber = user.TelNumber
+	u.About = user.About
+	u.AvatarAddress = user.AvatarAddress
+
+	return 1, nil
+}
+
+// EditPassword replaces hash of password of user with such ID.
+func (h *Handler) EditPassword(ctx context.Context, userID int64, hash string) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	u, ok := h.users[userID]
+	if !ok {
+		return 0, nil
+	}
+	u.Password = hash
+
+	return 1, nil
+}
+
+// SetNewEmail stores email which replaces email of user
+// with such ID after confirmation.
+func (h *Handler) SetNewEmail(ctx context.Context, userID int64, email string) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.users[userID]; !ok {
+		return 0, nil
+	}
+	h.newEmails[userID] = email
+
+	return 1, nil
+}
+
+// ConfirmNewEmail replaces email of user with such ID by new one
+// and marks it as verified. It returns -1 if email isn't unique.
+func (h *Handler) ConfirmNewEmail(ctx context.Context, userID int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	u, ok := h.users[userID]
+	email, pending := h.newEmails[userID]
+	if !ok || !pending {
+		return 0, nil
+	}
+	for _, other := range h.users {
+		if other.Email == email {
+			return -1, errNotUniqueEmail
+		}
+	}
+
+	u.Email = email
+	u.EmailVerified = true
+	delete(h.newEmails, userID)
+
+	return 1, nil
+}
+
+// EditAd updates information about ad with ID provided from function argument.
+func (h *Handler) EditAd(ctx context.Context, ad *model.AdItem) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ad.AdImagesStr.SetValid(strings.Join(ad.AdImages, ","))
+
+	a, ok := h.ads[ad.ID]
+	if !ok {
+		return 0, nil
+	}
+	if ad.Price.Valid && ad.Price.Int64 <= 0 {
+		return -1, errPositivePrice
+	}
+	if !validLocation(ad) {
+		return -1, errLocation
+	}
+	if _, ok := h.categories[ad.CategoryID.Int64]; ad.CategoryID.Valid && !ok {
+		return -1, errNoCategory
+	}
+
+	a.Title = ad.Title
+	a.Description = ad.Description
+	a.Price = ad.Price
+	a.Country = ad.Country
+	a.City = ad.City
+	a.SubwayStation = ad.SubwayStation
+	a.AdImagesStr = ad.AdImagesStr
+	a.Latitude = ad.Latitude
+	a.Longitude = ad.Longitude
+	a.CategoryID = ad.CategoryID
+
+	return 1, nil
+}
+
+// RemoveUser deletes user with such ID. Ads, saved searches and tokens
+// of user and alerts about them are deleted too.
+func (h *Handler) RemoveUser(ctx context.Context, userID int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.users[userID]; !ok {
+		return 0, nil
+	}
+
+	delete(h.users, userID)
+	for id, ad := range h.ads {
+		if ad.UserID == userID {
+			delete(h.ads, id)
+		}
+	}
+	for id, search := range h.searches {
+		if search.UserID == userID {
+			delete(h.searches, id)
+		}
+	}
+	h.removeAlerts()
+	h.removeTokens()
+	delete(h.newEmails, userID)
+
+	return 1, nil
+}
+
+// RemoveAd deletes ad with such ID and alerts about it.
+func (h *Handler) RemoveAd(ctx context.Context, adID int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.ads[adID]; !ok {
+		return 0, nil
+	}
+
+	delete(h.ads, adID)
+	h.removeAlerts()
+
+	return 1, nil
+}
+
+// GetCategories returns all categories ordered by ID.
+func (h *Handler) GetCategories(ctx context.Context) ([]*model.Category, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	categories := make([]*model.Category, 0, len(h.categories))
+	for id := int64(1); id <= h.lastCategoryID; id++ {
+		if category, ok := h.categories[id]; ok {
+			c := *category
+			categories = append(categories, &c)
+		}
+	}
+
+	return categories, nil
+}
+
+// AddCategory adds new category. Parent of category must exist and its slug
+// must be unique. It isn't a part of model.DB: categories of postgres database
+// are managed by its administrator.
+func (h *Handler) AddCategory(category *model.Category) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.categories[category.ParentID.Int64]; category.ParentID.Valid && !ok {
+		return 0, errNoParent
+	}
+	for _, c := range h.categories {
+		if c.Slug == category.Slug {
+			return 0, errNotUniqueSlug
+		}
+	}
+
+	h.lastCategoryID++
+	c := *category
+	c.ID = h.lastCategoryID
+	c.Children = nil
+	h.categories[c.ID] = &c
+
+	return c.ID, nil
+}
+
+// GetImages returns addresses of images of all ads and avatars of users.
+func (h *Handler) GetImages(ctx context.Context) ([]string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	images := make([]string, 0)
+	for _, ad := range h.ads {
+		if ad.AdImagesStr.String != "" {
+			images = append(images, strings.Split(ad.AdImagesStr.String, ",")...)
+		}
+	}
+	for _, user := range h.users {
+		if user.AvatarAddress.String != "" {
+			images = append(images, user.AvatarAddress.String)
+		}
+	}
+
+	return images, nil
+}
+
+// WithTx runs fn in transaction. Changes made by fn are applied
+// only if it returns nil. Nested call of WithTx runs fn in the same transaction.
+func (h *Handler) WithTx(ctx context.Context, fn func(tx model.DB) error) error {
+	if h.inTx {
+		return fn(h)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tx := h.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	h.users, h.ads = tx.users, tx.ads
+	h.searches, h.alerts = tx.searches, tx.alerts
+	h.tokens, h.newEmails = tx.tokens, tx.newEmails
+	h.lastUserID, h.lastAdID = tx.lastUserID, tx.lastAdID
+	h.lastSearchID, h.lastAlertID = tx.lastSearchID, tx.lastAlertID
+
+	return nil
+}
+
+// clone returns deep copy of data for transaction. Lock must be held.
+// Categories aren't changed by model.DB, so they are shared.
+func (h *Handler) clone() *Handler {
+	tx := &Handler{
+		users:          make(map[int64]*model.User, len(h.users)),
+		ads:            make(map[int64]*model.AdItem, len(h.ads)),
+		categories:     h.categories,
+		searches:       make(map[int64]*model.SavedSearch, len(h.searches)),
+		alerts:         make(map[int64]*model.Alert, len(h.alerts)),
+		tokens:         make(map[string]*model.Token, len(h.tokens)),
+		newEmails:      make(map[int64]string, len(h.newEmails)),
+		lastUserID:     h.lastUserID,
+		lastAdID:       h.lastAdID,
+		lastCategoryID: h.lastCategoryID,
+		lastSearchID:   h.lastSearchID,
+		lastAlertID:    h.lastAlertID,
+		inTx:           true,
+	}
+	for id, user := range h.users {
+		u := *user
+		tx.users[id] = &u
+	}
+	for id, ad := range h.ads {
+		a := *ad
+		tx.ads[id] = &a
+	}
+	for id, search := range h.searches {
+		s := *search
+		tx.searches[id] = &s
+	}
+	for id, alert := range h.alerts {
+		a := *alert
+		tx.alerts[id] = &a
+	}
+	for hash, token := range h.tokens {
+		t := *token
+		tx.tokens[hash] = &t
+	}
+	for id, email := range h.newEmails {
+		tx.newEmails[id] = email
+	}
+
+	return tx
+}
+
+// readAd returns copy of stored ad joined with its owner
+// like it's done by SQL queries of db.Handler. Read lock must be held.
+func (h *Handler) readAd(ad *model.AdItem) *model.AdItem {
+	a := *ad
+	if a.AdImagesStr.String != "" {
+		a.AdImages = strings.Split(a.AdImagesStr.String, ",")
+	} else {
+		a.AdImages = make([]string, 0)
+	}
+
+	if owner, ok := h.users[a.UserID]; ok {
+		a.User = *owner
+		a.User.Password = ""
+	}
+
+	return &a
+}
@@ -0,0 +1,726 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/guregu/null.v3/zero"
+
+	"bmstu.codes/developers34/SBWeb/pkg/memdb"
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+func TestInterface(t *testing.T) {
+	var h model.DB = memdb.New()
+	ctx := context.Background()
+
+	user := model.User{
+		FirstName: "Ivan",
+		LastName:  "Ivanov",
+		Email:     "ivan@gmail.com",
+		Password:  "123456",
+	}
+
+	id, err := h.NewUser(ctx, &user)
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if id != 1 {
+		t.Error("Expected id = 1 got = ", id)
+	}
+	user.ID = id
+
+	id, err = h.NewUser(ctx, &user)
+	if err == nil || id != -1 {
+		t.Error("Expected ID = -1 got = ", id)
+	}
+
+	_, err = h.NewAd(ctx, &model.AdItem{Title: "Orphan", UserID: 15, City: "Moscow"})
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	_, err = h.NewAd(ctx, &model.AdItem{Title: "Free", UserID: 1, City: "Moscow", Price: zero.NewInt(-1, true)})
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	h.NewAd(ctx, &model.AdItem{
+		Title:       "Building",
+		UserID:      1,
+		Description: "Some description",
+		Price:       zero.NewInt(100500, true),
+		City:        "Moscow",
+	})
+	h.NewAd(ctx, &model.AdItem{
+		Title:       "Building that can be built",
+		UserID:      1,
+		Description: "Some description",
+		City:        "Moscow",
+		AdImages:    []string{"/images/a.png", "/images/b.png"},
+	})
+
+	ads, err := h.GetAds(ctx, &model.SearchParams{Limit: 15})
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	} else if len(ads) != 2 {
+		t.Error("Unexpected len", len(ads))
+	} else if ads[0].Title != "Building" || ads[1].Title != "Building that can be built" {
+		t.Error("Expected equal ads")
+	} else if ads[0].User.Email != user.Email || ads[0].User.Password != "" {
+		t.Error("Expected owner without password")
+	} else if len(ads[0].AdImages) != 0 || len(ads[1].AdImages) != 2 {
+		t.Error("Unexpected images", ads[0].AdImages, ads[1].AdImages)
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "THAT"})
+	if len(ads) != 1 || ads[0].ID != 2 {
+		t.Error("Expected second ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 1, Offset: 1})
+	if len(ads) != 1 || ads[0].ID != 2 {
+		t.Error("Expected second ad")
+	}
+
+	ads, _ = h.GetAdsOfUser(ctx, 1, "")
+	if len(ads) != 2 {
+		t.Error("Unexpected len", len(ads))
+	}
+
+	ad, _ := h.GetAd(ctx, 15)
+	if ad.ID != -1 {
+		t.Error("Expected ID = -1")
+	}
+
+	u, _ := h.GetUserWithID(ctx, 15)
+	if u.ID != -1 {
+		t.Error("Expected ID = -1")
+	}
+
+	u, _ = h.GetUserWithEmail(ctx, "feffr2C")
+	if u.ID != -1 {
+		t.Error("Expected ID = -1")
+	}
+
+	u, err = h.GetUserWithEmail(ctx, "ivan@gmail.com")
+	if err != nil || u.Password != "123456" {
+		t.Error("Expected user with password")
+	}
+
+	u, err = h.GetUserWithID(ctx, 1)
+	if err != nil || u.Password != "" {
+		t.Error("Expected user without password")
+	}
+
+	user.FirstName = "Petr"
+	id, err = h.EditUser(ctx, &user)
+	if err != nil || id != 1 {
+		t.Error("Expected id = 1 got = ", id)
+	}
+	u, _ = h.GetUserWithID(ctx, 1)
+	if u.FirstName != "Petr" {
+		t.Error("User wasn't updated")
+	}
+
+	id, err = h.EditAd(ctx, &model.AdItem{ID: 1, Title: "House", City: "Kazan"})
+	if err != nil || id != 1 {
+		t.Error("Expected id = 1 got = ", id)
+	}
+	ad, _ = h.GetAd(ctx, 1)
+	if ad.Title != "House" || ad.City != "Kazan" || ad.UserID != 1 {
+		t.Error("Ad wasn't updated")
+	}
+
+	id, _ = h.EditAd(ctx, &model.AdItem{ID: 15})
+	if id != 0 {
+		t.Error("Expected id = 0 got = ", id)
+	}
+
+	id, err = h.RemoveAd(ctx, 1)
+	if err != nil || id != 1 {
+		t.Error("Expected id = 1 got = ", id)
+	}
+
+	id, err = h.RemoveUser(ctx, 1)
+	if err != nil || id != 1 {
+		t.Error("Expected id = 1 got = ", id)
+	}
+
+	ad, _ = h.GetAd(ctx, 2)
+	if ad.ID != -1 {
+		t.Error("Ads of user must be removed")
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	h := memdb.New()
+	ctx := context.Background()
+	userID, _ := h.NewUser(ctx, &model.User{Email: "ivan@gmail.com"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				id, _ := h.NewAd(ctx, &model.AdItem{Title: "Building", UserID: userID})
+				h.GetAds(ctx, &model.SearchParams{Limit: 15})
+				h.RemoveAd(ctx, id)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ads, _ := h.GetAdsOfUser(ctx, userID, "")
+	if len(ads) != 0 {
+		t.Error("Unexpected len", len(ads))
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	h := memdb.New()
+	ctx := context.Background()
+
+	user := model.User{
+		FirstName: "Ivan",
+		LastName:  "Ivanov",
+		Email:     "ivan@gmail.com",
+		Password:  "123456",
+	}
+	id, _ := h.NewUser(ctx, &user)
+	user.ID = id
+
+	// failed transaction mustn't change anything
+	errTx := errors.New("Rollback")
+	err := h.WithTx(ctx, func(tx model.DB) error {
+		edited := user
+		edited.FirstName = "Petr"
+		tx.EditUser(ctx, &edited)
+		tx.NewAd(ctx, &model.AdItem{Title: "Building", UserID: id})
+		if _, err := tx.RemoveUser(ctx, id); err != nil {
+			t.Error("Unexpected error", err.Error())
+		}
+		return errTx
+	})
+	if err != errTx {
+		t.Error("Expected error of transaction")
+	}
+	if u, _ := h.GetUserWithID(ctx, id); u.FirstName != "Ivan" {
+		t.Error("Expected user to be rolled back, got", u.FirstName)
+	}
+	if ads, _ := h.GetAdsOfUser(ctx, id, ""); len(ads) != 0 {
+		t.Error("Expected no ads got", len(ads))
+	}
+
+	// changes of succeeded transaction are visible
+	err = h.WithTx(ctx, func(tx model.DB) error {
+		_, err := tx.NewAd(ctx, &model.AdItem{Title: "Building", UserID: id})
+		if err != nil {
+			return err
+		}
+		// nested transaction is the same
+		return tx.WithTx(ctx, func(tx model.DB) error {
+			_, err := tx.NewAd(ctx, &model.AdItem{Title: "House", UserID: id})
+			return err
+		})
+	})
+	if err != nil {
+		t.Error("Unexpected error", err.Error())
+	}
+	if ads, _ := h.GetAdsOfUser(ctx, id, ""); len(ads) != 2 {
+		t.Error("Expected 2 ads got", len(ads))
+	}
+}
+
+func TestSearchAds(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	h.NewAd(ctx, &model.AdItem{Title: "Ремонт квартир", UserID: 1, Description: "Укладка плитки <быстро>", City: "Москва"})
+	h.NewAd(ctx, &model.AdItem{Title: "Укладка плитки", UserID: 1, Description: "Плитка любой сложности", City: "Москва"})
+	h.NewAd(ctx, &model.AdItem{Title: "Building", UserID: 1, Description: "Roofs", City: "Moscow"})
+
+	ads, err := h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "укладка плитки"})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if len(ads) != 2 || ads[0].ID != 2 || ads[1].ID != 1 {
+		t.Fatal("Expected second and first ads", len(ads))
+	}
+	if ads[0].TitleSnippet != "<b>Укладка</b> <b>плитки</b>" {
+		t.Error("Unexpected snippet", ads[0].TitleSnippet)
+	}
+	if ads[1].DescriptionSnippet != "<b>Укладка</b> <b>плитки</b> &lt;быстро&gt;" {
+		t.Error("Unexpected snippet", ads[1].DescriptionSnippet)
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 1, Offset: 1, Query: "плитки"})
+	if len(ads) != 1 || ads[0].ID != 1 {
+		t.Error("Expected first ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: "moscow"})
+	if len(ads) != 1 || ads[0].ID != 3 {
+		t.Error("Expected third ad")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15, Query: " "})
+	if len(ads) != 0 {
+		t.Error("Expected no ads")
+	}
+}
+
+func TestFilterAds(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	h.NewUser(ctx, &model.User{FirstName: "Alex", LastName: "Ivanov", Email: "alex@gmail.com"})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.NewInt(100, true),
+		SubwayStation: zero.StringFrom("Arbatskaya"), AdImages: []string{"/images/a.png"}})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Kazan", Price: zero.NewInt(500, true)})
+	h.NewAd(ctx, &model.AdItem{Title: "Walls", UserID: 2, City: "moscow", Country: zero.StringFrom("Russia")})
+
+	hasImages, noImages := true, false
+	for _, c := range []struct {
+		sp  model.SearchParams
+		ids []int64
+	}{
+		{model.SearchParams{MinPrice: 200}, []int64{2}},
+		{model.SearchParams{MaxPrice: 200}, []int64{1}},
+		{model.SearchParams{City: "MOSCOW"}, []int64{1, 3}},
+		{model.SearchParams{Country: "russia"}, []int64{3}},
+		{model.SearchParams{SubwayStation: "arbatskaya"}, []int64{1}},
+		{model.SearchParams{OwnerID: 2}, []int64{3}},
+		{model.SearchParams{HasImages: &hasImages}, []int64{1}},
+		{model.SearchParams{HasImages: &noImages}, []int64{2, 3}},
+		{model.SearchParams{CreatedAfter: time.Now().Add(time.Hour)}, []int64{}},
+		{model.SearchParams{CreatedBefore: time.Now().Add(time.Hour)}, []int64{1, 2, 3}},
+		{model.SearchParams{Query: "roof", City: "moscow"}, []int64{1}},
+		{model.SearchParams{City: "Moscow", Offset: 1}, []int64{3}},
+	} {
+		c.sp.Limit = 15
+		ads, _ := h.GetAds(ctx, &c.sp)
+		ids := make([]int64, 0)
+		for _, ad := range ads {
+			ids = append(ids, ad.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+			t.Error("Expected", c.ids, "got", ids, "for", c.sp)
+		}
+	}
+}
+
+func TestSortAds(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.NewInt(500, true)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow"})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, Description: "Roof repair", City: "Moscow", Price: zero.NewInt(100, true)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.NewInt(500, true)})
+
+	for _, c := range []struct {
+		sp  model.SearchParams
+		ids []int64
+	}{
+		{model.SearchParams{}, []int64{1, 2, 3, 4}},
+		{model.SearchParams{Sort: model.SortOldest}, []int64{1, 2, 3, 4}},
+		{model.SearchParams{Sort: model.SortNewest}, []int64{4, 3, 2, 1}},
+		{model.SearchParams{Sort: model.SortPriceAsc}, []int64{3, 1, 4, 2}},
+		{model.SearchParams{Sort: model.SortPriceDesc}, []int64{1, 4, 3, 2}},
+		{model.SearchParams{Sort: model.SortPriceDesc, Limit: 2, Offset: 1}, []int64{4, 3}},
+		{model.SearchParams{Query: "roof"}, []int64{3, 1, 2, 4}},
+		{model.SearchParams{Query: "roof", Sort: model.SortPriceAsc}, []int64{3, 1, 4, 2}},
+	} {
+		if c.sp.Limit == 0 {
+			c.sp.Limit = 15
+		}
+		ads, _ := h.GetAds(ctx, &c.sp)
+		ids := make([]int64, 0)
+		for _, ad := range ads {
+			ids = append(ids, ad.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+			t.Error("Expected", c.ids, "got", ids, "for", c.sp)
+		}
+	}
+
+	ads, _ := h.GetAdsOfUser(ctx, 1, model.SortPriceAsc)
+	if len(ads) != 4 || ads[0].ID != 3 || ads[3].ID != 2 {
+		t.Error("Expected ads of user ordered by price")
+	}
+}
+
+func TestCursorAds(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	for i := 0; i < 5; i++ {
+		h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow"})
+	}
+	third, _ := h.GetAd(ctx, 3)
+
+	for _, c := range []struct {
+		sp  model.SearchParams
+		ids []int64
+	}{
+		{model.SearchParams{Limit: 2}, []int64{4, 5}},
+		{model.SearchParams{Limit: 2, Backward: true}, []int64{1, 2}},
+		{model.SearchParams{Limit: 1, Backward: true}, []int64{2}},
+		{model.SearchParams{Limit: 2, Sort: model.SortNewest}, []int64{2, 1}},
+		{model.SearchParams{Limit: 2, Sort: model.SortNewest, Backward: true}, []int64{5, 4}},
+		{model.SearchParams{Limit: 2, City: "Kazan"}, []int64{}},
+	} {
+		c.sp.CursorTime = third.CreationTime
+		c.sp.CursorID = third.ID
+		ads, _ := h.GetAds(ctx, &c.sp)
+		ids := make([]int64, 0)
+		for _, ad := range ads {
+			ids = append(ids, ad.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+			t.Error("Expected", c.ids, "got", ids, "for", c.sp)
+		}
+	}
+
+	count, err := h.CountAds(ctx, &model.SearchParams{Limit: 1, Offset: 1, CursorID: 3})
+	if err != nil || count != 5 {
+		t.Error("Expected 5 ads got", count, err)
+	}
+	count, _ = h.CountAds(ctx, &model.SearchParams{Query: "nothing"})
+	if count != 0 {
+		t.Error("Expected no ads got", count)
+	}
+}
+
+func TestGeoAds(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	point := func(latitude, longitude float64) (*float64, *float64) {
+		return &latitude, &longitude
+	}
+	zelenograd := &model.AdItem{Title: "Roof", UserID: 1, City: "Zelenograd"}
+	zelenograd.Latitude, zelenograd.Longitude = point(55.9825, 37.1814)
+	spb := &model.AdItem{Title: "Roof", UserID: 1, City: "Saint Petersburg"}
+	spb.Latitude, spb.Longitude = point(59.9343, 30.3351)
+	moscow := &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow"}
+	moscow.Latitude, moscow.Longitude = point(55.7601, 37.6186)
+	h.NewAd(ctx, zelenograd)
+	h.NewAd(ctx, spb)
+	h.NewAd(ctx, moscow)
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow"})
+
+	if _, err := h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Latitude: moscow.Latitude}); err == nil {
+		t.Error("Expected error of location")
+	}
+
+	sp := &model.SearchParams{Limit: 15, RadiusKm: 50, Sort: model.SortDistance}
+	sp.Latitude, sp.Longitude = point(55.7558, 37.6173)
+	ads, _ := h.GetAds(ctx, sp)
+	if len(ads) != 2 || ads[0].ID != 3 || ads[1].ID != 1 {
+		t.Fatal("Expected ads in Moscow and Zelenograd", len(ads))
+	}
+	if d := *ads[0].Distance; d < 0.4 || d > 0.6 {
+		t.Error("Unexpected distance", d)
+	}
+	if d := *ads[1].Distance; d < 36 || d > 38 {
+		t.Error("Unexpected distance", d)
+	}
+	if count, _ := h.CountAds(ctx, sp); count != 2 {
+		t.Error("Expected 2 ads got", count)
+	}
+
+	sp.RadiusKm = 1000
+	sp.Sort = ""
+	ads, _ = h.GetAds(ctx, sp)
+	if len(ads) != 3 || ads[0].ID != 1 || ads[1].ID != 2 {
+		t.Error("Expected all ads with location")
+	}
+
+	ads, _ = h.GetAds(ctx, &model.SearchParams{Limit: 15})
+	if len(ads) != 4 || ads[0].Distance != nil || *ads[0].Latitude != 55.9825 || ads[3].Latitude != nil {
+		t.Error("Expected location without distance")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	h.AddCategory(&model.Category{Slug: "repair", Name: "Repair"})
+	h.AddCategory(&model.Category{Slug: "plumbing", Name: "Plumbing", ParentID: zero.IntFrom(1)})
+	h.AddCategory(&model.Category{Slug: "boilers", Name: "Boilers", ParentID: zero.IntFrom(2)})
+	h.AddCategory(&model.Category{Slug: "roofs", Name: "Roofs"})
+
+	if _, err := h.AddCategory(&model.Category{Slug: "repair", Name: "Repair"}); err == nil {
+		t.Error("Expected error of unique slug")
+	}
+	if _, err := h.AddCategory(&model.Category{Slug: "pipes", Name: "Pipes", ParentID: zero.IntFrom(10)}); err == nil {
+		t.Error("Expected error of parent")
+	}
+	categories, _ := h.GetCategories(ctx)
+	if len(categories) != 4 || categories[2].Slug != "boilers" || categories[2].ParentID.Int64 != 2 {
+		t.Error("Unexpected categories", len(categories))
+	}
+
+	h.NewAd(ctx, &model.AdItem{Title: "Boiler", UserID: 1, CategoryID: zero.IntFrom(3)})
+	h.NewAd(ctx, &model.AdItem{Title: "Pipes", UserID: 1, CategoryID: zero.IntFrom(2)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, CategoryID: zero.IntFrom(4)})
+	h.NewAd(ctx, &model.AdItem{Title: "Anything", UserID: 1})
+	if _, err := h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, CategoryID: zero.IntFrom(10)}); err == nil {
+		t.Error("Expected error of category")
+	}
+
+	for _, c := range []struct {
+		slug string
+		ids  []int64
+	}{
+		{"repair", []int64{1, 2}},
+		{"plumbing", []int64{1, 2}},
+		{"boilers", []int64{1}},
+		{"roofs", []int64{3}},
+		{"unknown", []int64{}},
+	} {
+		ads, _ := h.GetAds(ctx, &model.SearchParams{Limit: 15, Category: c.slug})
+		if len(ads) != len(c.ids) {
+			t.Error("Expected", len(c.ids), "ads of", c.slug, "got", len(ads))
+			continue
+		}
+		for i, ad := range ads {
+			if ad.ID != c.ids[i] {
+				t.Error("Unexpected ad", ad.ID, "of", c.slug)
+			}
+		}
+	}
+
+	h.EditAd(ctx, &model.AdItem{ID: 4, Title: "Anything", CategoryID: zero.IntFrom(4)})
+	if count, _ := h.CountAds(ctx, &model.SearchParams{Category: "roofs"}); count != 2 {
+		t.Error("Expected 2 ads got", count)
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	h.NewAd(ctx, &model.AdItem{Title: "Монтаж котла", UserID: 1, City: "Москва"})
+	h.NewAd(ctx, &model.AdItem{Title: "монтаж котла", UserID: 1, City: "Москва", SubwayStation: zero.StringFrom("Мякинино")})
+	h.NewAd(ctx, &model.AdItem{Title: "Монтаж крыши", UserID: 1, City: "Тверь"})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof 100%", UserID: 1, City: "Moscow"})
+
+	suggestions, _ := h.GetSuggestions(ctx, "мо", 10)
+	if len(suggestions) != 3 {
+		t.Fatal("Expected 3 suggestions got", len(suggestions))
+	}
+	// suggestions with equal count are ordered by text
+	if s := suggestions[0]; s.Text != "Монтаж котла" || s.Kind != model.SuggestTitle || s.Count != 2 {
+		t.Error("Unexpected suggestion", *s)
+	}
+	if s := suggestions[1]; s.Text != "Москва" || s.Kind != model.SuggestCity || s.Count != 2 {
+		t.Error("Unexpected suggestion", *s)
+	}
+	if suggestions, _ = h.GetSuggestions(ctx, "м", 2); len(suggestions) != 2 {
+		t.Error("Expected limit of suggestions")
+	}
+	if suggestions, _ = h.GetSuggestions(ctx, "мяк", 10); len(suggestions) != 1 ||
+		suggestions[0].Kind != model.SuggestSubwayStation {
+		t.Error("Expected suggestion of subway station")
+	}
+	if suggestions, _ = h.GetSuggestions(ctx, "roof 100%", 10); len(suggestions) != 1 {
+		t.Error("Expected suggestion with percent sign")
+	}
+}
+
+func TestFacets(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Country: zero.StringFrom("Russia"), Price: zero.IntFrom(500)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "moscow", Price: zero.IntFrom(1000)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Kazan", Price: zero.IntFrom(4999)})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof", UserID: 1, City: "Moscow", Price: zero.IntFrom(200000),
+		SubwayStation: zero.StringFrom("Arbatskaya")})
+	h.NewAd(ctx, &model.AdItem{Title: "Boiler", UserID: 1, City: "Kazan"})
+
+	facets, _ := h.GetFacets(ctx, &model.SearchParams{Query: "roof", Limit: 1})
+	if len(facets.Cities) != 2 || facets.Cities[0].Value != "Moscow" || facets.Cities[0].Count != 3 ||
+		facets.Cities[1].Value != "Kazan" || facets.Cities[1].Count != 1 {
+		t.Error("Unexpected facets of cities", facets.Cities)
+	}
+	if len(facets.Countries) != 1 || facets.Countries[0].Count != 1 {
+		t.Error("Unexpected facets of countries", facets.Countries)
+	}
+	if len(facets.SubwayStations) != 1 || facets.SubwayStations[0].Value != "Arbatskaya" {
+		t.Error("Unexpected facets of subway stations", facets.SubwayStations)
+	}
+	prices := facets.Prices
+	if len(prices) != 3 || prices[0].Min != 0 || prices[0].Max != 1000 || prices[0].Count != 1 ||
+		prices[1].Min != 1000 || prices[1].Max != 5000 || prices[1].Count != 2 ||
+		prices[2].Min != 100000 || prices[2].Max != 0 || prices[2].Count != 1 {
+		t.Error("Unexpected facets of prices")
+	}
+
+	facets, _ = h.GetFacets(ctx, &model.SearchParams{City: "kazan"})
+	if len(facets.Cities) != 1 || facets.Cities[0].Count != 2 || len(facets.Prices) != 1 {
+		t.Error("Expected facets of filtered ads")
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	h.NewAd(ctx, &model.AdItem{Title: "Монтаж котла", UserID: 1, City: "Москва"})
+	h.NewAd(ctx, &model.AdItem{Title: "Ремонт крыши", UserID: 1, City: "Тверь"})
+	h.NewAd(ctx, &model.AdItem{Title: "Roof repair", UserID: 1, City: "Moscow"})
+
+	if ads, _ := h.GetAds(ctx, &model.SearchParams{Query: "котел", Limit: 10}); len(ads) != 0 {
+		t.Error("Expected no ads found exactly")
+	}
+	ads, _ := h.GetAds(ctx, &model.SearchParams{Query: "котел", Fuzzy: true, Limit: 10})
+	if len(ads) != 1 || ads[0].ID != 1 {
+		t.Fatal("Expected ad with similar title")
+	}
+	if ads[0].TitleSnippet != "" {
+		t.Error("Expected no snippets of fuzzy search")
+	}
+	if ads, _ = h.GetAds(ctx, &model.SearchParams{Query: "Масква", Fuzzy: true, Limit: 10}); len(ads) != 1 || ads[0].ID != 1 {
+		t.Error("Expected ad with similar city")
+	}
+	if count, _ := h.CountAds(ctx, &model.SearchParams{Query: "repiar", Fuzzy: true}); count != 1 {
+		t.Error("Expected 1 ad counted got", count)
+	}
+
+	words, _ := h.GetSimilarWords(ctx, "Котел", 3)
+	if len(words) != 1 || words[0] != "котла" {
+		t.Error("Unexpected similar words", words)
+	}
+	if words, _ = h.GetSimilarWords(ctx, "xyz", 3); len(words) != 0 {
+		t.Error("Expected no similar words got", words)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+
+	if err := h.NewToken(ctx, &model.Token{Hash: "a", UserID: 2, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)}); err == nil {
+		t.Error("Expected error for token of unknown user")
+	}
+
+	h.NewToken(ctx, &model.Token{Hash: "a", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if id, err := h.UseToken(ctx, "a", "other"); id != -1 || err != sql.ErrNoRows {
+		t.Error("Expected no token of other kind")
+	}
+	if id, _ := h.UseToken(ctx, "a", model.TokenVerifyEmail); id != 1 {
+		t.Error("Expected user of token got", id)
+	}
+	if id, _ := h.UseToken(ctx, "a", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected token can be used once")
+	}
+
+	// new token replaces previous one
+	h.NewToken(ctx, &model.Token{Hash: "b", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.NewToken(ctx, &model.Token{Hash: "c", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if id, _ := h.UseToken(ctx, "b", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected replaced token can't be used")
+	}
+	h.NewToken(ctx, &model.Token{Hash: "d", UserID: 1, Kind: model.TokenVerifyEmail,
+		ExpirationTime: time.Now().Add(-time.Second)})
+	if id, _ := h.UseToken(ctx, "d", model.TokenVerifyEmail); id != -1 {
+		t.Error("Expected expired token can't be used")
+	}
+
+	// added tokens are kept
+	h.AddToken(ctx, &model.Token{Hash: "e", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.AddToken(ctx, &model.Token{Hash: "f", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	h.AddToken(ctx, &model.Token{Hash: "g", UserID: 1, Kind: model.TokenRefresh,
+		ExpirationTime: time.Now().Add(time.Hour)})
+	if id, _ := h.UseToken(ctx, "e", model.TokenRefresh); id != 1 {
+		t.Error("Expected added token can be used")
+	}
+	if n, _ := h.RemoveTokens(ctx, 1, model.TokenRefresh); n != 2 {
+		t.Error("Expected 2 tokens removed got", n)
+	}
+	if id, _ := h.UseToken(ctx, "f", model.TokenRefresh); id != -1 {
+		t.Error("Expected removed token can't be used")
+	}
+
+	if n, _ := h.VerifyEmail(ctx, 1); n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithID(ctx, 1); !u.EmailVerified {
+		t.Error("Expected verified email")
+	}
+	if n, _ := h.VerifyEmail(ctx, 2); n != 0 {
+		t.Error("Expected no users updated got", n)
+	}
+}
+
+func TestEditPassword(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com", Password: "old"})
+
+	if n, _ := h.EditPassword(ctx, 1, "new"); n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithEmail(ctx, "ivan@gmail.com"); u.Password != "new" {
+		t.Error("Expected new hash of password")
+	}
+	if n, _ := h.EditPassword(ctx, 2, "new"); n != 0 {
+		t.Error("Expected no users updated got", n)
+	}
+}
+
+func TestNewEmail(t *testing.T) {
+	ctx := context.Background()
+	h := memdb.New()
+	h.NewUser(ctx, &model.User{FirstName: "Ivan", LastName: "Ivanov", Email: "ivan@gmail.com"})
+	h.NewUser(ctx, &model.User{FirstName: "Petr", LastName: "Petrov", Email: "petr@gmail.com"})
+
+	if n, _ := h.ConfirmNewEmail(ctx, 1); n != 0 {
+		t.Error("Expected no new email got", n)
+	}
+
+	h.SetNewEmail(ctx, 1, "petr@gmail.com")
+	if n, err := h.ConfirmNewEmail(ctx, 1); n != -1 || err == nil {
+		t.Error("Expected error of not unique email")
+	}
+
+	h.SetNewEmail(ctx, 1, "ivanov@gmail.com")
+	if n, _ := h.ConfirmNewEmail(ctx, 1); n != 1 {
+		t.Error("Expected 1 user updated got", n)
+	}
+	if u, _ := h.GetUserWithID(ctx, 1); u.Email != "ivanov@gmail.com" || !u.EmailVerified {
+		t.Error("Expected new verified email", u.Email)
+	}
+	if n, _ := h.ConfirmNewEmail(ctx, 1); n != 0 {
+		t.Error("Expected new email can be confirmed once")
+	}
+	if n, _ := h.SetNewEmail(ctx, 3, "ivan@gmail.com"); n != 0 {
+		t.Error("Expected no users updated got", n)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"context"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// NewSavedSearch creates a new saved search if user has less than limit searches.
+func (h *Handler) NewSavedSearch(ctx context.Context, search *model.SavedSearch, limit int) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.users[search.UserID]; !ok {
+		return 0, errNoOwner
+	}
+	if len(h.readSearches(search.UserID)) >= limit {
+		return 0, nil
+	}
+
+	h.lastSearchID++
+	s := *search
+	s.ID = h.lastSearchID
+	s.CreationTime = time.Now()
+	s.CheckedTime = s.CreationTime
+	h.searches[s.ID] = &s
+
+	return s.ID, nil
+}
+
+// GetSavedSearches returns saved searches of user with such ID.
+func (h *Handler) GetSavedSearches(ctx context.Context, userID int64) ([]*model.SavedSearch, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.readSearches(userID), nil
+}
+
+// GetAllSavedSearches returns saved searches of all users.
+func (h *Handler) GetAllSavedSearches(ctx context.Context) ([]*model.SavedSearch, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.readSearches(0), nil
+}
+
+// RemoveSavedSearch deletes saved search with such ID if it's saved by such user.
+// Alerts of search are deleted too.
+func (h *Handler) RemoveSavedSearch(ctx context.Context, userID, searchID int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if search, ok := h.searches[searchID]; !ok || search.UserID != userID {
+		return 0, nil
+	}
+
+	delete(h.searches, searchID)
+	h.removeAlerts()
+
+	return 1, nil
+}
+
+// AddAlerts creates alerts of saved search about ads and sets checked
+// time of search. Ads which are already deleted are skipped. It returns
+// IDs of ads which had no alerts of this search before.
+func (h *Handler) AddAlerts(ctx context.Context, searchID int64, adIDs []int64, checked time.Time) ([]int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	search, ok := h.searches[searchID]
+	if !ok {
+		return nil, errNoSearch
+	}
+	search.CheckedTime = checked
+
+	alerted := make(map[int64]bool)
+	for _, alert := range h.alerts {
+		if alert.SearchID == searchID {
+			alerted[alert.AdID] = true
+		}
+	}
+
+	added := make([]int64, 0)
+	for _, id := range adIDs {
+		if _, ok := h.ads[id]; !ok || alerted[id] {
+			continue
+		}
+		alerted[id] = true
+
+		h.lastAlertID++
+		h.alerts[h.lastAlertID] = &model.Alert{
+			ID:           h.lastAlertID,
+			SearchID:     searchID,
+			AdID:         id,
+			CreationTime: time.Now(),
+		}
+		added = append(added, id)
+	}
+
+	return added, nil
+}
+
+// GetAlerts returns alerts of user from the newest one.
+func (h *Handler) GetAlerts(ctx context.Context, userID int64, limit, offset int) ([]*model.Alert, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	alerts := make([]*model.Alert, 0)
+	for id := h.lastAlertID; id > 0 && len(alerts) < offset+limit; id-- {
+		alert, ok := h.alerts[id]
+		if !ok {
+			continue
+		}
+		search := h.searches[alert.SearchID]
+		if search.UserID != userID {
+			continue
+		}
+
+		a := *alert
+		a.SearchName = search.Name
+		a.AdTitle = h.ads[a.AdID].Title
+		alerts = append(alerts, &a)
+	}
+	if offset < len(alerts) {
+		return alerts[offset:], nil
+	}
+
+	return alerts[:0], nil
+}
+
+// readSearches returns copies of saved searches of user with such ID
+// or of all users if ID is 0. Read lock must be held.
+func (h *Handler) readSearches(userID int64) []*model.SavedSearch {
+	searches := make([]*model.SavedSearch, 0)
+	for id := int64(1); id <= h.lastSearchID; id++ {
+		if search, ok := h.searches[id]; ok && (userID == 0 || search.UserID == userID) {
+			s := *search
+			searches = append(searches, &s)
+		}
+	}
+	return searches
+}
+
+// removeAlerts deletes alerts whose saved search or ad is deleted
+// like foreign keys of postgres do. Lock must be held.
+func (h *Handler) removeAlerts() {
+	for id, alert := range h.alerts {
+		_, searchOK := h.searches[alert.SearchID]
+		_, adOK := h.ads[alert.AdID]
+		if !searchOK || !adOK {
+			delete(h.alerts, id)
+		}
+	}
+}
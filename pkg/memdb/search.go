@@ -0,0 +1,342 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// weights of fields of ad are the same as default weights of ts_rank
+// for labels A, B and C used by full-text search of postgres
+const (
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+	placeWeight       = 0.2
+)
+
+// earthRadiusKm is a radius of the Earth used by earthdistance module of postgres
+const earthRadiusKm = 6378.168
+
+// matchAds returns ads matching search query and filters in chosen
+// order. Read lock must be held.
+func (h *Handler) matchAds(sp *model.SearchParams) []*model.AdItem {
+	ads := make([]*model.AdItem, 0)
+	if sp.IsFuzzy() {
+		ads = h.fuzzyAds(sp.Query)
+	} else if sp.Query != "" {
+		ads = h.searchAds(sp.Query)
+	} else {
+		for id := int64(1); id <= h.lastAdID; id++ {
+			if ad, ok := h.ads[id]; ok {
+				ads = append(ads, ad)
+			}
+		}
+	}
+	ads = filterAds(ads, sp)
+	if sp.Category != "" {
+		ads = h.filterCategory(ads, sp.Category)
+	}
+	if sp.IsGeo() {
+		for i, ad := range ads {
+			a := *ad
+			distance := distanceKm(sp, &a)
+			a.Distance = &distance
+			ads[i] = &a
+		}
+	}
+	sortAds(ads, sp.Sort, sp.Query != "")
+	return ads
+}
+
+// pageAfterCursor returns ads which follow cursor of sp in ads ordered by
+// time of creation. If sp.Backward is set it returns no more than sp.Limit
+// ads which precede cursor.
+func pageAfterCursor(ads []*model.AdItem, sp *model.SearchParams) []*model.AdItem {
+	// i is index of the first ad after cursor
+	i := sort.Search(len(ads), func(i int) bool {
+		after := ads[i].CreationTime.After(sp.CursorTime) ||
+			ads[i].CreationTime.Equal(sp.CursorTime) && ads[i].ID > sp.CursorID
+		if sp.Sort == model.SortNewest {
+			return !after && !(ads[i].CreationTime.Equal(sp.CursorTime) && ads[i].ID == sp.CursorID)
+		}
+		return after
+	})
+	if !sp.Backward {
+		return ads[i:]
+	}
+
+	// skip ad of cursor itself
+	j := i
+	if j > 0 && ads[j-1].ID == sp.CursorID && ads[j-1].CreationTime.Equal(sp.CursorTime) {
+		j--
+	}
+	if j > sp.Limit {
+		return ads[j-sp.Limit : j]
+	}
+	return ads[:j]
+}
+
+// searchAds returns copies of ads which contain all words of query in title,
+// description, city or subway station. Unlike postgres words aren't stemmed,
+// so they are matched as substrings ignoring case. Ads are ordered by rank and
+// have snippets with highlighted words. Read lock must be held.
+func (h *Handler) searchAds(query string) []*model.AdItem {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return make([]*model.AdItem, 0)
+	}
+
+	type result struct {
+		ad   *model.AdItem
+		rank float64
+	}
+	results := make([]result, 0)
+	for id := int64(1); id <= h.lastAdID; id++ {
+		ad, ok := h.ads[id]
+		if !ok {
+			continue
+		}
+		if rank, ok := rankAd(ad, words); ok {
+			a := *ad
+			a.TitleSnippet = highlight(a.Title, words)
+			a.DescriptionSnippet = highlight(a.Description, words)
+			results = append(results, result{ad: &a, rank: rank})
+		}
+	}
+
+	// ads with equal rank are left ordered by ID
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].rank > results[j].rank
+	})
+
+	ads := make([]*model.AdItem, 0, len(results))
+	for _, r := range results {
+		ads = append(ads, r.ad)
+	}
+	return ads
+}
+
+// fuzzyAds returns ads which title or city is similar to query by trigrams
+// like fuzzy search of db.Handler does. Ads are ordered by similarity and
+// have no snippets. Read lock must be held.
+func (h *Handler) fuzzyAds(query string) []*model.AdItem {
+	type result struct {
+		ad   *model.AdItem
+		rank float64
+	}
+	results := make([]result, 0)
+	for id := int64(1); id <= h.lastAdID; id++ {
+		ad, ok := h.ads[id]
+		if !ok {
+			continue
+		}
+		rank := math.Max(wordSimilarity(query, ad.Title), wordSimilarity(query, ad.City))
+		if rank >= model.FuzzyThreshold {
+			results = append(results, result{ad: ad, rank: rank})
+		}
+	}
+
+	// ads with equal rank are left ordered by ID
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].rank > results[j].rank
+	})
+
+	ads := make([]*model.AdItem, 0, len(results))
+	for _, r := range results {
+		ads = append(ads, r.ad)
+	}
+	return ads
+}
+
+// rankAd returns rank of ad and true if ad contains all words.
+func rankAd(ad *model.AdItem, words []string) (float64, bool) {
+	title := strings.ToLower(ad.Title)
+	description := strings.ToLower(ad.Description)
+	place := strings.ToLower(ad.City + " " + ad.SubwayStation.String)
+
+	rank := 0.0
+	for _, word := range words {
+		found := false
+		if strings.Contains(title, word) {
+			rank += titleWeight
+			found = true
+		}
+		if strings.Contains(description, word) {
+			rank += descriptionWeight
+			found = true
+		}
+		if strings.Contains(place, word) {
+			rank += placeWeight
+			found = true
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// highlight escapes text as HTML and wraps words found in it with <b> tags.
+func highlight(text string, words []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// positions of words in lower don't match text
+		return html.EscapeString(text)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		n := 0
+		for _, word := range words {
+			if len(word) > n && strings.HasPrefix(lower[i:], word) {
+				n = len(word)
+			}
+		}
+		if n > 0 {
+			b.WriteString("<b>" + html.EscapeString(text[i:i+n]) + "</b>")
+			i += n
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(html.EscapeString(text[i : i+size]))
+		i += size
+	}
+	return b.String()
+}
+
+// filterAds returns ads which match filters of sp.
+func filterAds(ads []*model.AdItem, sp *model.SearchParams) []*model.AdItem {
+	filtered := make([]*model.AdItem, 0, len(ads))
+	for _, ad := range ads {
+		if matchFilters(ad, sp) {
+			filtered = append(filtered, ad)
+		}
+	}
+	return filtered
+}
+
+// filterCategory returns ads of category with such slug
+// and its subcategories. Read lock must be held.
+func (h *Handler) filterCategory(ads []*model.AdItem, slug string) []*model.AdItem {
+	ids := make(map[int64]bool)
+	for _, c := range h.categories {
+		if c.Slug == slug {
+			ids[c.ID] = true
+		}
+	}
+	// categories are added after their parents, so
+	// one pass in order of IDs finds all descendants
+	for id := int64(1); id <= h.lastCategoryID; id++ {
+		if c, ok := h.categories[id]; ok && c.ParentID.Valid && ids[c.ParentID.Int64] {
+			ids[id] = true
+		}
+	}
+
+	filtered := make([]*model.AdItem, 0, len(ads))
+	for _, ad := range ads {
+		if ad.CategoryID.Valid && ids[ad.CategoryID.Int64] {
+			filtered = append(filtered, ad)
+		}
+	}
+	return filtered
+}
+
+// matchFilters checks ad like conditions built by db.Handler do. Ad without
+// price doesn't match filters of price like NULL in postgres.
+func matchFilters(ad *model.AdItem, sp *model.SearchParams) bool {
+	switch {
+	case sp.MinPrice > 0 && (!ad.Price.Valid || ad.Price.Int64 < sp.MinPrice):
+		return false
+	case sp.MaxPrice > 0 && (!ad.Price.Valid || ad.Price.Int64 > sp.MaxPrice):
+		return false
+	case sp.Country != "" && !strings.EqualFold(ad.Country.String, sp.Country):
+		return false
+	case sp.City != "" && !strings.EqualFold(ad.City, sp.City):
+		return false
+	case sp.SubwayStation != "" && !strings.EqualFold(ad.SubwayStation.String, sp.SubwayStation):
+		return false
+	case sp.OwnerID > 0 && ad.UserID != sp.OwnerID:
+		return false
+	case !sp.CreatedAfter.IsZero() && ad.CreationTime.Before(sp.CreatedAfter):
+		return false
+	case !sp.CreatedBefore.IsZero() && !ad.CreationTime.Before(sp.CreatedBefore):
+		return false
+	case sp.HasImages != nil && *sp.HasImages != (ad.AdImagesStr.String != ""):
+		return false
+	case sp.IsGeo() && (ad.Latitude == nil || distanceKm(sp, ad) > sp.RadiusKm):
+		return false
+	}
+	return true
+}
+
+// distanceKm returns great-circle distance in kilometres from point
+// of search to location of ad which must be set.
+func distanceKm(sp *model.SearchParams, ad *model.AdItem) float64 {
+	const rad = math.Pi / 180
+	lat1, lat2 := *sp.Latitude*rad, *ad.Latitude*rad
+	dLat, dLon := lat2-lat1, (*ad.Longitude-*sp.Longitude)*rad
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// validLocation checks location of ad like constraints of ads table do.
+func validLocation(ad *model.AdItem) bool {
+	if ad.Latitude == nil || ad.Longitude == nil {
+		return ad.Latitude == nil && ad.Longitude == nil
+	}
+	return math.Abs(*ad.Latitude) <= 90 && math.Abs(*ad.Longitude) <= 180
+}
+
+// sortAds sorts ads like orderBy of db.Handler does. Ads found by query
+// are left ordered by rank if order is relevance or isn't chosen.
+func sortAds(ads []*model.AdItem, order string, search bool) {
+	var less func(a, b *model.AdItem) bool
+	switch {
+	case order == model.SortNewest:
+		less = func(a, b *model.AdItem) bool {
+			if !a.CreationTime.Equal(b.CreationTime) {
+				return a.CreationTime.After(b.CreationTime)
+			}
+			return a.ID > b.ID
+		}
+	case order == model.SortPriceAsc || order == model.SortPriceDesc:
+		desc := order == model.SortPriceDesc
+		less = func(a, b *model.AdItem) bool {
+			if a.Price.Valid != b.Price.Valid {
+				return a.Price.Valid // ads without price are the last ones
+			}
+			if a.Price.Int64 != b.Price.Int64 {
+				return (a.Price.Int64 < b.Price.Int64) != desc
+			}
+			return a.ID < b.ID
+		}
+	case order == model.SortDistance:
+		less = func(a, b *model.AdItem) bool {
+			if a.Distance != nil && b.Distance != nil && *a.Distance != *b.Distance {
+				return *a.Distance < *b.Distance
+			}
+			return a.ID < b.ID
+		}
+	case search && (order == model.SortRelevance || order == ""):
+		return
+	default:
+		less = func(a, b *model.AdItem) bool {
+			if !a.CreationTime.Equal(b.CreationTime) {
+				return a.CreationTime.Before(b.CreationTime)
+			}
+			return a.ID < b.ID
+		}
+	}
+
+	sort.Slice(ads, func(i, j int) bool { return less(ads[i], ads[j]) })
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// GetSuggestions returns the most popular titles, cities and
+// subway stations of ads which start with prefix ignoring case.
+func (h *Handler) GetSuggestions(ctx context.Context, prefix string, limit int) ([]*model.Suggestion, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+	groups := make(map[model.Suggestion]*model.Suggestion)
+	add := func(text, kind string) {
+		key := model.Suggestion{Text: strings.ToLower(text), Kind: kind}
+		if !strings.HasPrefix(key.Text, prefix) {
+			return
+		}
+		s, ok := groups[key]
+		if !ok {
+			s = &model.Suggestion{Text: text, Kind: kind}
+			groups[key] = s
+		}
+		// text of suggestion is the least one like min() in postgres
+		if text < s.Text {
+			s.Text = text
+		}
+		s.Count++
+	}
+	for _, ad := range h.ads {
+		add(ad.Title, model.SuggestTitle)
+		if ad.City != "" {
+			add(ad.City, model.SuggestCity)
+		}
+		if ad.SubwayStation.String != "" {
+			add(ad.SubwayStation.String, model.SuggestSubwayStation)
+		}
+	}
+
+	suggestions := make([]*model.Suggestion, 0, len(groups))
+	for _, s := range groups {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Text != b.Text {
+			return a.Text < b.Text
+		}
+		return a.Kind < b.Kind
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	return suggestions, nil
+}
+
+// GetSimilarWords returns words of titles and cities of ads
+// which are the most similar to word.
+func (h *Handler) GetSimilarWords(ctx context.Context, word string, limit int) ([]string, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	word = strings.ToLower(word)
+	ranks := make(map[string]float64)
+	for _, ad := range h.ads {
+		for _, w := range words(ad.Title + " " + ad.City) {
+			if _, ok := ranks[w]; ok || utf8.RuneCountInString(w) < 3 {
+				continue
+			}
+			if rank := similarity(word, w); rank >= model.FuzzyThreshold {
+				ranks[w] = rank
+			}
+		}
+	}
+
+	similar := make([]string, 0, len(ranks))
+	for w := range ranks {
+		similar = append(similar, w)
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		if ranks[similar[i]] != ranks[similar[j]] {
+			return ranks[similar[i]] > ranks[similar[j]]
+		}
+		return similar[i] < similar[j]
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return similar, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// VerifyEmail marks email of user with such ID as verified.
+func (h *Handler) VerifyEmail(ctx context.Context, userID int64) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	u, ok := h.users[userID]
+	if !ok {
+		return 0, nil
+	}
+	u.EmailVerified = true
+
+	return 1, nil
+}
+
+// NewToken stores token. Other tokens of the same kind
+// of user and all expired tokens are removed.
+func (h *Handler) NewToken(ctx context.Context, token *model.Token) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.users[token.UserID]; !ok {
+		return errNoTokenOwner
+	}
+
+	now := time.Now()
+	for hash, t := range h.tokens {
+		if t.UserID == token.UserID && t.Kind == token.Kind || !t.ExpirationTime.After(now) {
+			delete(h.tokens, hash)
+		}
+	}
+	t := *token
+	h.tokens[t.Hash] = &t
+
+	return nil
+}
+
+// UseToken removes token of such kind with such hash
+// and returns ID of its user if token isn't expired.
+func (h *Handler) UseToken(ctx context.Context, hash, kind string) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.tokens[hash]
+	if !ok || t.Kind != kind || !t.ExpirationTime.After(time.Now()) {
+		return -1, sql.ErrNoRows
+	}
+	delete(h.tokens, hash)
+
+	return t.UserID, nil
+}
+
+// AddToken stores token. Other tokens of user are kept,
+// only expired tokens are removed.
+func (h *Handler) AddToken(ctx context.Context, token *model.Token) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.users[token.UserID]; !ok {
+		return errNoTokenOwner
+	}
+
+	now := time.Now()
+	for hash, t := range h.tokens {
+		if !t.ExpirationTime.After(now) {
+			delete(h.tokens, hash)
+		}
+	}
+	t := *token
+	h.tokens[t.Hash] = &t
+
+	return nil
+}
+
+// RemoveTokens removes all tokens of such kind of user with such ID.
+func (h *Handler) RemoveTokens(ctx context.Context, userID int64, kind string) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var affected int64
+	for hash, t := range h.tokens {
+		if t.UserID == userID && t.Kind == kind {
+			delete(h.tokens, hash)
+			affected++
+		}
+	}
+
+	return affected, nil
+}
+
+// removeTokens deletes tokens of users which don't exist.
+// Lock must be held.
+func (h *Handler) removeTokens() {
+	for hash, t := range h.tokens {
+		if _, ok := h.users[t.UserID]; !ok {
+			delete(h.tokens, hash)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package memdb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// words returns words of text in lower case. Like pg_trgm words
+// consist of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigrams returns trigrams of words of text in order of text like
+// pg_trgm does: every word is padded by two spaces before it and
+// one space after it.
+func trigrams(text string) []string {
+	trgs := make([]string, 0)
+	for _, word := range words(text) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			trgs = append(trgs, string(padded[i:i+3]))
+		}
+	}
+	return trgs
+}
+
+// jaccard returns number of common trigrams of a and b divided
+// by number of trigrams of both of them. Repeated trigrams
+// are counted once.
+func jaccard(a, b []string) float64 {
+	setA, setB := make(map[string]bool, len(a)), make(map[string]bool, len(b))
+	for _, trg := range a {
+		setA[trg] = true
+	}
+	common := 0
+	for _, trg := range b {
+		if setA[trg] && !setB[trg] {
+			common++
+		}
+		setB[trg] = true
+	}
+	if len(setA) == 0 || len(setB) == 0 {
+		return 0
+	}
+	return float64(common) / float64(len(setA)+len(setB)-common)
+}
+
+// similarity returns trigram similarity of a and b
+// like similarity() of pg_trgm.
+func similarity(a, b string) float64 {
+	return jaccard(trigrams(a), trigrams(b))
+}
+
+// wordSimilarity returns the greatest similarity of trigrams of query and
+// any continuous extent of trigrams of text like word_similarity() of pg_trgm.
+func wordSimilarity(query, text string) float64 {
+	q, t := trigrams(query), trigrams(text)
+	best := 0.0
+	for i := range t {
+		for j := i + 1; j <= len(t); j++ {
+			if s := jaccard(q, t[i:j]); s > best {
+				best = s
+			}
+		}
+	}
+	return best
+}
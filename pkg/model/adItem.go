@@ -24,6 +24,22 @@ type AdItem struct {
 	User          `json:"owner_ad" schema:"-" valid:"-"`
 	Description   string    `db:"description_ad" json:"description_ad" schema:"description_ad,optional" valid:",optional"` // requiered in DB
 	CreationTime  time.Time `db:"creation_time" json:"creation_time" schema:"-" valid:"-"`
+
+	// location of ad is optional, but latitude and longitude are set together;
+	// pointers are used because zero is a valid coordinate
+	Latitude  *float64 `db:"latitude" json:"latitude,omitempty" schema:"latitude,optional" valid:"-"`
+	Longitude *float64 `db:"longitude" json:"longitude,omitempty" schema:"longitude,optional" valid:"-"`
+
+	// category of ad is optional
+	CategoryID zero.Int `db:"category_id" json:"category_id,omitempty" schema:"category_id,optional" valid:"-"`
+
+	// distance in kilometres from point of search in radius
+	Distance *float64 `db:"distance" json:"distance_km,omitempty" schema:"-" valid:"-"`
+
+	// snippets of title and description with words of search query
+	// highlighted by <b> tags; they are set only by search
+	TitleSnippet       string `db:"title_snippet" json:"title_snippet,omitempty" schema:"-" valid:"-"`
+	DescriptionSnippet string `db:"description_snippet" json:"description_snippet,omitempty" schema:"-" valid:"-"`
 }
 
 // TODO country, city, subway station should be UTF letters with some characters
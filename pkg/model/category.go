@@ -0,0 +1,19 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"gopkg.in/guregu/null.v3/zero"
+)
+
+// Category describes category of ads. Categories form a tree: category
+// without parent is a root one. Slug is unique and used in URLs.
+type Category struct {
+	ID       int64       `db:"id" json:"id"`
+	ParentID zero.Int    `db:"parent_id" json:"parent_id,omitempty"`
+	Slug     string      `db:"slug" json:"slug"`
+	Name     string      `db:"name" json:"name"`
+	Children []*Category `db:"-" json:"children,omitempty"` // set only in tree of categories
+}
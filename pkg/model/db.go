@@ -4,18 +4,68 @@
 
 package model
 
+import (
+	"context"
+	"time"
+)
+
 // DB describes interface of database needed by API
-// to communicate with it
+// to communicate with it. Operations are cancelled when
+// context is done.
 type DB interface {
-	GetAd(adID int64) (*AdItem, error)
-	GetAds(sp *SearchParams) ([]*AdItem, error)
-	GetAdsOfUser(userID int64) ([]*AdItem, error)
-	GetUserWithID(userID int64) (*User, error)
-	GetUserWithEmail(email string) (*User, error)
-	NewUser(user *User) (int64, error)
-	NewAd(ad *AdItem) (int64, error)
-	EditUser(user *User) (int64, error)
-	EditAd(ad *AdItem) (int64, error)
-	RemoveUser(userID int64) (int64, error)
-	RemoveAd(adID int64) (int64, error)
+	GetAd(ctx context.Context, adID int64) (*AdItem, error)
+	// GetAds and GetAdsOfUser order ads by one of Sort constants;
+	// empty sort means default order.
+	GetAds(ctx context.Context, sp *SearchParams) ([]*AdItem, error)
+	// CountAds ignores limit, offset and cursor of sp.
+	CountAds(ctx context.Context, sp *SearchParams) (int64, error)
+	GetFacets(ctx context.Context, sp *SearchParams) (*Facets, error)
+	GetAdsOfUser(ctx context.Context, userID int64, sort string) ([]*AdItem, error)
+	GetUserWithID(ctx context.Context, userID int64) (*User, error)
+	GetUserWithEmail(ctx context.Context, email string) (*User, error)
+	NewUser(ctx context.Context, user *User) (int64, error)
+	NewAd(ctx context.Context, ad *AdItem) (int64, error)
+	EditUser(ctx context.Context, user *User) (int64, error)
+	EditPassword(ctx context.Context, userID int64, hash string) (int64, error)
+	// SetNewEmail stores email which replaces email of user after
+	// confirmation; email of user and its verification aren't changed.
+	SetNewEmail(ctx context.Context, userID int64, email string) (int64, error)
+	// ConfirmNewEmail replaces email of user by new one and marks it as
+	// verified. It returns -1 if new email isn't unique anymore and 0 if
+	// user has no new email.
+	ConfirmNewEmail(ctx context.Context, userID int64) (int64, error)
+	EditAd(ctx context.Context, ad *AdItem) (int64, error)
+	RemoveUser(ctx context.Context, userID int64) (int64, error)
+	RemoveAd(ctx context.Context, adID int64) (int64, error)
+	VerifyEmail(ctx context.Context, userID int64) (int64, error)
+	// NewToken removes other tokens of the same kind of user.
+	NewToken(ctx context.Context, token *Token) error
+	// UseToken removes token which isn't expired and returns ID of
+	// its user; ID is -1 if there is no such token.
+	UseToken(ctx context.Context, hash, kind string) (int64, error)
+	// AddToken keeps other tokens of user.
+	AddToken(ctx context.Context, token *Token) error
+	RemoveTokens(ctx context.Context, userID int64, kind string) (int64, error)
+	// GetSuggestions returns titles, cities and subway stations of ads
+	// which start with prefix ignoring case; prefix has no wildcards.
+	GetSuggestions(ctx context.Context, prefix string, limit int) ([]*Suggestion, error)
+	// GetSimilarWords returns words of titles and cities of ads which
+	// are the most similar to word.
+	GetSimilarWords(ctx context.Context, word string, limit int) ([]string, error)
+	// GetCategories doesn't set Children of categories.
+	GetCategories(ctx context.Context) ([]*Category, error)
+	// NewSavedSearch returns 0 if user already has limit searches.
+	NewSavedSearch(ctx context.Context, search *SavedSearch, limit int) (int64, error)
+	GetSavedSearches(ctx context.Context, userID int64) ([]*SavedSearch, error)
+	GetAllSavedSearches(ctx context.Context) ([]*SavedSearch, error)
+	RemoveSavedSearch(ctx context.Context, userID, searchID int64) (int64, error)
+	// AddAlerts sets checked time of search and returns IDs of ads
+	// which had no alerts of this search before.
+	AddAlerts(ctx context.Context, searchID int64, adIDs []int64, checked time.Time) ([]int64, error)
+	GetAlerts(ctx context.Context, userID int64, limit, offset int) ([]*Alert, error)
+	// GetImages returns addresses of images referenced by ads and users.
+	GetImages(ctx context.Context) ([]string, error)
+	// WithTx commits transaction if fn returns nil and rolls it back
+	// otherwise; tx must be used only inside of fn.
+	WithTx(ctx context.Context, fn func(tx DB) error) error
 }
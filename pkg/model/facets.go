@@ -0,0 +1,50 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+// PriceBuckets are bounds of price buckets of facets in ascending order.
+// Bucket includes its lower bound and excludes the upper one; the first
+// bucket has no lower bound and the last one has no upper bound.
+var PriceBuckets = []int64{1000, 5000, 10000, 50000, 100000}
+
+// MaxFacetValues is a maximal number of values of one field in facets.
+const MaxFacetValues = 20
+
+// Facets are numbers of ads matching search parameters grouped by values
+// of fields. Values which differ only in case are one value. Values with
+// greater number of ads go first; empty buckets of price are skipped.
+type Facets struct {
+	Countries      []*FacetValue  `json:"countries"`
+	Cities         []*FacetValue  `json:"cities"`
+	SubwayStations []*FacetValue  `json:"subway_stations"`
+	Prices         []*PriceBucket `json:"prices"`
+}
+
+// FacetValue is a number of ads with such value of field.
+type FacetValue struct {
+	Value string `db:"value" json:"value"`
+	Count int64  `db:"count" json:"count"`
+}
+
+// PriceBucket is a number of ads with price from Min to Max.
+// Zero bound means that bucket is unbounded in this direction.
+type PriceBucket struct {
+	Min   int64 `json:"min,omitempty"`
+	Max   int64 `json:"max,omitempty"`
+	Count int64 `json:"count"`
+}
+
+// NewPriceBucket returns bucket with such index in PriceBuckets.
+// Bucket with index i is below bound i.
+func NewPriceBucket(i int) *PriceBucket {
+	b := &PriceBucket{}
+	if i > 0 {
+		b.Min = PriceBuckets[i-1]
+	}
+	if i < len(PriceBuckets) {
+		b.Max = PriceBuckets[i]
+	}
+	return b
+}
@@ -1,17 +1,43 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"io"
+	"time"
 )
 
 // Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
 // Use of this source code is governed by GNU LGPL
 // license that can be found in the LICENSE file.
 
-// IM interface describes interface for interaction with amazon s3
+// IM interface describes interface for interaction with amazon s3.
+// PresignUpload returns URL where client can upload image with
+// such key by method PUT until URL expires.
 type IM interface {
-	IsExist(key string) bool
-	UploadImage(key string, body io.Reader) (string, error)
-	DeleteImage(key string) error
-	DownloadImage(key string) error
+	IsExist(ctx context.Context, key string) bool
+	UploadImage(ctx context.Context, key string, body io.Reader) (string, error)
+	DeleteImage(ctx context.Context, key string) error
+	ReadImage(ctx context.Context, key string, offset int64) (*Image, error)
+	ListImages(ctx context.Context) ([]*ImageInfo, error)
+	PresignUpload(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// ErrNoImage is returned by ReadImage if there is no such image.
+var ErrNoImage = errors.New("No such image")
+
+// Image is a stream of stored image. Body starts at offset passed to
+// ReadImage and must be closed. Size is a size of the whole image.
+type Image struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// ImageInfo describes image stored by IM. Key is a path of image
+// (i.e. /images/name.png) and LastModified is time of its uploading.
+type ImageInfo struct {
+	Key          string
+	LastModified time.Time
 }
@@ -0,0 +1,19 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+import "context"
+
+// Mailer describes interface of service which sends emails to users.
+type Mailer interface {
+	SendMail(ctx context.Context, mail *Mail) error
+}
+
+// Mail is a plain text email. Sender is chosen by Mailer.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
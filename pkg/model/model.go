@@ -25,6 +25,7 @@ Characteristics:
 	first name            first name of user
 	last name	            last name of user
 	email                 email of user that must be unique
+	email verified        true if user confirmed his email by token sent to it
 	password              password of user that stored in database in hashed state
 	telephone number      telephone number of user
 	about                 some additional information about user
@@ -44,20 +45,22 @@ Characteristics:
 */
 package model
 
-// Model is a struct that contains DB, IM and SM interfaces. Such project model allows
+// Model is a struct that contains DB, IM, SM and Mailer interfaces. Such project model allows
 // to use different database and session manager implementation without changing business-logic.
 // Model is used by API handlers.
 type Model struct {
 	DB
 	SM
 	IM
+	Mailer
 }
 
-// New creates Model structure from object that implements DB and SM interfaces.
-func New(db DB, sm SM, im IM) *Model {
+// New creates Model structure from object that implements DB, SM, IM and Mailer interfaces.
+func New(db DB, sm SM, im IM, mailer Mailer) *Model {
 	return &Model{
-		DB: db,
-		SM: sm,
-		IM: im,
+		DB:     db,
+		SM:     sm,
+		IM:     im,
+		Mailer: mailer,
 	}
 }
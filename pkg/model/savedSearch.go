@@ -0,0 +1,33 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"time"
+)
+
+// SavedSearch is a search of ads saved by user. Ads which match Params and
+// are created after CheckedTime are new for this search: they are found
+// periodically and recorded as alerts. Limit, offset, sort and cursor
+// of Params aren't used then.
+type SavedSearch struct {
+	ID           int64        `db:"id" json:"id"`
+	UserID       int64        `db:"owner_id" json:"-"`
+	Name         string       `db:"name" json:"name"`
+	Params       SearchParams `db:"-" json:"params"`
+	ParamsStr    string       `db:"params" json:"-"` // for database
+	CreationTime time.Time    `db:"creation_time" json:"creation_time"`
+	CheckedTime  time.Time    `db:"checked_time" json:"checked_time"`
+}
+
+// Alert tells owner of saved search that ad matching this search was created.
+type Alert struct {
+	ID           int64     `db:"id" json:"id"`
+	SearchID     int64     `db:"search_id" json:"search_id"`
+	SearchName   string    `db:"search_name" json:"search_name"`
+	AdID         int64     `db:"ad_id" json:"ad_id"`
+	AdTitle      string    `db:"ad_title" json:"ad_title"`
+	CreationTime time.Time `db:"creation_time" json:"creation_time"`
+}
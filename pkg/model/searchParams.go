@@ -4,9 +4,79 @@
 
 package model
 
+import (
+	"time"
+)
+
+// sort orders of ads. Ads with equal values are ordered by ID; ads without
+// price are the last ones in both orders by price. SortRelevance can be used
+// only with search query and SortDistance only with search in radius.
+// By default ads found by query are ordered by relevance and other ads
+// are ordered like SortOldest.
+const (
+	SortNewest    = "newest"
+	SortOldest    = "oldest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortRelevance = "relevance"
+	SortDistance  = "distance"
+)
+
+// FuzzyThreshold is a minimal trigram similarity of query and title or city
+// of ad found by fuzzy search and of word and its correction.
+const FuzzyThreshold = 0.3
+
 // SearchParams is a struct that has information about filtering ads for client.
+// Filters with zero value are not applied. Country, city and subway station are
+// compared ignoring case. HasImages chooses ads with or without images if set.
+// Category is a slug of category; ads of its subcategories are chosen too.
+//
+// Latitude, Longitude and RadiusKm choose ads located in circle with such
+// center and radius in kilometres. Ads without location aren't chosen then.
+//
+// CursorTime and CursorID are used for keyset pagination instead of Offset if
+// CursorID is positive. Then ads which follow ad with such time of creation and
+// ID are returned (or ads which precede it if Backward is set). Cursor can be
+// used only with orders by time of creation, that is SortOldest, SortNewest
+// or default order of ads without query.
+//
+// If Fuzzy is set then ads are searched by trigram similarity of query with
+// title or city instead of full-text search, so misspelled words are found.
+//
+// SearchParams is stored in JSON by saved searches.
 type SearchParams struct {
-	Query  string `db:"query" schema:"query,optional"`
-	Limit  int    `db:"limit" schema:"limit,optional"`
-	Offset int    `db:"offset" schema:"offset,optional"`
+	Query  string `db:"query" json:"query,omitempty" schema:"query,optional"`
+	Limit  int    `db:"limit" json:"limit,omitempty" schema:"limit,optional"`
+	Offset int    `db:"offset" json:"offset,omitempty" schema:"offset,optional"`
+	Sort   string `db:"-" json:"sort,omitempty" schema:"sort,optional"`
+	Fuzzy  bool   `db:"-" json:"fuzzy,omitempty" schema:"fuzzy,optional"`
+
+	MinPrice      int64     `db:"min_price" json:"min_price,omitempty" schema:"min_price,optional"`
+	MaxPrice      int64     `db:"max_price" json:"max_price,omitempty" schema:"max_price,optional"`
+	Country       string    `db:"country" json:"country,omitempty" schema:"country,optional"`
+	City          string    `db:"city" json:"city,omitempty" schema:"city,optional"`
+	SubwayStation string    `db:"subway_station" json:"subway_station,omitempty" schema:"subway_station,optional"`
+	OwnerID       int64     `db:"owner_id" json:"owner_id,omitempty" schema:"owner_id,optional"`
+	CreatedAfter  time.Time `db:"created_after" json:"created_after,omitempty" schema:"created_after,optional"`
+	CreatedBefore time.Time `db:"created_before" json:"created_before,omitempty" schema:"created_before,optional"`
+	HasImages     *bool     `db:"has_images" json:"has_images,omitempty" schema:"has_images,optional"`
+	Category      string    `db:"category" json:"category,omitempty" schema:"category,optional"`
+
+	Latitude  *float64 `db:"latitude" json:"lat,omitempty" schema:"lat,optional"`
+	Longitude *float64 `db:"longitude" json:"lon,omitempty" schema:"lon,optional"`
+	RadiusKm  float64  `db:"radius_km" json:"radius_km,omitempty" schema:"radius_km,optional"`
+
+	CursorTime time.Time `db:"cursor_time" json:"-" schema:"-"`
+	CursorID   int64     `db:"cursor_id" json:"-" schema:"-"`
+	Backward   bool      `db:"-" json:"-" schema:"-"`
+}
+
+// IsGeo checks if ads are searched in radius.
+func (sp *SearchParams) IsGeo() bool {
+	return sp.Latitude != nil && sp.Longitude != nil && sp.RadiusKm > 0
+}
+
+// IsFuzzy checks if ads are searched by query in fuzzy mode.
+func (sp *SearchParams) IsFuzzy() bool {
+	return sp.Query != "" && sp.Fuzzy
 }
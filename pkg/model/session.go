@@ -4,14 +4,25 @@
 
 package model
 
-// Session is object which represents session data
+import "time"
+
+// Session is object which represents session data. IP is address of client
+// which created session. LastSeen is time of the last check of session; it can
+// be updated with delay. Hash is hash of tocken of session which identifies
+// session in list of sessions of user without revealing its tocken.
 type Session struct {
-	ID        int64
-	Login     string
-	UserAgent string
+	ID           int64
+	Login        string
+	UserAgent    string
+	IP           string
+	CreationTime time.Time
+	LastSeen     time.Time
+	Hash         string
 }
 
-// SessionID is used as identificator of user's session
+// SessionID is used as identificator of user's session. Expires is set
+// by CreateSession; it's zero if session never expires.
 type SessionID struct {
-	ID string
+	ID      string
+	Expires time.Time
 }
@@ -4,12 +4,22 @@
 
 package model
 
+import "context"
+
 // SM describes interface of session manager.
+//
+// Sessions of user are indexed by user ID. GetUserSessions returns sessions
+// of user from the newest one. DeleteUserSession deletes session of user
+// by hash of its tocken; it returns 0 if user has no such session.
+// DeleteUserSessions deletes all sessions of user with such ID except
+// session except; except can be nil.
 type SM interface {
-	CreateSession(in *Session, expires bool) (*SessionID, error)
-	CheckSession(in *SessionID) (*Session, error)
-	DeleteSession(in *SessionID) error
+	CreateSession(ctx context.Context, in *Session, expires bool) (*SessionID, error)
+	CheckSession(ctx context.Context, in *SessionID) (*Session, error)
+	DeleteSession(ctx context.Context, in *SessionID) error
+	GetUserSessions(ctx context.Context, userID int64) ([]*Session, error)
+	DeleteUserSession(ctx context.Context, userID int64, hash string) (int64, error)
+	DeleteUserSessions(ctx context.Context, userID int64, except *SessionID) error
 
-	TryReconnect() error
-	IsConnected() bool
+	IsConnected(ctx context.Context) bool
 }
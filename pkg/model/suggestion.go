@@ -0,0 +1,21 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+// kinds of suggestions: which field of ads has text of suggestion
+const (
+	SuggestTitle         = "title"
+	SuggestCity          = "city"
+	SuggestSubwayStation = "subway_station"
+)
+
+// Suggestion is a completion of text typed by user. Texts which differ only
+// in case are one suggestion. Count is a number of ads with such text; more
+// popular suggestions go first.
+type Suggestion struct {
+	Text  string `db:"text" json:"text"`
+	Kind  string `db:"kind" json:"kind"`
+	Count int64  `db:"count" json:"count"`
+}
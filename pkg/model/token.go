@@ -0,0 +1,56 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// kinds of tokens
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	TokenChangeEmail   = "change_email"
+	TokenRefresh       = "refresh"
+)
+
+// tokenLength is a number of random bytes of token
+const tokenLength = 32
+
+// Token is a single-use secret which is sent to user by email to confirm
+// an action of such kind. Only hash of token is stored, so token can't be
+// taken from database. Token can be used until its expiration time.
+type Token struct {
+	Hash           string    `db:"token_hash"`
+	UserID         int64     `db:"user_id"`
+	Kind           string    `db:"kind"`
+	ExpirationTime time.Time `db:"expiration_time"`
+}
+
+// NewToken generates token of such kind for user which expires after ttl.
+// It returns token which must be sent to user and its stored part.
+func NewToken(userID int64, kind string, ttl time.Duration) (string, *Token, error) {
+	b := make([]byte, tokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(b)
+
+	return token, &Token{
+		Hash:           HashToken(token),
+		UserID:         userID,
+		Kind:           kind,
+		ExpirationTime: time.Now().Add(ttl),
+	}, nil
+}
+
+// HashToken returns hash of token which is stored in database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
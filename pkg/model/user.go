@@ -21,6 +21,7 @@ type User struct {
 	About         zero.String `db:"about" json:"about,omitempty" schema:"about,optional" valid:"-"`                       // consists of ASCII
 	AvatarAddress zero.String `db:"avatar_address" json:"avatar_address,omitempty" schema:"avatar_address,optional" valid:"-"`
 	RegTime       time.Time   `db:"reg_time" json:"reg_time" schema:"-" valid:"-"`
+	EmailVerified bool        `db:"email_verified" json:"email_verified" schema:"-" valid:"-"`
 }
 
 // TODO about should be valid UTF-8
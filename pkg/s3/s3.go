@@ -11,25 +11,33 @@ s3 uses AWS simple storage service to store images.
 package s3
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
 )
 
 // Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
 // Use of this source code is governed by GNU LGPL
 // license that can be found in the LICENSE file.
 
-// Config is config for AWS S3 image manager
+// Config is config for AWS S3 image manager. Endpoint is address
+// of S3-compatible storage, AWS is used if it's empty.
 type Config struct {
-	Bucket string `json:"Bucket"`
-	ACL    string `json:"ACL"`
-	Region string `json:"Region"`
+	Bucket   string `json:"Bucket"`
+	ACL      string `json:"ACL"`
+	Region   string `json:"Region"`
+	Endpoint string `json:"Endpoint"`
 }
 
 // S3 is a struct that implements model.IM interface
@@ -46,9 +54,14 @@ func InitS3(cfg Config) (*S3, error) {
 		return nil, errors.New("No required environment variables setted")
 	}
 
-	sess, err := session.NewSession(&aws.Config{
+	awsCfg := &aws.Config{
 		Region: aws.String(cfg.Region),
-	})
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+		awsCfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(awsCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -64,12 +77,11 @@ func InitS3(cfg Config) (*S3, error) {
 }
 
 // IsExist checks if such key exists in the bucket
-func (s *S3) IsExist(key string) bool {
+func (s *S3) IsExist(ctx context.Context, key string) bool {
 	svc := s3.New(s.sess)
-	_, err := svc.GetObject(&s3.GetObjectInput{
+	_, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-		Range:  aws.String("bytes=0-1"),
 	})
 
 	if err != nil {
@@ -79,9 +91,9 @@ func (s *S3) IsExist(key string) bool {
 }
 
 // UploadImage uploads body as key
-func (s *S3) UploadImage(key string, body io.Reader) (string, error) {
+func (s *S3) UploadImage(ctx context.Context, key string, body io.Reader) (string, error) {
 	uploader := s3manager.NewUploader(s.sess)
-	output, err := uploader.Upload(&s3manager.UploadInput{
+	output, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 		Body:   body,
@@ -93,15 +105,27 @@ func (s *S3) UploadImage(key string, body io.Reader) (string, error) {
 	return output.Location, nil
 }
 
+// PresignUpload returns presigned URL for uploading of such key
+func (s *S3) PresignUpload(ctx context.Context, key string, expires time.Duration) (string, error) {
+	svc := s3.New(s.sess)
+	req, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		ACL:    aws.String(s.acl),
+	})
+	req.SetContext(ctx)
+	return req.Presign(expires)
+}
+
 // DeleteImage deletes such key from the bucket
-func (s *S3) DeleteImage(key string) error {
+func (s *S3) DeleteImage(ctx context.Context, key string) error {
 	svc := s3.New(s.sess)
-	_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
 	if err != nil {
 		return err
 	}
 
-	err = svc.WaitUntilObjectNotExists(&s3.HeadObjectInput{
+	err = svc.WaitUntilObjectNotExistsWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -109,15 +133,53 @@ func (s *S3) DeleteImage(key string) error {
 	return err
 }
 
-// DownloadImage downloads image from AWS
-func (s *S3) DownloadImage(key string) error {
-	downloader := s3manager.NewDownloader(s.sess)
-	file, _ := os.Create("." + key)
-	defer file.Close()
-	_, err := downloader.Download(file,
-		&s3.GetObjectInput{
-			Bucket: aws.String(s.bucket),
-			Key:    aws.String(key),
-		})
-	return err
+// ListImages returns all images from the bucket. SDK removes leading slash
+// from keys of uploaded images, so it's added back to match addresses of
+// images in database.
+func (s *S3) ListImages(ctx context.Context) ([]*model.ImageInfo, error) {
+	svc := s3.New(s.sess)
+	images := make([]*model.ImageInfo, 0)
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String("images/"),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			images = append(images, &model.ImageInfo{
+				Key:          "/" + aws.StringValue(object.Key),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// ReadImage returns stream of image from AWS starting at offset
+func (s *S3) ReadImage(ctx context.Context, key string, offset int64) (*model.Image, error) {
+	svc := s3.New(s.sess)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if offset > 0 {
+		input.Range = aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-")
+	}
+
+	output, err := svc.GetObjectWithContext(ctx, input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, model.ErrNoImage
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Image{
+		Body:        output.Body,
+		Size:        aws.Int64Value(output.ContentLength) + offset,
+		ContentType: aws.StringValue(output.ContentType),
+		ModTime:     aws.TimeValue(output.LastModified),
+	}, nil
 }
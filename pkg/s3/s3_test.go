@@ -0,0 +1,68 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package s3_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"bmstu.codes/developers34/SBWeb/pkg/s3"
+)
+
+func TestListImages(t *testing.T) {
+	// S3 stores uploaded "/images/a.png" with key "images/a.png"
+	var prefix string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix = r.URL.Query().Get("prefix")
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+	<Name>bucket</Name>
+	<Prefix>images/</Prefix>
+	<KeyCount>2</KeyCount>
+	<IsTruncated>false</IsTruncated>
+	<Contents>
+		<Key>images/a.png</Key>
+		<LastModified>2018-05-01T12:00:00.000Z</LastModified>
+	</Contents>
+	<Contents>
+		<Key>images/b/c.jpg</Key>
+		<LastModified>2018-05-02T12:00:00.000Z</LastModified>
+	</Contents>
+</ListBucketResult>`))
+	}))
+	defer srv.Close()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "id")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	im, err := s3.InitS3(s3.Config{
+		Bucket:   "bucket",
+		Region:   "us-east-1",
+		Endpoint: srv.URL,
+	})
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+
+	images, err := im.ListImages(context.Background())
+	if err != nil {
+		t.Fatal("Unexpected error", err.Error())
+	}
+	if prefix != "images/" {
+		t.Error("Expected prefix images/ got", prefix)
+	}
+	if len(images) != 2 || images[0].Key != "/images/a.png" || images[1].Key != "/images/b/c.jpg" {
+		t.Error("Expected keys of images like addresses in database")
+	}
+	if images[0].LastModified.IsZero() {
+		t.Error("Expected time of modification")
+	}
+}
@@ -6,13 +6,28 @@
 Package sessionmanager is used to implement model.SM interface. Its purpose
 is controlling sessions of clients that are used for authentification.
 
-Session manager uses key-value storage Redis for sessions.
+Session manager uses key-value storage Redis for sessions by default.
+Sessions also can be stored in memory of the process if Type of config
+is "memory". It doesn't need Redis, but sessions are lost on restart and
+can't be shared between several instances of service.
 */
 package sessionmanager
 
-// Config is a struct for configuring session manager.
+// Config is a struct for configuring session manager. Type is "redis" (default)
+// or "memory". CleanupInterval is period in seconds of removing expired
+// sessions from memory; it's used only by "memory" session manager.
+//
+// MaxIdle, MaxActive and IdleTimeout configure pool of connections to redis.
+// MaxIdle is maximum number of idle connections in the pool, MaxActive is maximum
+// number of connections at the same time (zero means no limit) and IdleTimeout
+// is time in seconds after which idle connection is closed (zero means never).
 type Config struct {
-	DBAddress      string `json:"DBAddress,"`
-	TockenLength   int    `json:"TockenLength,int"`
-	ExpirationTime int    `json:"ExpirationTime,int"`
+	Type            string `json:"Type,"`
+	DBAddress       string `json:"DBAddress,"`
+	TockenLength    int    `json:"TockenLength,int"`
+	ExpirationTime  int    `json:"ExpirationTime,int"`
+	CleanupInterval int    `json:"CleanupInterval,int"`
+	MaxIdle         int    `json:"MaxIdle,int"`
+	MaxActive       int    `json:"MaxActive,int"`
+	IdleTimeout     int    `json:"IdleTimeout,int"`
 }
@@ -5,24 +5,55 @@
 package sessionmanager
 
 import (
+	"errors"
 	"log"
+	"time"
 
+	"bmstu.codes/developers34/SBWeb/pkg/model"
 	"github.com/garyburd/redigo/redis"
 )
 
-// InitConnSM initiates connection to redis database.
-// It returns struct that implements model.SM interface used
-// by API to interact with sessions.
+// InitSM initiates session manager of type provided in config.
+func InitSM(cfg Config) (model.SM, error) {
+	switch cfg.Type {
+	case "", "redis":
+		return InitConnSM(cfg)
+	case "memory":
+		return InitMemorySM(cfg), nil
+	default:
+		return nil, errors.New("Unknown type of session manager: " + cfg.Type)
+	}
+}
+
+// InitConnSM initiates pool of connections to redis database and
+// checks that redis is accessible. It returns struct that implements
+// model.SM interface used by API to interact with sessions.
 func InitConnSM(cfg Config) (*SessionManager, error) {
-	redisConn, err := redis.DialURL(cfg.DBAddress)
-	if err != nil {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(cfg.DBAddress)
+		},
+		// connection could be closed by redis while it was idle
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+		MaxIdle:     cfg.MaxIdle,
+		MaxActive:   cfg.MaxActive,
+		IdleTimeout: time.Duration(cfg.IdleTimeout) * time.Second,
+		Wait:        true,
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
 		log.Println(err.Error())
+		pool.Close()
 		return nil, err
 	}
 
 	sessManager := &SessionManager{
-		redisAddr:      cfg.DBAddress,
-		redisConn:      redisConn,
+		pool:           pool,
 		tockenLength:   cfg.TockenLength,
 		expirationTime: cfg.ExpirationTime,
 	}
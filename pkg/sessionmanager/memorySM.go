@@ -0,0 +1,203 @@
+// Copyright 2018 Dmitry Kargashin <dkargashin3@gmail.com>
+// Use of this source code is governed by GNU LGPL
+// license that can be found in the LICENSE file.
+
+package sessionmanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+)
+
+// default period of removing expired sessions in seconds
+const defaultCleanupInterval = 60
+
+var errNoSession = errors.New("No session with such ID")
+
+// memorySession is a session stored in memory. Zero expires
+// means that session never expires.
+type memorySession struct {
+	data    model.Session
+	expires time.Time
+}
+
+// MemorySessionManager stores sessions in memory of the process.
+type MemorySessionManager struct {
+	mu       sync.RWMutex
+	sessions map[string]memorySession
+
+	tockenLength   int
+	expirationTime int
+
+	done chan struct{}
+	once sync.Once
+}
+
+// InitMemorySM creates session manager that stores sessions in
+// memory and starts periodic removing of expired sessions.
+func InitMemorySM(cfg Config) *MemorySessionManager {
+	interval := cfg.CleanupInterval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+
+	sessManager := &MemorySessionManager{
+		sessions:       make(map[string]memorySession),
+		tockenLength:   cfg.TockenLength,
+		expirationTime: cfg.ExpirationTime,
+		done:           make(chan struct{}),
+	}
+
+	go sessManager.cleanup(time.Duration(interval) * time.Second)
+
+	return sessManager
+}
+
+// CreateSession creates new session.
+func (sm *MemorySessionManager) CreateSession(ctx context.Context, in *model.Session, expires bool) (*model.SessionID, error) {
+	if in == nil {
+		return nil, errors.New("No session data")
+	}
+
+	tocken, err := generateRandomString(sm.tockenLength)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := memorySession{data: *in}
+	sess.data.CreationTime = time.Now()
+	sess.data.LastSeen = sess.data.CreationTime
+	sess.data.Hash = model.HashToken(tocken)
+	if expires {
+		sess.expires = time.Now().Add(time.Duration(sm.expirationTime) * time.Second)
+	}
+
+	sm.mu.Lock()
+	sm.sessions[tocken] = sess
+	sm.mu.Unlock()
+
+	return &model.SessionID{ID: tocken, Expires: sess.expires}, nil
+}
+
+// CheckSession checks if session with such ID exists and isn't expired.
+// Time when session was seen is updated not more often than lastSeenInterval.
+func (sm *MemorySessionManager) CheckSession(ctx context.Context, in *model.SessionID) (*model.Session, error) {
+	now := time.Now()
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sess, ok := sm.sessions[in.ID]
+	if !ok || sess.isExpired(now) {
+		return nil, errNoSession
+	}
+	if now.Sub(sess.data.LastSeen) >= lastSeenInterval {
+		sess.data.LastSeen = now
+		sm.sessions[in.ID] = sess
+	}
+
+	data := sess.data
+	return &data, nil
+}
+
+// DeleteSession deletes session with such ID.
+func (sm *MemorySessionManager) DeleteSession(ctx context.Context, in *model.SessionID) error {
+	sm.mu.Lock()
+	delete(sm.sessions, in.ID)
+	sm.mu.Unlock()
+	return nil
+}
+
+// GetUserSessions returns sessions of user with such ID from the newest one.
+func (sm *MemorySessionManager) GetUserSessions(ctx context.Context, userID int64) ([]*model.Session, error) {
+	now := time.Now()
+	sessions := make([]*model.Session, 0)
+
+	sm.mu.RLock()
+	for _, sess := range sm.sessions {
+		if sess.data.ID == userID && !sess.isExpired(now) {
+			data := sess.data
+			sessions = append(sessions, &data)
+		}
+	}
+	sm.mu.RUnlock()
+	sortSessions(sessions)
+
+	return sessions, nil
+}
+
+// DeleteUserSession deletes session of user with such ID by hash of its
+// tocken. It returns 0 if user has no such session.
+func (sm *MemorySessionManager) DeleteUserSession(ctx context.Context, userID int64, hash string) (int64, error) {
+	now := time.Now()
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for id, sess := range sm.sessions {
+		if sess.data.ID == userID && sess.data.Hash == hash {
+			delete(sm.sessions, id)
+			if sess.isExpired(now) {
+				return 0, nil
+			}
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// DeleteUserSessions deletes all sessions of user with such ID
+// except session except; except can be nil.
+func (sm *MemorySessionManager) DeleteUserSessions(ctx context.Context, userID int64, except *model.SessionID) error {
+	sm.mu.Lock()
+	for id, sess := range sm.sessions {
+		if sess.data.ID == userID && (except == nil || id != except.ID) {
+			delete(sm.sessions, id)
+		}
+	}
+	sm.mu.Unlock()
+	return nil
+}
+
+// IsConnected always returns true because there is no connection
+func (sm *MemorySessionManager) IsConnected(ctx context.Context) bool {
+	return true
+}
+
+// Close stops removing of expired sessions.
+func (sm *MemorySessionManager) Close() {
+	sm.once.Do(func() {
+		close(sm.done)
+	})
+}
+
+// cleanup removes expired sessions every interval until Close is called.
+func (sm *MemorySessionManager) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sm.mu.Lock()
+			for id, sess := range sm.sessions {
+				if sess.isExpired(now) {
+					delete(sm.sessions, id)
+				}
+			}
+			sm.mu.Unlock()
+		case <-sm.done:
+			return
+		}
+	}
+}
+
+// isExpired checks if session is expired at the moment.
+func (s memorySession) isExpired(now time.Time) bool {
+	return !s.expires.IsZero() && !now.Before(s.expires)
+}
@@ -4,12 +4,29 @@
 
 package sessionmanager
 
-import "github.com/garyburd/redigo/redis"
+import (
+	"sort"
+	"time"
 
-// SessionManager stores connection to redis database.
+	"bmstu.codes/developers34/SBWeb/pkg/model"
+	"github.com/garyburd/redigo/redis"
+)
+
+// lastSeenInterval is minimal period of updating of time
+// when session was seen, so session isn't written on every check
+const lastSeenInterval = time.Minute
+
+// SessionManager stores pool of connections to redis database.
+// It's safe for concurrent use.
 type SessionManager struct {
-	redisConn      redis.Conn
+	pool           *redis.Pool
 	tockenLength   int
 	expirationTime int
-	redisAddr      string
+}
+
+// sortSessions orders sessions from the newest one.
+func sortSessions(sessions []*model.Session) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreationTime.After(sessions[j].CreationTime)
+	})
 }
@@ -5,6 +5,9 @@
 package sessionmanager_test
 
 import (
+	"context"
+	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,6 +17,8 @@ import (
 )
 
 func TestInitSM(t *testing.T) {
+	ctx := context.Background()
+
 	s, err := miniredis.Run()
 	if err != nil {
 		panic(err)
@@ -41,10 +46,12 @@ func TestInitSM(t *testing.T) {
 		t.Error("SM must have been initiated")
 	}
 
-	SM.CreateSession(nil, true)
+	SM.CreateSession(ctx, nil, true)
 }
 
 func TestInterfaceSession(t *testing.T) {
+	ctx := context.Background()
+
 	s, err := miniredis.Run()
 	if err != nil {
 		panic(err)
@@ -59,79 +66,438 @@ func TestInterfaceSession(t *testing.T) {
 		t.Error(err)
 	}
 
-	sID, _ := SM.CreateSession(&model.Session{
+	sID, _ := SM.CreateSession(ctx, &model.Session{
 		ID:        15,
 		Login:     "aaa@eee.ru",
 		UserAgent: "ieieie",
 	}, true)
 
-	_, err = SM.CheckSession(sID)
+	_, err = SM.CheckSession(ctx, sID)
 	if err != nil {
 		t.Error("Key must exist")
 	}
 
 	s.FastForward(5 * time.Second)
 
-	res, _ := SM.CheckSession(sID)
+	res, _ := SM.CheckSession(ctx, sID)
 	if res != nil {
 		t.Error("Key mustn't exist")
 	}
 
-	sID, _ = SM.CreateSession(&model.Session{
+	sID, _ = SM.CreateSession(ctx, &model.Session{
 		ID:        15,
 		Login:     "aaa@eee.ru",
 		UserAgent: "ieieie",
 	}, true)
 
-	_, err = SM.CheckSession(sID)
+	_, err = SM.CheckSession(ctx, sID)
 	if err != nil {
 		t.Error("Key must exist")
 	}
 
-	SM.DeleteSession(sID)
+	// canceled request mustn't reach redis
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = SM.CheckSession(canceled, sID); err != context.Canceled {
+		t.Error("Expected context.Canceled got", err)
+	}
 
-	res, _ = SM.CheckSession(sID)
+	SM.DeleteSession(ctx, sID)
+
+	res, _ = SM.CheckSession(ctx, sID)
 	if res != nil {
 		t.Error("Key mustn't exist")
 	}
 
-	sID, _ = SM.CreateSession(&model.Session{
+	sID, _ = SM.CreateSession(ctx, &model.Session{
 		ID:        15,
 		Login:     "aaa@eee.ru",
 		UserAgent: "ieieie",
 	}, false)
 
-	_, err = SM.CheckSession(sID)
+	_, err = SM.CheckSession(ctx, sID)
 	if err != nil {
 		t.Error("Key must exist")
 	}
 
 	s.FastForward(5 * time.Second)
 
-	_, err = SM.CheckSession(sID)
+	_, err = SM.CheckSession(ctx, sID)
 	if err != nil {
 		t.Error("Key must exist")
 	}
 
-	if !SM.IsConnected() {
+	if !SM.IsConnected(ctx) {
 		t.Error("Must be connected")
 	}
 
 	s.Close()
 
-	if SM.IsConnected() {
+	if SM.IsConnected(ctx) {
 		t.Error("Must not be connected")
 	}
 
+	// pool must reconnect by itself
 	s.Restart()
 
-	if SM.TryReconnect() != nil {
-		t.Error("Unexpected error")
+	if !SM.IsConnected(ctx) {
+		t.Error("Must be connected")
+	}
+
+	sID, err = SM.CreateSession(ctx, &model.Session{
+		ID:        15,
+		Login:     "aaa@eee.ru",
+		UserAgent: "ieieie",
+	}, true)
+	if err != nil {
+		t.Error("Unexpected error", err)
 	}
-	SM.IsConnected()
+
 	s.Close()
 
-	if SM.TryReconnect() == nil {
+	if _, err = SM.CheckSession(ctx, sID); err == nil {
+		t.Error("Expected error")
+	}
+
+	SM.Close()
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	SM, err := sm.InitConnSM(sm.Config{
+		DBAddress:      `redis://user:@localhost:` + s.Port() + `/0`,
+		TockenLength:   32,
+		ExpirationTime: 100,
+		MaxIdle:        2,
+		MaxActive:      4,
+		IdleTimeout:    10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SM.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sID, err := SM.CreateSession(ctx, &model.Session{ID: int64(i)}, true)
+			if err != nil {
+				t.Error("Unexpected error", err)
+				return
+			}
+			sess, err := SM.CheckSession(ctx, sID)
+			if err != nil || sess.ID != int64(i) {
+				t.Error("Expected own session", sess, err)
+			}
+			SM.DeleteSession(ctx, sID)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestInitMemorySM(t *testing.T) {
+	SM, err := sm.InitSM(sm.Config{
+		Type:           "memory",
+		TockenLength:   32,
+		ExpirationTime: 1,
+	})
+	if err != nil {
+		t.Error("SM must have been initiated")
+	}
+	if _, ok := SM.(*sm.MemorySessionManager); !ok {
+		t.Error("Expected memory session manager")
+	}
+
+	_, err = sm.InitSM(sm.Config{
+		Type: "unknown",
+	})
+	if err == nil {
+		t.Error("SM can't be initiated with unknown type")
+	}
+}
+
+func TestInterfaceMemorySession(t *testing.T) {
+	ctx := context.Background()
+
+	SM := sm.InitMemorySM(sm.Config{
+		TockenLength:    32,
+		ExpirationTime:  1,
+		CleanupInterval: 1,
+	})
+	defer SM.Close()
+
+	if _, err := SM.CreateSession(ctx, nil, true); err == nil {
 		t.Error("Expected error")
 	}
+
+	sID, _ := SM.CreateSession(ctx, &model.Session{
+		ID:        15,
+		Login:     "aaa@eee.ru",
+		UserAgent: "ieieie",
+	}, true)
+
+	res, err := SM.CheckSession(ctx, sID)
+	if err != nil {
+		t.Error("Key must exist")
+	} else if res.ID != 15 || res.Login != "aaa@eee.ru" {
+		t.Error("Unexpected session", res)
+	}
+
+	sIDNotExpires, _ := SM.CreateSession(ctx, &model.Session{
+		ID:        15,
+		Login:     "aaa@eee.ru",
+		UserAgent: "Android_app",
+	}, false)
+
+	time.Sleep(1500 * time.Millisecond)
+
+	res, _ = SM.CheckSession(ctx, sID)
+	if res != nil {
+		t.Error("Key mustn't exist")
+	}
+
+	_, err = SM.CheckSession(ctx, sIDNotExpires)
+	if err != nil {
+		t.Error("Key must exist")
+	}
+
+	SM.DeleteSession(ctx, sIDNotExpires)
+
+	res, _ = SM.CheckSession(ctx, sIDNotExpires)
+	if res != nil {
+		t.Error("Key mustn't exist")
+	}
+
+	if !SM.IsConnected(ctx) {
+		t.Error("Must be connected")
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	redisSM, err := sm.InitConnSM(sm.Config{
+		DBAddress:      `redis://user:@localhost:` + s.Port() + `/0`,
+		TockenLength:   32,
+		ExpirationTime: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisSM.Close()
+
+	memorySM := sm.InitMemorySM(sm.Config{
+		TockenLength:   32,
+		ExpirationTime: 100,
+	})
+	defer memorySM.Close()
+
+	for _, SM := range []model.SM{redisSM, memorySM} {
+		// many sessions of one user
+		var sIDs []*model.SessionID
+		for i := 0; i < 30; i++ {
+			sID, _ := SM.CreateSession(ctx, &model.Session{ID: 15}, i%2 == 0)
+			sIDs = append(sIDs, sID)
+		}
+		other, _ := SM.CreateSession(ctx, &model.Session{ID: 16}, true)
+
+		if err = SM.DeleteUserSessions(ctx, 15, sIDs[0]); err != nil {
+			t.Error("Unexpected error", err)
+		}
+		for _, sID := range sIDs[1:] {
+			if res, _ := SM.CheckSession(ctx, sID); res != nil {
+				t.Error("Key mustn't exist")
+			}
+		}
+		if _, err = SM.CheckSession(ctx, sIDs[0]); err != nil {
+			t.Error("Key of current session must exist")
+		}
+		if _, err = SM.CheckSession(ctx, other); err != nil {
+			t.Error("Key of other user must exist")
+		}
+
+		SM.DeleteUserSessions(ctx, 15, nil)
+		if res, _ := SM.CheckSession(ctx, sIDs[0]); res != nil {
+			t.Error("Key mustn't exist")
+		}
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	redisSM, err := sm.InitConnSM(sm.Config{
+		DBAddress:      `redis://user:@localhost:` + s.Port() + `/0`,
+		TockenLength:   32,
+		ExpirationTime: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisSM.Close()
+
+	memorySM := sm.InitMemorySM(sm.Config{
+		TockenLength:   32,
+		ExpirationTime: 100,
+	})
+	defer memorySM.Close()
+
+	for _, SM := range []model.SM{redisSM, memorySM} {
+		first, _ := SM.CreateSession(ctx, &model.Session{
+			ID:        15,
+			UserAgent: "first",
+			IP:        "127.0.0.1",
+		}, true)
+		time.Sleep(10 * time.Millisecond)
+		second, _ := SM.CreateSession(ctx, &model.Session{ID: 15, UserAgent: "second"}, false)
+		other, _ := SM.CreateSession(ctx, &model.Session{ID: 16}, true)
+		if d := time.Until(first.Expires); d <= 99*time.Second || d > 100*time.Second ||
+			!second.Expires.IsZero() {
+			t.Error("Expected expiration time of session", first.Expires, second.Expires)
+		}
+
+		sessions, err := SM.GetUserSessions(ctx, 15)
+		if err != nil {
+			t.Error("Unexpected error", err)
+		}
+		if len(sessions) != 2 {
+			t.Fatal("Expected 2 sessions, got", len(sessions))
+		}
+		if sessions[0].UserAgent != "second" || sessions[1].UserAgent != "first" {
+			t.Error("Sessions must be sorted from the newest one")
+		}
+		if sessions[0].Hash != model.HashToken(second.ID) ||
+			sessions[1].Hash != model.HashToken(first.ID) {
+			t.Error("Expected hash of tocken as ID of session")
+		}
+		if sessions[1].IP != "127.0.0.1" || sessions[1].CreationTime.IsZero() ||
+			sessions[1].LastSeen.IsZero() {
+			t.Error("Expected info of session")
+		}
+
+		// session of other user can't be deleted
+		affected, err := SM.DeleteUserSession(ctx, 16, sessions[0].Hash)
+		if err != nil || affected != 0 {
+			t.Error("Expected nothing deleted, got", affected, err)
+		}
+		affected, err = SM.DeleteUserSession(ctx, 15, sessions[0].Hash)
+		if err != nil || affected != 1 {
+			t.Error("Expected deleted session, got", affected, err)
+		}
+		if res, _ := SM.CheckSession(ctx, second); res != nil {
+			t.Error("Key mustn't exist")
+		}
+		if res, _ := SM.CheckSession(ctx, first); res == nil {
+			t.Error("Key must exist")
+		}
+		if res, _ := SM.CheckSession(ctx, other); res == nil {
+			t.Error("Key of other user must exist")
+		}
+
+		sessions, _ = SM.GetUserSessions(ctx, 15)
+		if len(sessions) != 1 {
+			t.Error("Expected 1 session, got", len(sessions))
+		}
+
+		// logout removes session from list
+		SM.DeleteSession(ctx, first)
+		sessions, _ = SM.GetUserSessions(ctx, 15)
+		if len(sessions) != 0 {
+			t.Error("Expected no sessions, got", len(sessions))
+		}
+	}
+
+	// expired sessions aren't listed
+	redisSM.CreateSession(ctx, &model.Session{ID: 17}, true)
+	s.FastForward(101 * time.Second)
+	sessions, err := redisSM.GetUserSessions(ctx, 17)
+	if err != nil || len(sessions) != 0 {
+		t.Error("Expected no sessions, got", len(sessions), err)
+	}
+}
+
+func TestIndexOfUserSessions(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := miniredis.Run()
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	redisSM, err := sm.InitConnSM(sm.Config{
+		DBAddress:      `redis://user:@localhost:` + s.Port() + `/0`,
+		TockenLength:   32,
+		ExpirationTime: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer redisSM.Close()
+
+	// index lives while sessions of user live
+	redisSM.CreateSession(ctx, &model.Session{ID: 20}, true)
+	if ttl := s.TTL("user_sessions:20"); ttl != 100*time.Second {
+		t.Error("Expected TTL of index, got", ttl)
+	}
+	s.FastForward(60 * time.Second)
+	redisSM.CreateSession(ctx, &model.Session{ID: 20}, true)
+	if ttl := s.TTL("user_sessions:20"); ttl != 100*time.Second {
+		t.Error("Expected prolonged TTL of index, got", ttl)
+	}
+
+	// expired session is removed from index by creation of session
+	s.FastForward(60 * time.Second)
+	redisSM.CreateSession(ctx, &model.Session{ID: 20}, false)
+	if fields, _ := s.HKeys("user_sessions:20"); len(fields) != 2 {
+		t.Error("Expected 2 sessions in index, got", len(fields))
+	}
+
+	// index with session which never expires doesn't expire too
+	if ttl := s.TTL("user_sessions:20"); ttl != 0 {
+		t.Error("Expected index without TTL, got", ttl)
+	}
+	redisSM.CreateSession(ctx, &model.Session{ID: 20}, true)
+	if ttl := s.TTL("user_sessions:20"); ttl != 0 {
+		t.Error("Expected index without TTL, got", ttl)
+	}
+
+	// session created without index is added to it when it's checked
+	data, _ := json.Marshal(&model.Session{ID: 21, LastSeen: time.Now().Add(-2 * time.Minute)})
+	s.Set("sessions:abc", string(data))
+	s.SetTTL("sessions:abc", 50*time.Second)
+	if res, _ := redisSM.CheckSession(ctx, &model.SessionID{ID: "abc"}); res == nil {
+		t.Fatal("Key must exist")
+	}
+	if tocken := s.HGet("user_sessions:21", model.HashToken("abc")); tocken != "abc" {
+		t.Error("Expected session in index, got", tocken)
+	}
+	if ttl := s.TTL("user_sessions:21"); ttl != 100*time.Second {
+		t.Error("Expected TTL of index, got", ttl)
+	}
+	s.FastForward(101 * time.Second)
+	if s.Exists("user_sessions:21") {
+		t.Error("Expected expired index")
+	}
 }
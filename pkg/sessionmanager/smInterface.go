@@ -5,39 +5,88 @@
 package sessionmanager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"strconv"
+	"time"
 
 	"bmstu.codes/developers34/SBWeb/pkg/model"
 	"github.com/garyburd/redigo/redis"
 )
 
-// CreateSession creates new session in database.
-func (sm *SessionManager) CreateSession(in *model.Session, expires bool) (*model.SessionID, error) {
+// sessionKey returns key of session with such tocken.
+func sessionKey(tocken string) string {
+	return "sessions:" + tocken
+}
+
+// indexKey returns key of hash which maps hashes of tockens
+// of sessions of user to tockens.
+func indexKey(userID int64) string {
+	return "user_sessions:" + strconv.FormatInt(userID, 10)
+}
+
+// addToIndexScript adds session KEYS[2] to index of user KEYS[1] as field ARGV[1]
+// with value ARGV[2] only if session exists, so session deleted concurrently isn't
+// added back. Index lives at least ARGV[3] seconds; it never expires if ARGV[3] is 0
+// or if it already has session which never expires.
+const addToIndexScript = `
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 0
+end
+local ttl = redis.call('TTL', KEYS[1])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if ARGV[3] == '0' then
+	redis.call('PERSIST', KEYS[1])
+elseif ttl ~= -1 then
+	redis.call('EXPIRE', KEYS[1], math.max(ttl, tonumber(ARGV[3])))
+end
+return 1`
+
+// CreateSession creates new session in database and adds it to index of user.
+// Expired sessions are removed from index of user.
+func (sm *SessionManager) CreateSession(ctx context.Context, in *model.Session, expires bool) (*model.SessionID, error) {
+	if in == nil {
+		return nil, errors.New("No session data")
+	}
+
 	tocken, err := generateRandomString(sm.tockenLength)
 	if err != nil {
 		return nil, err
 	}
 
-	id := model.SessionID{ID: tocken}
-	dataSerialized, _ := json.Marshal(in)
-	mkey := "sessions:" + id.ID
+	sess := *in
+	sess.CreationTime = time.Now()
+	sess.LastSeen = sess.CreationTime
+	sess.Hash = model.HashToken(tocken)
+	dataSerialized, _ := json.Marshal(&sess)
+	mkey := sessionKey(tocken)
+	id := &model.SessionID{ID: tocken}
 	if expires {
-		_, err = redis.String(sm.redisConn.Do("SET", mkey, dataSerialized, "EX", sm.expirationTime))
+		id.Expires = sess.CreationTime.Add(time.Duration(sm.expirationTime) * time.Second)
+		_, err = redis.String(sm.do(ctx, "SET", mkey, dataSerialized, "EX", sm.expirationTime))
 	} else {
-		_, err = redis.String(sm.redisConn.Do("SET", mkey, dataSerialized))
+		_, err = redis.String(sm.do(ctx, "SET", mkey, dataSerialized))
 	}
 	if err != nil {
 		return nil, err
 	}
+	if err = sm.pruneIndex(ctx, sess.ID); err != nil {
+		return nil, err
+	}
+	if err = sm.addToIndex(ctx, &sess, tocken, expires); err != nil {
+		return nil, err
+	}
 
-	return &id, nil
+	return id, nil
 }
 
 // CheckSession checks if session with such ID exists in database.
-func (sm *SessionManager) CheckSession(in *model.SessionID) (*model.Session, error) {
-	mkey := "sessions:" + in.ID
-	data, err := redis.Bytes(sm.redisConn.Do("GET", mkey))
+// Time when session was seen is updated not more often than lastSeenInterval.
+func (sm *SessionManager) CheckSession(ctx context.Context, in *model.SessionID) (*model.Session, error) {
+	mkey := sessionKey(in.ID)
+	data, err := redis.Bytes(sm.do(ctx, "GET", mkey))
 	if err != nil {
 		return nil, err
 	}
@@ -47,34 +96,205 @@ func (sm *SessionManager) CheckSession(in *model.SessionID) (*model.Session, err
 	if err != nil {
 		return nil, err
 	}
+	sess.Hash = model.HashToken(in.ID)
+
+	if now := time.Now(); now.Sub(sess.LastSeen) >= lastSeenInterval {
+		sess.LastSeen = now
+		if err = sm.updateSession(ctx, in.ID, sess); err != nil {
+			log.Println(err.Error())
+		}
+	}
 
 	return sess, nil
 }
 
+// updateSession replaces data of session keeping its expiration time.
+// Session is also added to index of user if it was created without index
+// and it isn't deleted yet.
+func (sm *SessionManager) updateSession(ctx context.Context, tocken string, sess *model.Session) error {
+	mkey := sessionKey(tocken)
+	ttl, err := redis.Int64(sm.do(ctx, "PTTL", mkey))
+	if err != nil {
+		return err
+	}
+
+	dataSerialized, _ := json.Marshal(sess)
+	switch {
+	case ttl > 0:
+		_, err = sm.do(ctx, "SET", mkey, dataSerialized, "PX", ttl, "XX")
+	case ttl == -1: // session never expires
+		_, err = sm.do(ctx, "SET", mkey, dataSerialized, "XX")
+	default: // session has just expired
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return sm.addToIndex(ctx, sess, tocken, ttl > 0)
+}
+
+// addToIndex adds session with such tocken to index of user if session exists
+// and prolongs life of index, so index doesn't outlive sessions of user.
+func (sm *SessionManager) addToIndex(ctx context.Context, sess *model.Session, tocken string, expires bool) error {
+	ttl := 0
+	if expires {
+		ttl = sm.expirationTime
+	}
+	_, err := sm.do(ctx, "EVAL", addToIndexScript, 2, indexKey(sess.ID), sessionKey(tocken),
+		sess.Hash, tocken, ttl)
+	return err
+}
+
+// pruneIndex removes expired sessions from index of user with such ID.
+func (sm *SessionManager) pruneIndex(ctx context.Context, userID int64) error {
+	index, err := redis.StringMap(sm.do(ctx, "HGETALL", indexKey(userID)))
+	if err != nil {
+		return err
+	}
+
+	for hash, tocken := range index {
+		exists, err := redis.Bool(sm.do(ctx, "EXISTS", sessionKey(tocken)))
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err = sm.do(ctx, "HDEL", indexKey(userID), hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // DeleteSession deletes session with such ID.
-func (sm *SessionManager) DeleteSession(in *model.SessionID) error {
-	mkey := "sessions:" + in.ID
-	_, err := redis.Int(sm.redisConn.Do("DEL", mkey))
+func (sm *SessionManager) DeleteSession(ctx context.Context, in *model.SessionID) error {
+	mkey := sessionKey(in.ID)
+	data, err := redis.Bytes(sm.do(ctx, "GET", mkey))
+	if err == redis.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = redis.Int(sm.do(ctx, "DEL", mkey)); err != nil {
+		return err
+	}
+
+	sess := model.Session{}
+	if err = json.Unmarshal(data, &sess); err != nil {
+		return err
+	}
+	_, err = sm.do(ctx, "HDEL", indexKey(sess.ID), model.HashToken(in.ID))
 	return err
 }
 
-// TryReconnect reconnects to redis
-func (sm *SessionManager) TryReconnect() error {
-	// sm.redisConn.Close()
-	conn, err := redis.DialURL(sm.redisAddr)
+// GetUserSessions returns sessions of user with such ID from the newest one.
+// Expired sessions are removed from index of user.
+func (sm *SessionManager) GetUserSessions(ctx context.Context, userID int64) ([]*model.Session, error) {
+	index, err := redis.StringMap(sm.do(ctx, "HGETALL", indexKey(userID)))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*model.Session, 0, len(index))
+	for hash, tocken := range index {
+		data, err := redis.Bytes(sm.do(ctx, "GET", sessionKey(tocken)))
+		if err == redis.ErrNil {
+			if _, err = sm.do(ctx, "HDEL", indexKey(userID), hash); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sess := &model.Session{}
+		if err = json.Unmarshal(data, sess); err != nil {
+			return nil, err
+		}
+		sess.Hash = hash
+		sessions = append(sessions, sess)
+	}
+	sortSessions(sessions)
+
+	return sessions, nil
+}
+
+// DeleteUserSession deletes session of user with such ID by hash of its
+// tocken. It returns 0 if user has no such session.
+func (sm *SessionManager) DeleteUserSession(ctx context.Context, userID int64, hash string) (int64, error) {
+	tocken, err := redis.String(sm.do(ctx, "HGET", indexKey(userID), hash))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := redis.Int64(sm.do(ctx, "DEL", sessionKey(tocken)))
+	if err != nil {
+		return 0, err
+	}
+	if _, err = sm.do(ctx, "HDEL", indexKey(userID), hash); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// DeleteUserSessions deletes all sessions of user with such ID
+// except session except; except can be nil.
+func (sm *SessionManager) DeleteUserSessions(ctx context.Context, userID int64, except *model.SessionID) error {
+	index, err := redis.StringMap(sm.do(ctx, "HGETALL", indexKey(userID)))
 	if err != nil {
-		log.Println(err.Error())
 		return err
 	}
-	sm.redisConn = conn
+
+	for hash, tocken := range index {
+		if except != nil && tocken == except.ID {
+			continue
+		}
+		if _, err = sm.do(ctx, "DEL", sessionKey(tocken)); err != nil {
+			return err
+		}
+		if _, err = sm.do(ctx, "HDEL", indexKey(userID), hash); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// IsConnected checks if connection is active
-func (sm *SessionManager) IsConnected() bool {
-	_, err := sm.redisConn.Do("PING")
+// IsConnected checks if redis is accessible
+func (sm *SessionManager) IsConnected(ctx context.Context) bool {
+	_, err := sm.do(ctx, "PING")
+	return err == nil
+}
+
+// Close closes pool of connections to redis
+func (sm *SessionManager) Close() {
+	sm.pool.Close()
+}
+
+// do sends command to redis using connection from pool. Waiting
+// for connection and reply is limited by deadline of context.
+func (sm *SessionManager) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := sm.pool.GetContext(ctx)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.DoWithTimeout(conn, time.Until(deadline), cmd, args...)
 	}
-	return true
+	return conn.Do(cmd, args...)
 }
@@ -8,35 +8,99 @@ It's supposed to search and hire specialists of building industry.
 
 Usage of application
 
-Environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be specified.
+Environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be specified
+if images are stored in AWS S3.
 If environment variable PORT is specified then its value will override value of config API address.
 If environment variable REDIS_URL is specified then its value will override value of config SM DBAddress.
 If environment variable DATABASE_URL is specified then its value will override value of config DB DBAddress.
+If environment variable SMTP_PASSWORD is specified then its value will override value of config Mailer SMTP Password.
 
 To run application you need to specify the "cfg" parameter that receives
 path to config file formatted as JSON.
 
+Schema of database is changed by versioned migrations. Service refuses to start
+if schema of database is older than required. To manage migrations run application
+with the "migrate" parameter; application exits after migration:
+  -migrate up        apply all new migrations
+  -migrate down      revert the last applied migration
+  -migrate status    show state of every migration
+
+Images which are not referenced by ads and users are removed by garbage collector.
+It runs in background if GC Interval is set in config. To run it once use
+the "gc" parameter; application exits after that and prints report:
+  -gc                remove orphaned images
+  -gc -dry-run       only show orphaned images
+
+Saved searches of users are checked for new ads in background if Alerts
+Interval is set in config; found ads are recorded as alerts of users and
+sent to their emails if Alerts Mail is set.
+
 Config has this structure:
   {
     "DB": {
+      "Type": <Which database to use: "postgres" (default) or "memory" (string)>,
       "DBAddress": <Address of postgres database (string)>,
       "MaxOpenConns": <Number of maximum open connections to database (int)>
     },
     "SM": {
+      "Type": <Where to store sessions: "redis" (default) or "memory" (string)>,
       "DBAddress": <Address of redis storage (string)>,
       "TockenLength": <Length of tocken that will be used as session tocken (int)>,
-      "ExpirationTime": <Expiration time of a session in seconds (int)>
+      "ExpirationTime": <Expiration time of a session in seconds (int)>,
+      "CleanupInterval": <Period of removing expired sessions from memory in seconds (int)>,
+      "MaxIdle": <Maximum number of idle connections to redis (int)>,
+      "MaxActive": <Maximum number of connections to redis, 0 means no limit (int)>,
+      "IdleTimeout": <Time in seconds after which idle connection to redis is closed (int)>
     },
     "API": {
       "Address": <Port where the server will be started (string)>,
       "ReadTimeout": <Maximum duration for reading the entire request, including the body (string with postfix 's')>,
       "WriteTimeout": <Maximum duration before timing out writes of the response (string with postfix 's')>,
-      "IdleTimeout": <Maximum amount of time to wait for the next request when keep-alives are enabled (string with postfix 's')>
+      "IdleTimeout": <Maximum amount of time to wait for the next request when keep-alives are enabled (string with postfix 's')>,
+      "DBTimeout": <Deadline of one query to database, empty means no deadline (string with postfix 's')>,
+      "SMTimeout": <Deadline of one request to session manager, empty means no deadline (string with postfix 's')>,
+      "IMTimeout": <Deadline of one request to image manager, empty means no deadline (string with postfix 's')>,
+      "ShutdownTimeout": <Time for active requests to finish when service stops, empty means no limit (string with postfix 's')>,
+      "UploadExpiration": <Lifetime of URL for direct uploading of image, default is 15 minutes (string with postfix 'm')>,
+      "VerificationExpiration": <Lifetime of token of email verification, default is 24 hours (string with postfix 'h')>,
+      "ResetExpiration": <Lifetime of token of password reset, default is 1 hour (string with postfix 'h')>,
+      "RefreshExpiration": <Lifetime of refresh token, default is 30 days (string with postfix 'h')>,
+      "TrustProxy": <Take address of client from X-Forwarded-For added by proxy, i.e. router of Heroku (bool)>
     },
     "IM": {
+      "Type": <Where to store images: "s3" (default) or "fs" (string)>,
       "Bucket": <Name of the AWS S3 bucket where to store images (string)>,
       "ACL": <Permissions to images uploaded by application (string)>,
-      "Region": <Region of the AWS S3 bucket (string)>
+      "Region": <Region of the AWS S3 bucket (string)>,
+      "Endpoint": <Address of S3-compatible storage, empty means AWS (string)>,
+      "FS": {
+        "Directory": <Directory of local filesystem where to store images (string)>,
+        "URL": <Prefix of addresses of stored images, may be empty (string)>,
+        "Secret": <Key for signing URLs of uploads, random if empty (string)>
+      }
+    },
+    "GC": {
+      "Interval": <Period of removing orphaned images in background, empty disables it (string with postfix 'h')>,
+      "GracePeriod": <Minimal age of image that can be removed (string with postfix 'h')>,
+      "DryRun": <Only report orphaned images without removing (bool)>
+    },
+    "Alerts": {
+      "Interval": <Period of checking saved searches for new ads, empty disables it (string with postfix 'h')>,
+      "Log": <Write alerts about new ads to log (bool)>,
+      "Mail": <Send alerts about new ads to verified emails of users (bool)>
+    },
+    "Mailer": {
+      "Type": <How to send mails: "outbox" (default) or "smtp" (string)>,
+      "SMTP": {
+        "Address": <Host and port of SMTP server (string)>,
+        "Username": <Username of SMTP server, empty disables authentication (string)>,
+        "Password": <Password of SMTP server (string)>,
+        "From": <Address of sender (string)>
+      },
+      "Outbox": {
+        "Directory": <Directory where mails are written instead of sending, may be empty only with in-memory DB (string)>,
+        "From": <Address of sender (string)>
+      }
     }
   }
 */
@@ -52,6 +116,12 @@ import (
 	"bmstu.codes/developers34/SBWeb/pkg/daemon"
 )
 
+// migrateCommand is a command of migration provided in command options
+var migrateCommand string
+
+// runGC and dryRun are options of one-shot garbage collection
+var runGC, dryRun bool
+
 // setConfig parses the config provided in command options
 func setConfig() (*daemon.Config, error) {
 	cfg := daemon.Config{}
@@ -59,6 +129,9 @@ func setConfig() (*daemon.Config, error) {
 	var pathToConfigFile string
 
 	flag.StringVar(&pathToConfigFile, "cfg", "./config.json", "Path to file with configuration for service in JSON format")
+	flag.StringVar(&migrateCommand, "migrate", "", "Run migration of database (up|down|status) and exit")
+	flag.BoolVar(&runGC, "gc", false, "Remove images which are not referenced and exit")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only report images which would be removed by gc")
 	flag.Parse()
 
 	data, err := ioutil.ReadFile(pathToConfigFile)
@@ -83,6 +156,9 @@ func setConfig() (*daemon.Config, error) {
 	if os.Getenv("REDIS_URL") != "" {
 		cfg.SM.DBAddress = os.Getenv("REDIS_URL")
 	}
+	if os.Getenv("SMTP_PASSWORD") != "" {
+		cfg.Mailer.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	}
 
 	return &cfg, nil
 }
@@ -93,6 +169,18 @@ func main() {
 	if err != nil {
 		log.Fatalln("Error config", err.Error())
 	}
+	if migrateCommand != "" {
+		if err := daemon.Migrate(cfg, migrateCommand, os.Stdout); err != nil {
+			log.Fatalln("Error Migrate", err.Error())
+		}
+		return
+	}
+	if runGC {
+		if err := daemon.CollectGarbage(cfg, dryRun, os.Stdout); err != nil {
+			log.Fatalln("Error CollectGarbage", err.Error())
+		}
+		return
+	}
 	if err := daemon.RunService(cfg); err != nil {
 		log.Fatalln("Error RunService", err.Error())
 	}